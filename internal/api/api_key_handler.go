@@ -0,0 +1,151 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/dapoadedire/fem_project/internal/middleware"
+	"github.com/dapoadedire/fem_project/internal/store"
+	"github.com/dapoadedire/fem_project/internal/tokens"
+	"github.com/dapoadedire/fem_project/internal/utils"
+)
+
+type createAPIKeyRequest struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+type APIKeyHandler struct {
+	apiKeyStore store.APIKeyStore
+	logger      *slog.Logger
+}
+
+func NewAPIKeyHandler(apiKeyStore store.APIKeyStore, logger *slog.Logger) *APIKeyHandler {
+	return &APIKeyHandler{
+		apiKeyStore: apiKeyStore,
+		logger:      logger,
+	}
+}
+
+func (h *APIKeyHandler) validateCreateAPIKeyRequest(req *createAPIKeyRequest) error {
+	const maxNameLength = 100
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		return errors.New("name is required")
+	}
+	if len(req.Name) > maxNameLength {
+		return errors.New("name is too long")
+	}
+
+	if len(req.Scopes) == 0 {
+		return errors.New("at least one scope is required")
+	}
+	scopes := make([]string, 0, len(req.Scopes))
+	for _, scope := range req.Scopes {
+		if !slices.Contains(tokens.APIScopes, scope) {
+			return fmt.Errorf("unknown scope %q, must be one of %s", scope, strings.Join(tokens.APIScopes, ", "))
+		}
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	req.Scopes = scopes
+
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		return errors.New("expires_at must be in the future")
+	}
+	return nil
+}
+
+// HandleCreateAPIKey issues a new API key. Its plain text is only ever part
+// of this response.
+func (h *APIKeyHandler) HandleCreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	var req createAPIKeyRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "decodingCreateAPIKey", "error", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request sent"})
+		return
+	}
+
+	err = h.validateCreateAPIKeyRequest(&req)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+	var ttl time.Duration
+	if req.ExpiresAt != nil {
+		ttl = time.Until(*req.ExpiresAt)
+	}
+	token, err := tokens.GenerateAPIKey(currentUser.ID, ttl)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "generating API key", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	key := &store.APIKey{
+		UserID: currentUser.ID,
+		Name:   req.Name,
+		Key:    token.PlainText,
+		KeyID:  tokens.APIKeyID(token.PlainText),
+		Scopes: req.Scopes,
+		Expiry: req.ExpiresAt,
+	}
+	err = h.apiKeyStore.CreateAPIKey(r.Context(), key, token.Hash)
+	if errors.Is(err, store.ErrDuplicateAPIKey) {
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "createAPIKey", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"api_key": key})
+}
+
+func (h *APIKeyHandler) HandleListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+	keys, err := h.apiKeyStore.ListAPIKeys(r.Context(), currentUser.ID)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "listAPIKeys", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"api_keys": keys})
+}
+
+func (h *APIKeyHandler) HandleDeleteAPIKey(w http.ResponseWriter, r *http.Request) {
+	keyID, err := utils.ReadIDParam(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid API key ID"})
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+	err = h.apiKeyStore.DeleteAPIKey(r.Context(), keyID, currentUser.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "API key not found"})
+		return
+	}
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "deleteAPIKey", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusNoContent, utils.Envelope{"message": "API key deleted successfully"})
+}
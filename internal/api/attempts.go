@@ -0,0 +1,47 @@
+package api
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/dapoadedire/fem_project/internal/middleware"
+	"github.com/dapoadedire/fem_project/internal/store"
+	"github.com/dapoadedire/fem_project/internal/utils"
+)
+
+// failedAttempts counts the wrong passwords and codes given to a signed in
+// user's sensitive endpoints as failed logins, so that a stolen session
+// cannot guess them any faster than a login could.
+type failedAttempts struct {
+	store  store.LoginAttemptStore
+	logger *slog.Logger
+}
+
+// lockedOut reports whether the user is locked out, writing the error
+// response if so.
+func (a failedAttempts) lockedOut(w http.ResponseWriter, r *http.Request, userID int) bool {
+	lockedUntil, err := a.store.GetLockout(r.Context(), userID)
+	if err != nil {
+		a.logger.ErrorContext(r.Context(), "getLockout", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return true
+	}
+	if lockedUntil != nil {
+		middleware.SetRetryAfter(w, time.Until(*lockedUntil))
+		utils.WriteJSON(w, http.StatusTooManyRequests, utils.Envelope{"error": "too many failed attempts, try again later"})
+		return true
+	}
+	return false
+}
+
+// record counts a wrong guess. Failing to is logged rather than failing the
+// request, which is refused anyway.
+func (a failedAttempts) record(r *http.Request, userID int) {
+	lockedUntil, err := a.store.RecordFailedLogin(r.Context(), userID)
+	if err != nil {
+		a.logger.ErrorContext(r.Context(), "recordFailedLogin", "error", err)
+	} else if lockedUntil != nil {
+		a.logger.WarnContext(r.Context(), "account locked out", "user_id", userID, "until", *lockedUntil)
+	}
+}
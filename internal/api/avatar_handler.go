@@ -0,0 +1,200 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/dapoadedire/fem_project/internal/avatar"
+	"github.com/dapoadedire/fem_project/internal/middleware"
+	"github.com/dapoadedire/fem_project/internal/store"
+	"github.com/dapoadedire/fem_project/internal/utils"
+	"github.com/go-chi/chi/v5"
+)
+
+// avatarContentTypes are the uploads accepted, as sniffed from their content.
+var avatarContentTypes = []string{"image/jpeg", "image/png", "image/gif", "image/webp"}
+
+// avatarKeyPattern matches the keys HandleUploadAvatar stores thumbnails
+// under: avatars/<user id>/<random id>/<size>.jpg.
+var avatarKeyPattern = regexp.MustCompile(`^avatars/\d+/[0-9a-f]{32}/\d+\.jpg$`)
+
+type AvatarHandler struct {
+	userStore store.UserStore
+	blobStore store.BlobStore
+	maxSize   int
+	logger    *slog.Logger
+}
+
+func NewAvatarHandler(userStore store.UserStore, blobStore store.BlobStore, maxSize int, logger *slog.Logger) *AvatarHandler {
+	return &AvatarHandler{
+		userStore: userStore,
+		blobStore: blobStore,
+		maxSize:   maxSize,
+		logger:    logger,
+	}
+}
+
+// HandleUploadAvatar takes an image in the "avatar" field of a multipart form
+// and makes it the user's profile picture. The image is stored only as the
+// thumbnails of avatar.Thumbnails, and profile_picture is set to the key of
+// the largest; the previous avatar, if uploaded here, is deleted.
+func (h *AvatarHandler) HandleUploadAvatar(w http.ResponseWriter, r *http.Request) {
+	// the multipart envelope gets some room on top of the file itself
+	r.Body = http.MaxBytesReader(w, r.Body, int64(h.maxSize)+64<<10)
+	reader, err := r.MultipartReader()
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "request must be multipart/form-data"})
+		return
+	}
+
+	var data []byte
+	for data == nil {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err == nil && part.FormName() == "avatar" {
+			data, err = io.ReadAll(io.LimitReader(part, int64(h.maxSize)+1))
+		}
+		if err != nil {
+			h.writeReadError(w, r, err)
+			return
+		}
+	}
+	if len(data) == 0 {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "avatar file is required"})
+		return
+	}
+	if len(data) > h.maxSize {
+		utils.WriteJSON(w, http.StatusRequestEntityTooLarge, utils.Envelope{"error": fmt.Sprintf("avatar must be at most %d bytes", h.maxSize)})
+		return
+	}
+	if !slices.Contains(avatarContentTypes, http.DetectContentType(data)) {
+		utils.WriteJSON(w, http.StatusUnsupportedMediaType, utils.Envelope{"error": "avatar must be a JPEG, PNG, GIF or WebP image"})
+		return
+	}
+
+	thumbnails, err := avatar.Thumbnails(data)
+	if errors.Is(err, avatar.ErrInvalidImage) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "avatar is not a valid image"})
+		return
+	}
+	if errors.Is(err, avatar.ErrTooLarge) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "avatar dimensions are too large"})
+		return
+	}
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "making avatar thumbnails", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	user := middleware.GetUser(r)
+	id := make([]byte, 16)
+	rand.Read(id)
+	dir := fmt.Sprintf("avatars/%d/%s", user.ID, hex.EncodeToString(id))
+	for _, size := range avatar.Sizes {
+		err = h.blobStore.PutBlob(r.Context(), avatarKey(dir, size), thumbnails[size], "image/jpeg")
+		if err != nil {
+			h.logger.ErrorContext(r.Context(), "putBlob", "error", err)
+			deleteAvatar(r, h.blobStore, h.logger, dir)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+			return
+		}
+	}
+
+	previous := user.ProfilePicture
+	user.ProfilePicture = avatarKey(dir, avatar.Sizes[0])
+	err = h.userStore.UpdateUser(r.Context(), user)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "updateUser", "error", err)
+		deleteAvatar(r, h.blobStore, h.logger, dir)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	if dir := ownAvatarDir(user.ID, previous); dir != "" {
+		deleteAvatar(r, h.blobStore, h.logger, dir)
+	}
+
+	urls := make(map[int]string, len(avatar.Sizes))
+	for _, size := range avatar.Sizes {
+		urls[size] = "/" + avatarKey(dir, size)
+	}
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"user": user, "avatar_urls": urls})
+}
+
+func (h *AvatarHandler) writeReadError(w http.ResponseWriter, r *http.Request, err error) {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		utils.WriteJSON(w, http.StatusRequestEntityTooLarge, utils.Envelope{"error": fmt.Sprintf("avatar must be at most %d bytes", h.maxSize)})
+		return
+	}
+	h.logger.ErrorContext(r.Context(), "reading avatar upload", "error", err)
+	utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request sent"})
+}
+
+// ownAvatarDir returns the directory holding the thumbnails of profile
+// picture key, or "" unless it is an avatar uploaded by user userID.
+// profile_picture can be set to anything with PATCH /users/me, so only blobs
+// under the user's own prefix are theirs to delete.
+func ownAvatarDir(userID int, key string) string {
+	if !avatarKeyPattern.MatchString(key) || !strings.HasPrefix(key, fmt.Sprintf("avatars/%d/", userID)) {
+		return ""
+	}
+	return path.Dir(key)
+}
+
+// deleteAvatar removes every thumbnail of an avatar. Failures only leave
+// unused blobs behind, so they are logged rather than reported.
+func deleteAvatar(r *http.Request, blobStore store.BlobStore, logger *slog.Logger, dir string) {
+	for _, size := range avatar.Sizes {
+		err := blobStore.DeleteBlob(r.Context(), avatarKey(dir, size))
+		if err != nil {
+			logger.WarnContext(r.Context(), "deleting avatar", "key", avatarKey(dir, size), "error", err)
+		}
+	}
+}
+
+func avatarKey(dir string, size int) string {
+	return fmt.Sprintf("%s/%d.jpg", dir, size)
+}
+
+// HandleGetAvatar serves an avatar thumbnail. Avatar keys are random and
+// never reused, so they can be cached for good.
+func (h *AvatarHandler) HandleGetAvatar(w http.ResponseWriter, r *http.Request) {
+	key := "avatars/" + chi.URLParam(r, "*")
+	if !avatarKeyPattern.MatchString(key) {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "avatar not found"})
+		return
+	}
+
+	body, err := h.blobStore.GetBlob(r.Context(), key)
+	if errors.Is(err, store.ErrBlobNotFound) {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "avatar not found"})
+		return
+	}
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "getBlob", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	defer body.Close()
+
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	_, err = io.Copy(w, body)
+	if err != nil {
+		h.logger.WarnContext(r.Context(), "writing avatar", "error", err)
+	}
+}
@@ -0,0 +1,39 @@
+package api
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// backgroundTimeout bounds work started with background.run, which no longer
+// has the request's deadline to stop it.
+const backgroundTimeout = time.Minute
+
+// background runs work, such as sending email, after the response has been
+// written, so that how long it takes does not show in the response.
+type background struct {
+	wg sync.WaitGroup
+}
+
+// run calls fn in a goroutine with a context that keeps the values of the
+// request's but not its cancellation. An error is logged under name.
+func (b *background) run(r *http.Request, logger *slog.Logger, name string, fn func(ctx context.Context) error) {
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), backgroundTimeout)
+		defer cancel()
+		err := fn(ctx)
+		if err != nil {
+			logger.ErrorContext(ctx, name, "error", err)
+		}
+	}()
+}
+
+// wait blocks until all work started so far has finished.
+func (b *background) wait() {
+	b.wg.Wait()
+}
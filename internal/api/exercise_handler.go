@@ -0,0 +1,225 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/dapoadedire/fem_project/internal/middleware"
+	"github.com/dapoadedire/fem_project/internal/store"
+	"github.com/dapoadedire/fem_project/internal/utils"
+)
+
+type exerciseRequest struct {
+	Name            string   `json:"name"`
+	MuscleGroups    []string `json:"muscle_groups"`
+	Equipment       string   `json:"equipment"`
+	MeasurementType string   `json:"measurement_type"`
+}
+
+type ExerciseHandler struct {
+	exerciseStore store.ExerciseStore
+	logger        *slog.Logger
+}
+
+func NewExerciseHandler(exerciseStore store.ExerciseStore, logger *slog.Logger) *ExerciseHandler {
+	return &ExerciseHandler{
+		exerciseStore: exerciseStore,
+		logger:        logger,
+	}
+}
+
+func (h *ExerciseHandler) validateExerciseRequest(req *exerciseRequest) error {
+	const maxNameLength = 255
+
+	req.Name = strings.TrimSpace(req.Name)
+	req.Equipment = strings.TrimSpace(req.Equipment)
+	req.MeasurementType = strings.ToLower(strings.TrimSpace(req.MeasurementType))
+
+	if req.Name == "" {
+		return errors.New("name is required")
+	}
+	if len(req.Name) > maxNameLength {
+		return errors.New("name is too long")
+	}
+	if req.MeasurementType != store.MeasurementReps && req.MeasurementType != store.MeasurementDuration {
+		return errors.New("measurement_type must be either reps or duration")
+	}
+
+	muscleGroups := make([]string, 0, len(req.MuscleGroups))
+	for _, group := range req.MuscleGroups {
+		group = strings.ToLower(strings.TrimSpace(group))
+		if group != "" {
+			muscleGroups = append(muscleGroups, group)
+		}
+	}
+	req.MuscleGroups = muscleGroups
+
+	return nil
+}
+
+func (h *ExerciseHandler) HandleListExercises(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+
+	exercises, err := h.exerciseStore.ListExercises(r.Context(), store.ExerciseFilter{
+		UserID:      currentUser.ID,
+		Search:      r.URL.Query().Get("search"),
+		MuscleGroup: r.URL.Query().Get("muscle_group"),
+		Equipment:   r.URL.Query().Get("equipment"),
+	})
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "listExercises", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"exercises": exercises})
+}
+
+func (h *ExerciseHandler) HandleGetExerciseByID(w http.ResponseWriter, r *http.Request) {
+	exercise, ok := h.readVisibleExercise(w, r)
+	if !ok {
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"exercise": exercise})
+}
+
+func (h *ExerciseHandler) HandleCreateExercise(w http.ResponseWriter, r *http.Request) {
+	var req exerciseRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "decodingCreateExercise", "error", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request sent"})
+		return
+	}
+
+	err = h.validateExerciseRequest(&req)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+	exercise := &store.Exercise{
+		UserID:          &currentUser.ID,
+		Name:            req.Name,
+		MuscleGroups:    req.MuscleGroups,
+		Equipment:       req.Equipment,
+		MeasurementType: req.MeasurementType,
+	}
+
+	err = h.exerciseStore.CreateExercise(r.Context(), exercise)
+	if errors.Is(err, store.ErrDuplicateExercise) {
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "createExercise", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"exercise": exercise})
+}
+
+func (h *ExerciseHandler) HandleUpdateExerciseByID(w http.ResponseWriter, r *http.Request) {
+	exercise, ok := h.readOwnedExercise(w, r)
+	if !ok {
+		return
+	}
+
+	var req exerciseRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "decodingUpdateExercise", "error", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request sent"})
+		return
+	}
+
+	err = h.validateExerciseRequest(&req)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	exercise.Name = req.Name
+	exercise.MuscleGroups = req.MuscleGroups
+	exercise.Equipment = req.Equipment
+	exercise.MeasurementType = req.MeasurementType
+
+	err = h.exerciseStore.UpdateExercise(r.Context(), exercise)
+	if errors.Is(err, store.ErrDuplicateExercise) {
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "updateExercise", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"exercise": exercise})
+}
+
+func (h *ExerciseHandler) HandleDeleteExercise(w http.ResponseWriter, r *http.Request) {
+	exercise, ok := h.readOwnedExercise(w, r)
+	if !ok {
+		return
+	}
+
+	err := h.exerciseStore.DeleteExercise(r.Context(), int64(exercise.ID))
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "exercise not found"})
+		return
+	}
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "deleteExercise", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusNoContent, utils.Envelope{"message": "exercise deleted successfully"})
+}
+
+// readVisibleExercise loads the exercise named by the id URL parameter, writing
+// an error response and returning false if it doesn't exist or belongs to
+// another user.
+func (h *ExerciseHandler) readVisibleExercise(w http.ResponseWriter, r *http.Request) (*store.Exercise, bool) {
+	exerciseID, err := utils.ReadIDParam(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid exercise ID"})
+		return nil, false
+	}
+
+	exercise, err := h.exerciseStore.GetExerciseByID(r.Context(), exerciseID)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "getExerciseByID", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return nil, false
+	}
+
+	currentUser := middleware.GetUser(r)
+	if exercise == nil || (!exercise.IsBuiltIn() && *exercise.UserID != currentUser.ID) {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "exercise not found"})
+		return nil, false
+	}
+
+	return exercise, true
+}
+
+// readOwnedExercise is readVisibleExercise for routes that modify the exercise,
+// which is only allowed for the user's own custom exercises.
+func (h *ExerciseHandler) readOwnedExercise(w http.ResponseWriter, r *http.Request) (*store.Exercise, bool) {
+	exercise, ok := h.readVisibleExercise(w, r)
+	if !ok {
+		return nil, false
+	}
+	if exercise.IsBuiltIn() {
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "built-in exercises cannot be modified"})
+		return nil, false
+	}
+	return exercise, true
+}
@@ -0,0 +1,195 @@
+package api
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/dapoadedire/fem_project/internal/middleware"
+	"github.com/dapoadedire/fem_project/internal/store"
+	"github.com/dapoadedire/fem_project/internal/utils"
+)
+
+const (
+	ExportCSV    = "csv"
+	ExportJSON   = "json"
+	ExportNDJSON = "ndjson"
+)
+
+var exportCSVHeader = []string{
+	"workout_id", "workout_date", "title", "description", "duration_minutes", "calories_burned",
+	"entry_id", "exercise_id", "exercise_name", "sets", "reps", "duration_seconds", "weight", "rpe", "notes", "order_index",
+}
+
+type ExportHandler struct {
+	workoutStore store.WorkoutStore
+	logger       *slog.Logger
+}
+
+func NewExportHandler(workoutStore store.WorkoutStore, logger *slog.Logger) *ExportHandler {
+	return &ExportHandler{
+		workoutStore: workoutStore,
+		logger:       logger,
+	}
+}
+
+// HandleExport streams the current user's training log as csv (one row per
+// entry), json or ndjson (one workout per line), optionally limited to the
+// from/to date range. Each workout is flushed to the client as soon as it is
+// written, and the server's write timeout does not apply.
+func (h *ExportHandler) HandleExport(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = ExportCSV
+	}
+
+	var contentType string
+	switch format {
+	case ExportCSV:
+		contentType = "text/csv"
+	case ExportJSON:
+		contentType = "application/json"
+	case ExportNDJSON:
+		contentType = "application/x-ndjson"
+	default:
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "format must be csv, json or ndjson"})
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+	filter := store.WorkoutFilter{UserID: currentUser.ID}
+
+	var err error
+	if filter.From, err = utils.ReadTimeQuery(r, "from"); err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+	if filter.To, err = utils.ReadTimeQuery(r, "to"); err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	rc := http.NewResponseController(w)
+	// a long history can take more than server.write_timeout to stream
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		h.logger.WarnContext(r.Context(), "clearing export write deadline", "error", err)
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="workouts-%s.%s"`, time.Now().Format("20060102"), format))
+	w.WriteHeader(http.StatusOK)
+
+	var write func(*store.Workout) error
+	var finish func() error
+
+	switch format {
+	case ExportCSV:
+		cw := csv.NewWriter(w)
+		err = cw.Write(exportCSVHeader)
+		write = func(workout *store.Workout) error {
+			for _, row := range workoutCSVRows(workout) {
+				if err := cw.Write(row); err != nil {
+					return err
+				}
+			}
+			cw.Flush()
+			return cw.Error()
+		}
+		finish = func() error { return nil }
+	case ExportJSON:
+		first := true
+		_, err = w.Write([]byte(`{"workouts":[`))
+		write = func(workout *store.Workout) error {
+			if !first {
+				if _, err := w.Write([]byte(",\n")); err != nil {
+					return err
+				}
+			}
+			first = false
+			return json.NewEncoder(w).Encode(workout)
+		}
+		finish = func() error {
+			_, err := w.Write([]byte("]}\n"))
+			return err
+		}
+	case ExportNDJSON:
+		encoder := json.NewEncoder(w)
+		write = func(workout *store.Workout) error { return encoder.Encode(workout) }
+		finish = func() error { return nil }
+	}
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "writing export header", "error", err)
+		return
+	}
+
+	err = h.workoutStore.StreamWorkouts(r.Context(), filter, func(workout *store.Workout) error {
+		if err := write(workout); err != nil {
+			return err
+		}
+		return rc.Flush()
+	})
+	if err != nil {
+		// the status line is already sent, so all we can do is cut the response short
+		h.logger.ErrorContext(r.Context(), "streamWorkouts", "error", err)
+		return
+	}
+
+	err = finish()
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "finishing export", "error", err)
+	}
+}
+
+// workoutCSVRows flattens a workout into one CSV row per entry, or a single row
+// with empty entry columns when it has none.
+func workoutCSVRows(workout *store.Workout) [][]string {
+	base := []string{
+		strconv.Itoa(workout.ID),
+		workout.CreatedAt.Format(time.RFC3339),
+		workout.Title,
+		workout.Description,
+		strconv.Itoa(workout.DurationMinutes),
+		strconv.Itoa(workout.CaloriesBurned),
+	}
+	if len(workout.Entries) == 0 {
+		return [][]string{append(base, make([]string, len(exportCSVHeader)-len(base))...)}
+	}
+
+	rows := make([][]string, 0, len(workout.Entries))
+	for _, entry := range workout.Entries {
+		row := append([]string{}, base...)
+		row = append(row,
+			strconv.Itoa(entry.ID),
+			formatOptionalInt(entry.ExerciseID),
+			entry.ExerciseName,
+			strconv.Itoa(entry.Sets),
+			formatOptionalInt(entry.Reps),
+			formatOptionalInt(entry.DurationSeconds),
+			formatOptionalFloat(entry.Weight),
+			formatOptionalFloat(entry.RPE),
+			entry.Notes,
+			strconv.Itoa(entry.OrderIndex),
+		)
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+func formatOptionalInt(v *int) string {
+	if v == nil {
+		return ""
+	}
+	return strconv.Itoa(*v)
+}
+
+func formatOptionalFloat(v *float64) string {
+	if v == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*v, 'f', -1, 64)
+}
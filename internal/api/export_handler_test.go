@@ -0,0 +1,129 @@
+package api
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dapoadedire/fem_project/internal/middleware"
+	"github.com/dapoadedire/fem_project/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeWorkoutStore struct {
+	store.WorkoutStore
+	workouts []*store.Workout
+	// delay is slept before each workout is streamed
+	delay   time.Duration
+	created []*store.Workout
+	updated []*store.Workout
+}
+
+func (s *fakeWorkoutStore) StreamWorkouts(ctx context.Context, filter store.WorkoutFilter, fn func(*store.Workout) error) error {
+	for _, workout := range s.workouts {
+		time.Sleep(s.delay)
+		if err := fn(workout); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func floatPtr(f float64) *float64 {
+	return &f
+}
+
+func exportWorkouts() []*store.Workout {
+	created := time.Date(2024, 3, 1, 18, 30, 0, 0, time.UTC)
+	return []*store.Workout{
+		{
+			ID: 1, UserID: 1, Title: "Legs, heavy", Description: `said "ouch"`, DurationMinutes: 60, CaloriesBurned: 400, CreatedAt: created,
+			Entries: []store.WorkoutEntry{
+				{ID: 10, ExerciseID: intPtr(3), ExerciseName: "Squat", Sets: 5, Reps: intPtr(5), Weight: floatPtr(102.5), RPE: floatPtr(8.5), OrderIndex: 1},
+				{ID: 11, ExerciseName: "Plank", Sets: 3, DurationSeconds: intPtr(60), Notes: "line one\nline two", OrderIndex: 2},
+			},
+		},
+		{ID: 2, UserID: 1, Title: "Rest day walk", DurationMinutes: 30, CreatedAt: created.Add(24 * time.Hour)},
+	}
+}
+
+func export(t *testing.T, h *ExportHandler, format string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/users/me/export?format="+format, nil)
+	req = middleware.SetUser(req, &store.User{ID: 1})
+	res := httptest.NewRecorder()
+	h.HandleExport(res, req)
+	require.Equal(t, http.StatusOK, res.Code, res.Body.String())
+	return res
+}
+
+func TestExportCSV(t *testing.T) {
+	h := NewExportHandler(&fakeWorkoutStore{workouts: exportWorkouts()}, discardLogger)
+	res := export(t, h, ExportCSV)
+	assert.Equal(t, "text/csv", res.Header().Get("Content-Type"))
+
+	rows, err := csv.NewReader(res.Body).ReadAll()
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{
+		exportCSVHeader,
+		{"1", "2024-03-01T18:30:00Z", "Legs, heavy", `said "ouch"`, "60", "400", "10", "3", "Squat", "5", "5", "", "102.5", "8.5", "", "1"},
+		{"1", "2024-03-01T18:30:00Z", "Legs, heavy", `said "ouch"`, "60", "400", "11", "", "Plank", "3", "", "60", "", "", "line one\nline two", "2"},
+		// a workout without entries still gets a row
+		{"2", "2024-03-02T18:30:00Z", "Rest day walk", "", "30", "0", "", "", "", "", "", "", "", "", "", ""},
+	}, rows)
+}
+
+func TestExportNDJSON(t *testing.T) {
+	h := NewExportHandler(&fakeWorkoutStore{workouts: exportWorkouts()}, discardLogger)
+	res := export(t, h, ExportNDJSON)
+	assert.Equal(t, "application/x-ndjson", res.Header().Get("Content-Type"))
+
+	lines := strings.Split(strings.TrimSuffix(res.Body.String(), "\n"), "\n")
+	require.Len(t, lines, 2)
+	var workout store.Workout
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &workout))
+	assert.Equal(t, "Legs, heavy", workout.Title)
+	require.Len(t, workout.Entries, 2)
+	assert.Equal(t, 102.5, *workout.Entries[0].Weight)
+	assert.Equal(t, "line one\nline two", workout.Entries[1].Notes)
+}
+
+func TestExportJSON(t *testing.T) {
+	for _, workouts := range [][]*store.Workout{exportWorkouts(), nil} {
+		h := NewExportHandler(&fakeWorkoutStore{workouts: workouts}, discardLogger)
+		res := export(t, h, ExportJSON)
+
+		var body struct {
+			Workouts []store.Workout `json:"workouts"`
+		}
+		require.NoError(t, json.Unmarshal(res.Body.Bytes(), &body), res.Body.String())
+		assert.Len(t, body.Workouts, len(workouts))
+	}
+}
+
+func TestExportOutlastsWriteTimeout(t *testing.T) {
+	workouts := exportWorkouts()
+	workouts = append(workouts, workouts...)
+	h := NewExportHandler(&fakeWorkoutStore{workouts: workouts, delay: 50 * time.Millisecond}, discardLogger)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.HandleExport(w, middleware.SetUser(r, &store.User{ID: 1}))
+	}))
+	server.Config.WriteTimeout = 100 * time.Millisecond
+	server.Start()
+	defer server.Close()
+
+	res, err := http.Get(server.URL + "?format=ndjson")
+	require.NoError(t, err)
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	assert.Equal(t, len(workouts), strings.Count(string(body), "\n"))
+}
@@ -0,0 +1,44 @@
+package api
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/dapoadedire/fem_project/internal/health"
+	"github.com/dapoadedire/fem_project/internal/utils"
+)
+
+type HealthHandler struct {
+	registry *health.Registry
+	draining func() bool
+}
+
+// NewHealthHandler reports readiness from the checks in registry, and as not
+// ready at all once draining returns true.
+func NewHealthHandler(registry *health.Registry, draining func() bool) *HealthHandler {
+	return &HealthHandler{
+		registry: registry,
+		draining: draining,
+	}
+}
+
+// HandleLive only tells whether the process can serve requests at all; it
+// never looks at dependencies so an outage does not get the process restarted.
+func (h *HealthHandler) HandleLive(w http.ResponseWriter, r *http.Request) {
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"status": health.StatusOK})
+}
+
+func (h *HealthHandler) HandleReady(w http.ResponseWriter, r *http.Request) {
+	if h.draining() {
+		utils.WriteJSON(w, http.StatusServiceUnavailable, utils.Envelope{"status": "draining", "checks": []health.Result{}})
+		return
+	}
+
+	// results are cached for other callers, so a client hanging up must not cut them short
+	report := h.registry.Run(context.WithoutCancel(r.Context()))
+	status := http.StatusOK
+	if !report.Healthy() {
+		status = http.StatusServiceUnavailable
+	}
+	utils.WriteJSON(w, status, utils.Envelope{"status": report.Status, "checks": report.Checks})
+}
@@ -0,0 +1,157 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dapoadedire/fem_project/internal/importer"
+	"github.com/dapoadedire/fem_project/internal/middleware"
+	"github.com/dapoadedire/fem_project/internal/store"
+	"github.com/dapoadedire/fem_project/internal/utils"
+)
+
+const (
+	maxImportSize          = 10 << 20
+	defaultImportChunkSize = 100
+)
+
+type ImportHandler struct {
+	workoutStore store.WorkoutStore
+	logger       *slog.Logger
+}
+
+func NewImportHandler(workoutStore store.WorkoutStore, logger *slog.Logger) *ImportHandler {
+	return &ImportHandler{
+		workoutStore: workoutStore,
+		logger:       logger,
+	}
+}
+
+// HandleImport creates workouts from a CSV file, sent either as the request
+// body or as the "file" part of a multipart form. Options come from the query
+// string or the form:
+//
+//   - preset: the column mapping to start from, one of importer.PresetNames
+//     (default native, the format written by the export)
+//   - mapping: a JSON importer.Mapping whose fields override the preset's
+//   - mode: atomic (default) imports nothing unless every row is valid; chunked
+//     commits chunk_size workouts at a time and skips the invalid ones
+//   - tz: the IANA zone of dates that carry no offset (default UTC)
+//
+// The response reports the created workout IDs and an error for each rejected
+// row, numbered by line in the file.
+func (h *ImportHandler) HandleImport(w http.ResponseWriter, r *http.Request) {
+	location, ok := readLocation(w, r)
+	if !ok {
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+	var body io.Reader = r.Body
+	// a raw body is never parsed as a form, whatever its content type claims
+	option := r.URL.Query().Get
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "the file form field is required"})
+			return
+		}
+		defer file.Close()
+		body = file
+		option = r.FormValue
+	}
+
+	presetName := option("preset")
+	if presetName == "" {
+		presetName = importer.PresetNative
+	}
+	mapping, ok := importer.Preset(presetName)
+	if !ok {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "unknown preset", "presets": importer.PresetNames()})
+		return
+	}
+	if raw := option("mapping"); raw != "" {
+		// only the fields present in the JSON replace the preset's
+		err := json.Unmarshal([]byte(raw), &mapping)
+		if err != nil {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "mapping must be a JSON object"})
+			return
+		}
+	}
+
+	chunkSize := 0
+	switch option("mode") {
+	case "", "atomic":
+	case "chunked":
+		chunkSize = defaultImportChunkSize
+		if raw := option("chunk_size"); raw != "" {
+			size, err := strconv.Atoi(raw)
+			if err != nil || size < 1 {
+				utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "chunk_size must be a positive integer"})
+				return
+			}
+			chunkSize = size
+		}
+	default:
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "mode must be atomic or chunked"})
+		return
+	}
+
+	groups, rowErrors, err := importer.Parse(body, mapping, location)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+	if chunkSize == 0 && len(rowErrors) > 0 {
+		utils.WriteJSON(w, http.StatusUnprocessableEntity, utils.Envelope{"imported": 0, "workout_ids": []int{}, "errors": rowErrors})
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+	workouts := make([]*store.Workout, len(groups))
+	for i, group := range groups {
+		group.Workout.UserID = currentUser.ID
+		workouts[i] = &group.Workout
+	}
+
+	// a large import can take more than server.write_timeout to save, and the
+	// report must still reach the client; the store bounds how long it runs
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		h.logger.WarnContext(r.Context(), "clearing import write deadline", "error", err)
+	}
+
+	failures, err := h.workoutStore.ImportWorkouts(r.Context(), workouts, chunkSize)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "importWorkouts", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	workoutIDs := []int{}
+	for i, failure := range failures {
+		if failure == nil {
+			if workouts[i].ID != 0 {
+				workoutIDs = append(workoutIDs, workouts[i].ID)
+			}
+			continue
+		}
+		message := failure.Error()
+		if !isInvalidWorkoutError(failure) {
+			h.logger.ErrorContext(r.Context(), "importWorkout", "error", failure)
+			message = "the workout could not be saved"
+		}
+		rowErrors = append(rowErrors, importer.RowError{Row: groups[i].Rows[0], Error: message})
+	}
+
+	status := http.StatusCreated
+	if chunkSize == 0 && len(rowErrors) > 0 {
+		status = http.StatusUnprocessableEntity
+	}
+	utils.WriteJSON(w, status, utils.Envelope{"imported": len(workoutIDs), "workout_ids": workoutIDs, "errors": rowErrors})
+}
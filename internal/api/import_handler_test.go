@@ -0,0 +1,49 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dapoadedire/fem_project/internal/middleware"
+	"github.com/dapoadedire/fem_project/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func (s *fakeWorkoutStore) ImportWorkouts(ctx context.Context, workouts []*store.Workout, chunkSize int) ([]error, error) {
+	time.Sleep(s.delay)
+	for i, workout := range workouts {
+		workout.ID = i + 1
+	}
+	return make([]error, len(workouts)), nil
+}
+
+func TestImportOutlastsWriteTimeout(t *testing.T) {
+	h := NewImportHandler(&fakeWorkoutStore{delay: 200 * time.Millisecond}, discardLogger)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.HandleImport(w, middleware.SetUser(r, &store.User{ID: 1}))
+	}))
+	server.Config.WriteTimeout = 100 * time.Millisecond
+	server.Start()
+	defer server.Close()
+
+	csv := `workout_id,workout_date,title,description,duration_minutes,calories_burned,entry_id,exercise_id,exercise_name,sets,reps,duration_seconds,weight,rpe,notes,order_index
+8,2024-03-02T10:00:00Z,Legs,,60,0,11,,Squat,5,5,,100,,,1
+`
+	res, err := http.Post(server.URL, "text/csv", strings.NewReader(csv))
+	require.NoError(t, err)
+	defer res.Body.Close()
+	assert.Equal(t, http.StatusCreated, res.StatusCode)
+
+	var report struct {
+		WorkoutIDs []int `json:"workout_ids"`
+	}
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&report))
+	assert.Equal(t, []int{1}, report.WorkoutIDs)
+}
@@ -0,0 +1,175 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/dapoadedire/fem_project/internal/mailer"
+	"github.com/dapoadedire/fem_project/internal/store"
+	"github.com/dapoadedire/fem_project/internal/tokens"
+	"github.com/dapoadedire/fem_project/internal/utils"
+)
+
+type requestPasswordResetRequest struct {
+	Email string `json:"email"`
+}
+
+type resetPasswordRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+type PasswordResetHandler struct {
+	userStore  store.UserStore
+	tokenStore store.TokenStore
+	mailer     mailer.Mailer
+	resetTTL   time.Duration
+	bcryptCost int
+	logger     *slog.Logger
+	background background
+}
+
+func NewPasswordResetHandler(userStore store.UserStore, tokenStore store.TokenStore, m mailer.Mailer, resetTTL time.Duration, bcryptCost int, logger *slog.Logger) *PasswordResetHandler {
+	return &PasswordResetHandler{
+		userStore:  userStore,
+		tokenStore: tokenStore,
+		mailer:     m,
+		resetTTL:   resetTTL,
+		bcryptCost: bcryptCost,
+		logger:     logger,
+	}
+}
+
+// HandleRequestPasswordReset mails a password reset token to the account with
+// the given address. The response is the same whether there is such an
+// account or not, so it cannot be used to find out who is registered: the
+// email is sent in the background and failures are only logged.
+func (h *PasswordResetHandler) HandleRequestPasswordReset(w http.ResponseWriter, r *http.Request) {
+	var req requestPasswordResetRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "decodingRequestPasswordReset", "error", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request sent"})
+		return
+	}
+	req.Email = strings.TrimSpace(req.Email)
+	if _, err := mail.ParseAddress(req.Email); err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid email address"})
+		return
+	}
+
+	user, err := h.userStore.GetUserByEmail(r.Context(), req.Email)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "getUserByEmail", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	if user != nil {
+		h.background.run(r, h.logger, "sending password reset email", func(ctx context.Context) error {
+			return h.sendResetEmail(ctx, user)
+		})
+	}
+
+	utils.WriteJSON(w, http.StatusAccepted, utils.Envelope{"message": "if an account with this email exists, a password reset email has been sent"})
+}
+
+// sendResetEmail mails the user a fresh password reset token. Only the latest
+// one works.
+func (h *PasswordResetHandler) sendResetEmail(ctx context.Context, user *store.User) error {
+	err := h.tokenStore.DeleteAllTokensForUser(ctx, user.ID, tokens.ScopePasswordReset)
+	if err != nil {
+		return err
+	}
+	token, err := h.tokenStore.CreateNewToken(ctx, user.ID, h.resetTTL, tokens.ScopePasswordReset)
+	if err != nil {
+		return err
+	}
+
+	msg, err := mailer.NewMessage(user.Email, "password_reset.tmpl", map[string]interface{}{
+		"Username": user.Username,
+		"Token":    token.PlainText,
+		"TTL":      h.resetTTL,
+	})
+	if err != nil {
+		return err
+	}
+	return h.mailer.Send(ctx, msg)
+}
+
+// Wait blocks until the password reset emails being sent have gone out.
+func (h *PasswordResetHandler) Wait() {
+	h.background.wait()
+}
+
+// HandleResetPassword sets a new password with a token from
+// HandleRequestPasswordReset and logs the user out everywhere.
+func (h *PasswordResetHandler) HandleResetPassword(w http.ResponseWriter, r *http.Request) {
+	var req resetPasswordRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "decodingResetPassword", "error", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request sent"})
+		return
+	}
+	if req.Token == "" {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "token is required"})
+		return
+	}
+	err = validatePassword(req.Password)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	user, err := h.userStore.GetUserToken(r.Context(), tokens.ScopePasswordReset, req.Token)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "getUserToken", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	if user == nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid or expired password reset token"})
+		return
+	}
+
+	// the token is spent before anything else, so that it cannot be
+	// replayed if a later step fails
+	err = h.tokenStore.DeleteAllTokensForUser(r.Context(), user.ID, tokens.ScopePasswordReset)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "deleteAllTokensForUser", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	err = user.PasswordHash.SetPasswordWithCost(req.Password, h.bcryptCost)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "setting password hash", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	err = h.userStore.UpdateUser(r.Context(), user)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "updateUser", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	// whoever may have had the old password loses every session they made
+	// with it
+	for _, scope := range []string{tokens.ScopeAuth, tokens.ScopeRefresh, tokens.Scope2FAPending} {
+		err = h.tokenStore.DeleteAllTokensForUser(r.Context(), user.ID, scope)
+		if err != nil {
+			h.logger.ErrorContext(r.Context(), "deleteAllTokensForUser", "error", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+			return
+		}
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"message": "password reset successfully"})
+}
@@ -0,0 +1,84 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dapoadedire/fem_project/internal/mailer"
+	"github.com/dapoadedire/fem_project/internal/tokens"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type failingMailer struct{}
+
+func (failingMailer) Send(ctx context.Context, msg mailer.Message) error {
+	return errors.New("smtp: connection refused")
+}
+
+func TestRequestPasswordReset(t *testing.T) {
+	tests := []struct {
+		name   string
+		email  string
+		mailer mailer.Mailer
+		sent   int
+	}{
+		{"registered address", "Alice@Example.com", mailer.NewMemory(), 1},
+		{"unknown address", "bob@example.com", mailer.NewMemory(), 0},
+		{"failing delivery", "alice@example.com", failingMailer{}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			userStore := &fakeUserStore{user: newTestUser(t)}
+			tokenStore := &fakeTokenStore{}
+			h := NewPasswordResetHandler(userStore, tokenStore, tt.mailer, time.Hour, bcrypt.MinCost, discardLogger)
+
+			req := httptest.NewRequest(http.MethodPost, "/password-reset", strings.NewReader(`{"email": "`+tt.email+`"}`))
+			res := httptest.NewRecorder()
+			h.HandleRequestPasswordReset(res, req)
+			h.Wait()
+
+			// every address gets the same answer
+			assert.Equal(t, http.StatusAccepted, res.Code)
+			if m, ok := tt.mailer.(*mailer.MemoryMailer); ok {
+				assert.Len(t, m.Messages(), tt.sent)
+			}
+		})
+	}
+}
+
+func TestResetPassword(t *testing.T) {
+	t.Run("spends the token before updating the password", func(t *testing.T) {
+		userStore := &fakeUserStore{user: newTestUser(t), updateErr: errors.New("connection reset")}
+		tokenStore := &fakeTokenStore{}
+		h := NewPasswordResetHandler(userStore, tokenStore, mailer.NewMemory(), time.Hour, bcrypt.MinCost, discardLogger)
+
+		req := httptest.NewRequest(http.MethodPut, "/password-reset", strings.NewReader(`{"token": "token", "password": "new password"}`))
+		res := httptest.NewRecorder()
+		h.HandleResetPassword(res, req)
+		assert.Equal(t, http.StatusInternalServerError, res.Code)
+		assert.Equal(t, []string{tokens.ScopePasswordReset}, tokenStore.revoked)
+	})
+
+	t.Run("logs the user out everywhere", func(t *testing.T) {
+		userStore := &fakeUserStore{user: newTestUser(t)}
+		tokenStore := &fakeTokenStore{}
+		h := NewPasswordResetHandler(userStore, tokenStore, mailer.NewMemory(), time.Hour, bcrypt.MinCost, discardLogger)
+
+		req := httptest.NewRequest(http.MethodPut, "/password-reset", strings.NewReader(`{"token": "token", "password": "new password"}`))
+		res := httptest.NewRecorder()
+		h.HandleResetPassword(res, req)
+		require.Equal(t, http.StatusOK, res.Code, res.Body.String())
+		require.Len(t, userStore.updated, 1)
+		matches, err := userStore.updated[0].PasswordHash.Matches("new password")
+		require.NoError(t, err)
+		assert.True(t, matches)
+		assert.Equal(t, []string{tokens.ScopePasswordReset, tokens.ScopeAuth, tokens.ScopeRefresh, tokens.Scope2FAPending}, tokenStore.revoked)
+	})
+}
@@ -0,0 +1,35 @@
+package api
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/dapoadedire/fem_project/internal/middleware"
+	"github.com/dapoadedire/fem_project/internal/store"
+	"github.com/dapoadedire/fem_project/internal/utils"
+)
+
+type PersonalRecordHandler struct {
+	recordStore store.PersonalRecordStore
+	logger      *slog.Logger
+}
+
+func NewPersonalRecordHandler(recordStore store.PersonalRecordStore, logger *slog.Logger) *PersonalRecordHandler {
+	return &PersonalRecordHandler{
+		recordStore: recordStore,
+		logger:      logger,
+	}
+}
+
+func (h *PersonalRecordHandler) HandleListMyRecords(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+
+	records, err := h.recordStore.ListPersonalRecords(r.Context(), currentUser.ID, r.URL.Query().Get("exercise"))
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "listPersonalRecords", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"records": records})
+}
@@ -0,0 +1,357 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dapoadedire/fem_project/internal/middleware"
+	"github.com/dapoadedire/fem_project/internal/store"
+	"github.com/dapoadedire/fem_project/internal/utils"
+)
+
+type createProgramRequest struct {
+	Name        string             `json:"name"`
+	Description string             `json:"description"`
+	Weeks       int                `json:"weeks"`
+	Days        []store.ProgramDay `json:"days"`
+}
+
+type enrollRequest struct {
+	StartDate string `json:"start_date"`
+}
+
+type ProgramHandler struct {
+	programStore  store.ProgramStore
+	templateStore store.TemplateStore
+	logger        *slog.Logger
+}
+
+func NewProgramHandler(programStore store.ProgramStore, templateStore store.TemplateStore, logger *slog.Logger) *ProgramHandler {
+	return &ProgramHandler{
+		programStore:  programStore,
+		templateStore: templateStore,
+		logger:        logger,
+	}
+}
+
+// invalidProgramError describes what is wrong with a createProgramRequest.
+// Other errors from validateCreateProgramRequest are failures to check it.
+type invalidProgramError string
+
+func (e invalidProgramError) Error() string {
+	return string(e)
+}
+
+func (h *ProgramHandler) validateCreateProgramRequest(ctx context.Context, req *createProgramRequest, userID int) error {
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		return invalidProgramError("name is required")
+	}
+	if req.Weeks < 1 {
+		return invalidProgramError("weeks must be at least 1")
+	}
+
+	seen := map[[2]int]bool{}
+	for _, day := range req.Days {
+		if day.WeekNumber < 1 || day.WeekNumber > req.Weeks {
+			return invalidProgramError(fmt.Sprintf("week_number must be between 1 and %d", req.Weeks))
+		}
+		if day.DayNumber < 1 || day.DayNumber > 7 {
+			return invalidProgramError("day_number must be between 1 and 7")
+		}
+		key := [2]int{day.WeekNumber, day.DayNumber}
+		if seen[key] {
+			return invalidProgramError(fmt.Sprintf("week %d day %d is scheduled more than once", day.WeekNumber, day.DayNumber))
+		}
+		seen[key] = true
+
+		if day.TemplateID == nil {
+			continue
+		}
+		template, err := h.templateStore.GetTemplateByID(ctx, int64(*day.TemplateID))
+		if err != nil {
+			return err
+		}
+		if template == nil || template.UserID != userID {
+			return invalidProgramError(fmt.Sprintf("template %d not found", *day.TemplateID))
+		}
+	}
+	return nil
+}
+
+func (h *ProgramHandler) HandleListPrograms(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+
+	programs, err := h.programStore.ListPrograms(r.Context(), currentUser.ID)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "listPrograms", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"programs": programs})
+}
+
+func (h *ProgramHandler) HandleGetProgramByID(w http.ResponseWriter, r *http.Request) {
+	program, ok := h.readOwnedProgram(w, r)
+	if !ok {
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"program": program})
+}
+
+func (h *ProgramHandler) HandleCreateProgram(w http.ResponseWriter, r *http.Request) {
+	var req createProgramRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "decodingCreateProgram", "error", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request sent"})
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+	err = h.validateCreateProgramRequest(r.Context(), &req, currentUser.ID)
+	var invalid invalidProgramError
+	if errors.As(err, &invalid) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": invalid.Error()})
+		return
+	}
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "validateCreateProgramRequest", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	program := &store.Program{
+		UserID:      currentUser.ID,
+		Name:        req.Name,
+		Description: req.Description,
+		Weeks:       req.Weeks,
+		Days:        req.Days,
+	}
+	if program.Days == nil {
+		program.Days = []store.ProgramDay{}
+	}
+
+	createdProgram, err := h.programStore.CreateProgram(r.Context(), program)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "createProgram", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"program": createdProgram})
+}
+
+func (h *ProgramHandler) HandleDeleteProgram(w http.ResponseWriter, r *http.Request) {
+	program, ok := h.readOwnedProgram(w, r)
+	if !ok {
+		return
+	}
+
+	err := h.programStore.DeleteProgram(r.Context(), int64(program.ID))
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "program not found"})
+		return
+	}
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "deleteProgram", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusNoContent, utils.Envelope{"message": "program deleted successfully"})
+}
+
+// HandleEnroll makes the program the current user's active one, replacing any
+// other enrollment. The start date defaults to today in the time zone given
+// by the tz query parameter.
+func (h *ProgramHandler) HandleEnroll(w http.ResponseWriter, r *http.Request) {
+	program, ok := h.readOwnedProgram(w, r)
+	if !ok {
+		return
+	}
+
+	var req enrollRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil && !errors.Is(err, io.EOF) {
+		h.logger.ErrorContext(r.Context(), "decodingEnroll", "error", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request sent"})
+		return
+	}
+	if req.StartDate == "" {
+		today, ok := readToday(w, r)
+		if !ok {
+			return
+		}
+		req.StartDate = today
+	}
+	if _, err := time.Parse(time.DateOnly, req.StartDate); err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "start_date must be a YYYY-MM-DD date"})
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+	enrollment := &store.Enrollment{
+		UserID:    currentUser.ID,
+		ProgramID: program.ID,
+		StartDate: req.StartDate,
+	}
+	err = h.programStore.Enroll(r.Context(), enrollment)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "enroll", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"enrollment": enrollment})
+}
+
+// HandleGetSchedule lays the program out on the calendar of the user's latest
+// enrollment in it, with completion status and adherence so far.
+func (h *ProgramHandler) HandleGetSchedule(w http.ResponseWriter, r *http.Request) {
+	program, ok := h.readOwnedProgram(w, r)
+	if !ok {
+		return
+	}
+	today, ok := readToday(w, r)
+	if !ok {
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+	enrollment, err := h.programStore.GetLatestEnrollment(r.Context(), currentUser.ID, program.ID)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "getLatestEnrollment", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	completed := map[int]int{}
+	if enrollment != nil {
+		completed, err = h.programStore.GetCompletedDays(r.Context(), enrollment.ID)
+		if err != nil {
+			h.logger.ErrorContext(r.Context(), "getCompletedDays", "error", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+			return
+		}
+	}
+
+	schedule, err := store.BuildSchedule(program, enrollment, completed, today)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "buildSchedule", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"schedule": schedule})
+}
+
+// HandleGetToday resolves which session of the user's active program is due
+// today. The session is null on rest days and outside the program's weeks.
+func (h *ProgramHandler) HandleGetToday(w http.ResponseWriter, r *http.Request) {
+	today, ok := readToday(w, r)
+	if !ok {
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+	enrollment, err := h.programStore.GetActiveEnrollment(r.Context(), currentUser.ID)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "getActiveEnrollment", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	if enrollment == nil {
+		utils.WriteJSON(w, http.StatusOK, utils.Envelope{"date": today, "enrollment": nil, "session": nil})
+		return
+	}
+
+	program, err := h.programStore.GetProgramByID(r.Context(), int64(enrollment.ProgramID))
+	if err != nil || program == nil {
+		h.logger.ErrorContext(r.Context(), "getProgramByID", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	index, err := enrollment.DayIndex(today)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "dayIndex", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	response := utils.Envelope{"date": today, "enrollment": enrollment, "program": program.Name, "session": nil}
+	day := program.FindDay(index)
+	if day == nil {
+		utils.WriteJSON(w, http.StatusOK, response)
+		return
+	}
+
+	session := utils.Envelope{"program_day": day, "template": nil, "workout_id": nil}
+	if day.TemplateID != nil {
+		template, err := h.templateStore.GetTemplateByID(r.Context(), int64(*day.TemplateID))
+		if err != nil {
+			h.logger.ErrorContext(r.Context(), "getTemplateByID", "error", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+			return
+		}
+		session["template"] = template
+	}
+
+	completed, err := h.programStore.GetCompletedDays(r.Context(), enrollment.ID)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "getCompletedDays", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	if workoutID, ok := completed[day.ID]; ok {
+		session["workout_id"] = workoutID
+	}
+
+	response["session"] = session
+	utils.WriteJSON(w, http.StatusOK, response)
+}
+
+// readOwnedProgram loads the program named by the id URL parameter, writing
+// an error response and returning false unless it belongs to the current user.
+func (h *ProgramHandler) readOwnedProgram(w http.ResponseWriter, r *http.Request) (*store.Program, bool) {
+	programID, err := utils.ReadIDParam(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid program ID"})
+		return nil, false
+	}
+
+	program, err := h.programStore.GetProgramByID(r.Context(), programID)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "getProgramByID", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return nil, false
+	}
+
+	currentUser := middleware.GetUser(r)
+	if program == nil || program.UserID != currentUser.ID {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "program not found"})
+		return nil, false
+	}
+
+	return program, true
+}
+
+// readToday returns today's date (YYYY-MM-DD) in the time zone given by the tz
+// query parameter.
+func readToday(w http.ResponseWriter, r *http.Request) (string, bool) {
+	location, ok := readLocation(w, r)
+	if !ok {
+		return "", false
+	}
+	return time.Now().In(location).Format(time.DateOnly), true
+}
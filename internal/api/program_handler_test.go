@@ -0,0 +1,93 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dapoadedire/fem_project/internal/middleware"
+	"github.com/dapoadedire/fem_project/internal/store"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeProgramStore struct {
+	store.ProgramStore
+	created     []*store.Program
+	enrollments []*store.Enrollment
+}
+
+func (s *fakeProgramStore) CreateProgram(ctx context.Context, program *store.Program) (*store.Program, error) {
+	s.created = append(s.created, program)
+	return program, nil
+}
+
+func (s *fakeProgramStore) GetProgramByID(ctx context.Context, id int64) (*store.Program, error) {
+	return &store.Program{ID: int(id), UserID: 1, Weeks: 4}, nil
+}
+
+func (s *fakeProgramStore) Enroll(ctx context.Context, enrollment *store.Enrollment) error {
+	s.enrollments = append(s.enrollments, enrollment)
+	return nil
+}
+
+func TestCreateProgramValidation(t *testing.T) {
+	templates := []*store.WorkoutTemplate{{ID: 1, UserID: 1}, {ID: 2, UserID: 2}}
+	tests := []struct {
+		name   string
+		body   string
+		getErr error
+		code   int
+	}{
+		{"valid", `{"name": "5x5", "weeks": 4, "days": [{"week_number": 1, "day_number": 1, "template_id": 1}]}`, nil, http.StatusCreated},
+		{"missing name", `{"weeks": 4}`, nil, http.StatusBadRequest},
+		{"week out of range", `{"name": "5x5", "weeks": 4, "days": [{"week_number": 5, "day_number": 1}]}`, nil, http.StatusBadRequest},
+		{"another user's template", `{"name": "5x5", "weeks": 4, "days": [{"week_number": 1, "day_number": 1, "template_id": 2}]}`, nil, http.StatusBadRequest},
+		{"store failure", `{"name": "5x5", "weeks": 4, "days": [{"week_number": 1, "day_number": 1, "template_id": 1}]}`, errors.New("connection reset"), http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			programStore := &fakeProgramStore{}
+			h := NewProgramHandler(programStore, &fakeTemplateStore{templates: templates, getErr: tt.getErr}, discardLogger)
+
+			req := httptest.NewRequest(http.MethodPost, "/programs", strings.NewReader(tt.body))
+			req = middleware.SetUser(req, &store.User{ID: 1})
+			res := httptest.NewRecorder()
+			h.HandleCreateProgram(res, req)
+			assert.Equal(t, tt.code, res.Code, res.Body.String())
+			// store errors are not shown to the client
+			assert.NotContains(t, res.Body.String(), "connection reset")
+			if tt.code != http.StatusCreated {
+				assert.Empty(t, programStore.created)
+			}
+		})
+	}
+}
+
+func TestEnrollDefaultsToTodayInTimeZone(t *testing.T) {
+	for _, tz := range []string{"Pacific/Kiritimati", "Pacific/Pago_Pago"} {
+		t.Run(tz, func(t *testing.T) {
+			programStore := &fakeProgramStore{}
+			h := NewProgramHandler(programStore, &fakeTemplateStore{}, discardLogger)
+
+			req := httptest.NewRequest(http.MethodPost, "/programs/1/enroll?tz="+tz, nil)
+			routeContext := chi.NewRouteContext()
+			routeContext.URLParams.Add("id", "1")
+			req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, routeContext))
+			req = middleware.SetUser(req, &store.User{ID: 1})
+			res := httptest.NewRecorder()
+			h.HandleEnroll(res, req)
+			require.Equal(t, http.StatusCreated, res.Code, res.Body.String())
+
+			location, err := time.LoadLocation(tz)
+			require.NoError(t, err)
+			require.Len(t, programStore.enrollments, 1)
+			assert.Equal(t, time.Now().In(location).Format(time.DateOnly), programStore.enrollments[0].StartDate)
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package api
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/dapoadedire/fem_project/internal/middleware"
+	"github.com/dapoadedire/fem_project/internal/progression"
+	"github.com/dapoadedire/fem_project/internal/store"
+	"github.com/dapoadedire/fem_project/internal/utils"
+)
+
+// progressionHistoryLength is how many past sessions the rules look at.
+const progressionHistoryLength = 10
+
+type ProgressionHandler struct {
+	progressionStore store.ProgressionStore
+	logger           *slog.Logger
+}
+
+func NewProgressionHandler(progressionStore store.ProgressionStore, logger *slog.Logger) *ProgressionHandler {
+	return &ProgressionHandler{
+		progressionStore: progressionStore,
+		logger:           logger,
+	}
+}
+
+// HandleGetNextSession suggests the sets, reps and weight for the next session
+// of the exercise using the user's configured rule, or the one named by the
+// rule query parameter.
+func (h *ProgressionHandler) HandleGetNextSession(w http.ResponseWriter, r *http.Request) {
+	exercise, err := utils.ReadPathParam(r, "name")
+	if err != nil || strings.TrimSpace(exercise) == "" {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid exercise name"})
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+	cfg, err := h.progressionStore.GetProgressionConfig(r.Context(), currentUser.ID, exercise)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "getProgressionConfig", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	if ruleName := r.URL.Query().Get("rule"); ruleName != "" {
+		cfg.Rule = ruleName
+	}
+
+	rule, ok := progression.Lookup(cfg.Rule)
+	if !ok {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "unknown progression rule", "rules": progression.RuleNames()})
+		return
+	}
+
+	history, err := h.progressionStore.GetExerciseHistory(r.Context(), currentUser.ID, exercise, progressionHistoryLength)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "getExerciseHistory", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{
+		"exercise":   exercise,
+		"rule":       rule.Name(),
+		"config":     cfg,
+		"history":    history,
+		"suggestion": progression.Suggest(rule, history, cfg),
+	})
+}
+
+func (h *ProgressionHandler) HandleListSettings(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+
+	settings, err := h.progressionStore.ListProgressionSettings(r.Context(), currentUser.ID)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "listProgressionSettings", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"settings": settings, "rules": progression.RuleNames()})
+}
+
+// HandleUpsertSetting saves the config for one exercise, or the user's default
+// when exercise is empty. Omitted fields take their default values.
+func (h *ProgressionHandler) HandleUpsertSetting(w http.ResponseWriter, r *http.Request) {
+	setting := store.ProgressionSetting{Config: progression.DefaultConfig()}
+	err := json.NewDecoder(r.Body).Decode(&setting)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "decodingProgressionSetting", "error", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request sent"})
+		return
+	}
+
+	err = setting.Validate()
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+	err = h.progressionStore.UpsertProgressionSetting(r.Context(), currentUser.ID, &setting)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "upsertProgressionSetting", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"setting": setting})
+}
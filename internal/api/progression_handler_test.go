@@ -0,0 +1,58 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dapoadedire/fem_project/internal/middleware"
+	"github.com/dapoadedire/fem_project/internal/progression"
+	"github.com/dapoadedire/fem_project/internal/store"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeProgressionStore struct {
+	store.ProgressionStore
+	exercises []string
+}
+
+func (s *fakeProgressionStore) GetProgressionConfig(ctx context.Context, userID int, exercise string) (progression.Config, error) {
+	s.exercises = append(s.exercises, exercise)
+	return progression.DefaultConfig(), nil
+}
+
+func (s *fakeProgressionStore) GetExerciseHistory(ctx context.Context, userID int, exercise string, limit int) ([]progression.Session, error) {
+	return nil, nil
+}
+
+func TestNextSessionExerciseName(t *testing.T) {
+	tests := []struct {
+		name     string
+		path     string
+		exercise string
+	}{
+		{"plain", "/exercises/Squat/next", "Squat"},
+		{"escaped space", "/exercises/Bench%20Press/next", "Bench Press"},
+		{"percent sign", "/exercises/Squat%20100%25/next", "Squat 100%"},
+		{"escaped slash", "/exercises/Push%2FPull%20100%25/next", "Push/Pull 100%"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			progressionStore := &fakeProgressionStore{}
+			handler := NewProgressionHandler(progressionStore, discardLogger)
+			router := chi.NewRouter()
+			router.Get("/exercises/{name}/next", handler.HandleGetNextSession)
+
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req = middleware.SetUser(req, &store.User{ID: 1})
+			res := httptest.NewRecorder()
+			router.ServeHTTP(res, req)
+
+			assert.Equal(t, http.StatusOK, res.Code)
+			assert.Equal(t, []string{tt.exercise}, progressionStore.exercises)
+		})
+	}
+}
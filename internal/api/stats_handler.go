@@ -0,0 +1,93 @@
+package api
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/dapoadedire/fem_project/internal/middleware"
+	"github.com/dapoadedire/fem_project/internal/store"
+	"github.com/dapoadedire/fem_project/internal/utils"
+)
+
+// defaultStatsWindow is how far back GET /stats looks when no from date is given.
+const defaultStatsWindow = 30 * 24 * time.Hour
+
+type StatsHandler struct {
+	analyticsStore store.AnalyticsStore
+	logger         *slog.Logger
+}
+
+func NewStatsHandler(analyticsStore store.AnalyticsStore, logger *slog.Logger) *StatsHandler {
+	return &StatsHandler{
+		analyticsStore: analyticsStore,
+		logger:         logger,
+	}
+}
+
+func (h *StatsHandler) HandleGetStats(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+
+	location, ok := readLocation(w, r)
+	if !ok {
+		return
+	}
+
+	query := store.StatsQuery{
+		UserID:   currentUser.ID,
+		To:       time.Now(),
+		Bucket:   r.URL.Query().Get("bucket"),
+		Location: location,
+		GroupBy:  r.URL.Query().Get("group_by"),
+	}
+	if query.Bucket == "" {
+		query.Bucket = store.BucketWeek
+	}
+
+	to, err := utils.ReadTimeQueryIn(r, "to", location)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+	if to != nil {
+		query.To = *to
+	}
+	query.From = query.To.Add(-defaultStatsWindow)
+	from, err := utils.ReadTimeQueryIn(r, "from", location)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+	if from != nil {
+		query.From = *from
+	}
+
+	report, err := h.analyticsStore.GetStats(r.Context(), query)
+	if errors.Is(err, store.ErrInvalidStatsQuery) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "getStats", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"stats": report})
+}
+
+// readLocation loads the time zone named by the tz query parameter, defaulting
+// to UTC, and writes an error response for unknown zones.
+func readLocation(w http.ResponseWriter, r *http.Request) (*time.Location, bool) {
+	tz := r.URL.Query().Get("tz")
+	if tz == "" {
+		return time.UTC, true
+	}
+	location, err := time.LoadLocation(tz)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "tz must be an IANA time zone name"})
+		return nil, false
+	}
+	return location, true
+}
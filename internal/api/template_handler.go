@@ -0,0 +1,335 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/dapoadedire/fem_project/internal/middleware"
+	"github.com/dapoadedire/fem_project/internal/store"
+	"github.com/dapoadedire/fem_project/internal/utils"
+)
+
+type templateRequest struct {
+	Title           *string               `json:"title"`
+	Description     *string               `json:"description"`
+	DurationMinutes *int                  `json:"duration_minutes"`
+	CaloriesBurned  *int                  `json:"calories_burned"`
+	Entries         []store.TemplateEntry `json:"entries"`
+}
+
+// entryOverride replaces the planned values of the template entry with the
+// same order_index when a workout is started from a template. The template's
+// rpe is never carried over, so RPE is how the user logs the one they felt.
+type entryOverride struct {
+	OrderIndex      int      `json:"order_index"`
+	Sets            *int     `json:"sets"`
+	Reps            *int     `json:"reps"`
+	DurationSeconds *int     `json:"duration_seconds"`
+	Weight          *float64 `json:"weight"`
+	RPE             *float64 `json:"rpe"`
+	Notes           *string  `json:"notes"`
+}
+
+type startTemplateRequest struct {
+	Title           *string         `json:"title"`
+	Description     *string         `json:"description"`
+	DurationMinutes *int            `json:"duration_minutes"`
+	CaloriesBurned  *int            `json:"calories_burned"`
+	ProgramDayID    *int            `json:"program_day_id"`
+	Entries         []entryOverride `json:"entries"`
+}
+
+type TemplateHandler struct {
+	templateStore store.TemplateStore
+	workoutStore  store.WorkoutStore
+	logger        *slog.Logger
+}
+
+func NewTemplateHandler(templateStore store.TemplateStore, workoutStore store.WorkoutStore, logger *slog.Logger) *TemplateHandler {
+	return &TemplateHandler{
+		templateStore: templateStore,
+		workoutStore:  workoutStore,
+		logger:        logger,
+	}
+}
+
+func (h *TemplateHandler) HandleListTemplates(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+
+	templates, err := h.templateStore.ListTemplates(r.Context(), currentUser.ID)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "listTemplates", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"templates": templates})
+}
+
+func (h *TemplateHandler) HandleGetTemplateByID(w http.ResponseWriter, r *http.Request) {
+	template, ok := h.readOwnedTemplate(w, r)
+	if !ok {
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"template": template})
+}
+
+func (h *TemplateHandler) HandleCreateTemplate(w http.ResponseWriter, r *http.Request) {
+	var req templateRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "decodingCreateTemplate", "error", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request sent"})
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+	template := &store.WorkoutTemplate{UserID: currentUser.ID}
+	applyTemplateRequest(template, &req)
+	err = validateTemplate(template)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	createdTemplate, err := h.templateStore.CreateTemplate(r.Context(), template)
+	if isInvalidWorkoutError(err) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "createTemplate", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"template": createdTemplate})
+}
+
+func (h *TemplateHandler) HandleUpdateTemplateByID(w http.ResponseWriter, r *http.Request) {
+	template, ok := h.readOwnedTemplate(w, r)
+	if !ok {
+		return
+	}
+
+	var req templateRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "decodingUpdateTemplate", "error", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request sent"})
+		return
+	}
+
+	applyTemplateRequest(template, &req)
+	err = validateTemplate(template)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	err = h.templateStore.UpdateTemplate(r.Context(), template)
+	if isInvalidWorkoutError(err) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "updateTemplate", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"template": template})
+}
+
+func (h *TemplateHandler) HandleDeleteTemplate(w http.ResponseWriter, r *http.Request) {
+	template, ok := h.readOwnedTemplate(w, r)
+	if !ok {
+		return
+	}
+
+	err := h.templateStore.DeleteTemplate(r.Context(), int64(template.ID))
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "template not found"})
+		return
+	}
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "deleteTemplate", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusNoContent, utils.Envelope{"message": "template deleted successfully"})
+}
+
+// HandleStartTemplate creates a workout for the current user from the template,
+// applying any per-entry overrides sent in the (optional) request body.
+func (h *TemplateHandler) HandleStartTemplate(w http.ResponseWriter, r *http.Request) {
+	template, ok := h.readOwnedTemplate(w, r)
+	if !ok {
+		return
+	}
+
+	var req startTemplateRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil && !errors.Is(err, io.EOF) {
+		h.logger.ErrorContext(r.Context(), "decodingStartTemplate", "error", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request sent"})
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+	workout := template.NewWorkout(currentUser.ID)
+	err = applyStartOverrides(workout, &req)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	createdWorkout, err := h.workoutStore.CreateWorkout(r.Context(), workout)
+	if isInvalidWorkoutError(err) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "createWorkoutFromTemplate", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"workout": createdWorkout, "new_records": createdWorkout.NewRecords})
+}
+
+// readOwnedTemplate loads the template named by the id URL parameter, writing
+// an error response and returning false unless it belongs to the current user.
+func (h *TemplateHandler) readOwnedTemplate(w http.ResponseWriter, r *http.Request) (*store.WorkoutTemplate, bool) {
+	templateID, err := utils.ReadIDParam(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid template ID"})
+		return nil, false
+	}
+
+	template, err := h.templateStore.GetTemplateByID(r.Context(), templateID)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "getTemplateByID", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return nil, false
+	}
+
+	currentUser := middleware.GetUser(r)
+	if template == nil || template.UserID != currentUser.ID {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "template not found"})
+		return nil, false
+	}
+
+	return template, true
+}
+
+func applyTemplateRequest(template *store.WorkoutTemplate, req *templateRequest) {
+	if req.Title != nil {
+		template.Title = *req.Title
+	}
+	if req.Description != nil {
+		template.Description = *req.Description
+	}
+	if req.DurationMinutes != nil {
+		template.DurationMinutes = *req.DurationMinutes
+	}
+	if req.CaloriesBurned != nil {
+		template.CaloriesBurned = *req.CaloriesBurned
+	}
+	if req.Entries != nil {
+		template.Entries = req.Entries
+	}
+}
+
+func validateTemplate(template *store.WorkoutTemplate) error {
+	if strings.TrimSpace(template.Title) == "" {
+		return errors.New("title is required")
+	}
+	for _, entry := range template.Entries {
+		err := validateMeasurement(entry.OrderIndex, entry.Reps, entry.DurationSeconds)
+		if err != nil {
+			return err
+		}
+		err = validateRPE(entry.OrderIndex, entry.RPE)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateMeasurement checks that an entry is measured in either reps or
+// duration_seconds, as the entry tables require.
+func validateMeasurement(orderIndex int, reps, durationSeconds *int) error {
+	if (reps == nil) == (durationSeconds == nil) {
+		return fmt.Errorf("entry %d must have either reps or duration_seconds", orderIndex)
+	}
+	return nil
+}
+
+// applyStartOverrides applies req to a workout made from a template. An
+// override of reps or duration_seconds replaces the other measurement.
+func applyStartOverrides(workout *store.Workout, req *startTemplateRequest) error {
+	if req.Title != nil {
+		workout.Title = *req.Title
+	}
+	if req.Description != nil {
+		workout.Description = *req.Description
+	}
+	if req.DurationMinutes != nil {
+		workout.DurationMinutes = *req.DurationMinutes
+	}
+	if req.CaloriesBurned != nil {
+		workout.CaloriesBurned = *req.CaloriesBurned
+	}
+	workout.ProgramDayID = req.ProgramDayID
+
+	for _, override := range req.Entries {
+		var entry *store.WorkoutEntry
+		for i := range workout.Entries {
+			if workout.Entries[i].OrderIndex == override.OrderIndex {
+				entry = &workout.Entries[i]
+				break
+			}
+		}
+		if entry == nil {
+			return errors.New("no template entry with the given order_index")
+		}
+
+		if override.Reps != nil && override.DurationSeconds != nil {
+			return fmt.Errorf("entry %d must have either reps or duration_seconds", override.OrderIndex)
+		}
+		if err := validateRPE(override.OrderIndex, override.RPE); err != nil {
+			return err
+		}
+
+		if override.Sets != nil {
+			entry.Sets = *override.Sets
+		}
+		if override.Reps != nil {
+			entry.Reps = override.Reps
+			entry.DurationSeconds = nil
+		}
+		if override.DurationSeconds != nil {
+			entry.DurationSeconds = override.DurationSeconds
+			entry.Reps = nil
+		}
+		if override.Weight != nil {
+			entry.Weight = override.Weight
+		}
+		if override.RPE != nil {
+			entry.RPE = override.RPE
+		}
+		if override.Notes != nil {
+			entry.Notes = *override.Notes
+		}
+	}
+	return nil
+}
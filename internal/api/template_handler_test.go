@@ -0,0 +1,153 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dapoadedire/fem_project/internal/middleware"
+	"github.com/dapoadedire/fem_project/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func intPtr(i int) *int {
+	return &i
+}
+
+// newTemplateWorkout is a workout as started from a template with a reps
+// and a duration entry.
+func newTemplateWorkout() *store.Workout {
+	template := &store.WorkoutTemplate{
+		Title: "Full Body",
+		Entries: []store.TemplateEntry{
+			{ExerciseName: "Squat", Sets: 5, Reps: intPtr(5), OrderIndex: 1},
+			{ExerciseName: "Plank", Sets: 3, DurationSeconds: intPtr(60), RPE: floatPtr(7), OrderIndex: 2},
+		},
+	}
+	return template.NewWorkout(1)
+}
+
+func TestApplyStartOverrides(t *testing.T) {
+	t.Run("overrides the workout and matching entries", func(t *testing.T) {
+		workout := newTemplateWorkout()
+		title := "Monday"
+		notes := "felt strong"
+		err := applyStartOverrides(workout, &startTemplateRequest{
+			Title:        &title,
+			ProgramDayID: intPtr(3),
+			Entries:      []entryOverride{{OrderIndex: 1, Sets: intPtr(3), Reps: intPtr(8), Notes: &notes}},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "Monday", workout.Title)
+		assert.Equal(t, 3, *workout.ProgramDayID)
+		assert.Equal(t, 3, workout.Entries[0].Sets)
+		assert.Equal(t, 8, *workout.Entries[0].Reps)
+		assert.Equal(t, "felt strong", workout.Entries[0].Notes)
+		assert.Equal(t, 60, *workout.Entries[1].DurationSeconds)
+	})
+
+	t.Run("an overridden measurement replaces the other", func(t *testing.T) {
+		workout := newTemplateWorkout()
+		err := applyStartOverrides(workout, &startTemplateRequest{
+			Entries: []entryOverride{
+				{OrderIndex: 1, DurationSeconds: intPtr(30)},
+				{OrderIndex: 2, Reps: intPtr(10)},
+			},
+		})
+		require.NoError(t, err)
+		assert.Nil(t, workout.Entries[0].Reps)
+		assert.Equal(t, 30, *workout.Entries[0].DurationSeconds)
+		assert.Equal(t, 10, *workout.Entries[1].Reps)
+		assert.Nil(t, workout.Entries[1].DurationSeconds)
+	})
+
+	t.Run("rejects both measurements", func(t *testing.T) {
+		err := applyStartOverrides(newTemplateWorkout(), &startTemplateRequest{
+			Entries: []entryOverride{{OrderIndex: 1, Reps: intPtr(5), DurationSeconds: intPtr(30)}},
+		})
+		assert.Error(t, err)
+	})
+
+	t.Run("logs the rpe felt", func(t *testing.T) {
+		workout := newTemplateWorkout()
+		rpe := 8.5
+		err := applyStartOverrides(workout, &startTemplateRequest{
+			Entries: []entryOverride{{OrderIndex: 1, RPE: &rpe}},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 8.5, *workout.Entries[0].RPE)
+		assert.Nil(t, workout.Entries[1].RPE)
+	})
+
+	t.Run("rejects an rpe out of range", func(t *testing.T) {
+		rpe := 11.0
+		err := applyStartOverrides(newTemplateWorkout(), &startTemplateRequest{
+			Entries: []entryOverride{{OrderIndex: 1, RPE: &rpe}},
+		})
+		assert.Error(t, err)
+	})
+
+	t.Run("rejects an unknown entry", func(t *testing.T) {
+		err := applyStartOverrides(newTemplateWorkout(), &startTemplateRequest{
+			Entries: []entryOverride{{OrderIndex: 3, Reps: intPtr(5)}},
+		})
+		assert.Error(t, err)
+	})
+}
+
+type fakeTemplateStore struct {
+	store.TemplateStore
+	templates []*store.WorkoutTemplate
+	getErr    error
+	created   []*store.WorkoutTemplate
+}
+
+func (s *fakeTemplateStore) GetTemplateByID(ctx context.Context, id int64) (*store.WorkoutTemplate, error) {
+	if s.getErr != nil {
+		return nil, s.getErr
+	}
+	for _, template := range s.templates {
+		if int64(template.ID) == id {
+			return template, nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *fakeTemplateStore) CreateTemplate(ctx context.Context, template *store.WorkoutTemplate) (*store.WorkoutTemplate, error) {
+	s.created = append(s.created, template)
+	return template, nil
+}
+
+func TestCreateTemplateValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		code int
+	}{
+		{"valid", `{"title": "Legs", "entries": [{"exercise_name": "Squat", "sets": 5, "reps": 5, "order_index": 1}]}`, http.StatusCreated},
+		{"missing title", `{"entries": []}`, http.StatusBadRequest},
+		{"both measurements", `{"title": "Legs", "entries": [{"exercise_name": "Squat", "sets": 5, "reps": 5, "duration_seconds": 30, "order_index": 1}]}`, http.StatusBadRequest},
+		{"no measurement", `{"title": "Legs", "entries": [{"exercise_name": "Squat", "sets": 5, "order_index": 1}]}`, http.StatusBadRequest},
+		{"planned rpe", `{"title": "Legs", "entries": [{"exercise_name": "Squat", "sets": 5, "reps": 5, "rpe": 8, "order_index": 1}]}`, http.StatusCreated},
+		{"rpe out of range", `{"title": "Legs", "entries": [{"exercise_name": "Squat", "sets": 5, "reps": 5, "rpe": 11, "order_index": 1}]}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			templateStore := &fakeTemplateStore{}
+			h := NewTemplateHandler(templateStore, nil, discardLogger)
+
+			req := httptest.NewRequest(http.MethodPost, "/templates", strings.NewReader(tt.body))
+			req = middleware.SetUser(req, &store.User{ID: 1})
+			res := httptest.NewRecorder()
+			h.HandleCreateTemplate(res, req)
+			assert.Equal(t, tt.code, res.Code, res.Body.String())
+			if tt.code != http.StatusCreated {
+				assert.Empty(t, templateStore.created)
+			}
+		})
+	}
+}
@@ -1,32 +1,70 @@
 package api
 
 import (
+	"bytes"
+	"database/sql"
 	"encoding/json"
-	"log"
+	"errors"
+	"log/slog"
 	"net/http"
 	"time"
+	"unicode/utf8"
 
+	"github.com/dapoadedire/fem_project/internal/encryption"
+	"github.com/dapoadedire/fem_project/internal/metrics"
+	"github.com/dapoadedire/fem_project/internal/middleware"
 	"github.com/dapoadedire/fem_project/internal/store"
 	"github.com/dapoadedire/fem_project/internal/tokens"
 	"github.com/dapoadedire/fem_project/internal/utils"
+	"golang.org/x/crypto/bcrypt"
 )
 
 type TokenHandler struct {
-	tokenStore store.TokenStore
-	userStore  store.UserStore
-	logger     *log.Logger
+	tokenStore        store.TokenStore
+	userStore         store.UserStore
+	loginAttemptStore store.LoginAttemptStore
+	twoFactor         secondFactor
+	tokenTTL          time.Duration
+	refreshTokenTTL   time.Duration
+	twoFactorTTL      time.Duration
+	// dummyPasswordHash is compared against for unknown usernames, so that
+	// they take as long to reject as wrong passwords
+	dummyPasswordHash []byte
+	metrics           *metrics.Metrics
+	logger            *slog.Logger
 }
 
+// maxUserAgentLength caps the user agent kept with a session.
+const maxUserAgentLength = 512
+
 type createTokenRequest struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
 }
 
-func NewTokenHandler(tokenStore store.TokenStore, userStore store.UserStore, logger *log.Logger) *TokenHandler {
+type twoFactorLoginRequest struct {
+	PendingToken string `json:"pending_token"`
+	twoFactorCodeRequest
+}
+
+type refreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+func NewTokenHandler(tokenStore store.TokenStore, userStore store.UserStore, loginAttemptStore store.LoginAttemptStore, twoFactorStore store.TwoFactorStore, totpCipher *encryption.Cipher, tokenTTL, refreshTokenTTL, twoFactorTTL time.Duration, bcryptCost int, m *metrics.Metrics, logger *slog.Logger) *TokenHandler {
+	// only fails for a cost out of range, which the config does not allow
+	dummyPasswordHash, _ := bcrypt.GenerateFromPassword([]byte("not anyone's password"), bcryptCost)
 	return &TokenHandler{
-		tokenStore: tokenStore,
-		userStore:  userStore,
-		logger:     logger,
+		tokenStore:        tokenStore,
+		userStore:         userStore,
+		loginAttemptStore: loginAttemptStore,
+		twoFactor:         secondFactor{store: twoFactorStore, cipher: totpCipher},
+		tokenTTL:          tokenTTL,
+		refreshTokenTTL:   refreshTokenTTL,
+		twoFactorTTL:      twoFactorTTL,
+		dummyPasswordHash: dummyPasswordHash,
+		metrics:           m,
+		logger:            logger,
 	}
 }
 
@@ -34,37 +72,306 @@ func (h *TokenHandler) HandleCreateToken(w http.ResponseWriter, r *http.Request)
 	var req createTokenRequest
 	err := json.NewDecoder(r.Body).Decode(&req)
 	if err != nil {
-		h.logger.Printf("ERROR: decodingCreateToken: %v", err)
+		h.logger.ErrorContext(r.Context(), "decodingCreateToken", "error", err)
 		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request sent"})
 		return
 	}
 
-	user, err := h.userStore.GetUserByUsername(req.Username)
-	if err != nil || user == nil {
-		h.logger.Printf("ERROR: getUserByUsername: %v", err)
+	user, err := h.userStore.GetUserByUsername(r.Context(), req.Username)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "getUserByUsername", "error", err)
 		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
 		return
 	}
+	// unknown usernames and locked out accounts are answered like a wrong
+	// password, in as much time, so that logins cannot be used to find out
+	// who is registered, nor to keep guessing during a lockout
+	if user == nil {
+		bcrypt.CompareHashAndPassword(h.dummyPasswordHash, []byte(req.Password))
+		h.metrics.LoginFailed(metrics.LoginUnknownUser)
+		h.logger.WarnContext(r.Context(), "unknown username", "username", req.Username)
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "invalid credentials"})
+		return
+	}
 
 	passwordsDoMatch, err := user.PasswordHash.Matches(req.Password)
 	if err != nil {
-		h.logger.Printf("ERROR: password hash match: %v", err)
+		h.logger.ErrorContext(r.Context(), "password hash match", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	lockedUntil, err := h.loginAttemptStore.GetLockout(r.Context(), user.ID)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "getLockout", "error", err)
 		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
 		return
 	}
+	if lockedUntil != nil {
+		h.metrics.LoginFailed(metrics.LoginLockedOut)
+		h.logger.WarnContext(r.Context(), "account locked out", "username", req.Username, "until", *lockedUntil)
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "invalid credentials"})
+		return
+	}
+
 	if !passwordsDoMatch {
-		h.logger.Printf("ERROR: password does not match")
+		h.metrics.LoginFailed(metrics.LoginWrongPassword)
+		h.logger.WarnContext(r.Context(), "password does not match", "username", req.Username)
+		lockedUntil, err = h.loginAttemptStore.RecordFailedLogin(r.Context(), user.ID)
+		if err != nil {
+			h.logger.ErrorContext(r.Context(), "recordFailedLogin", "error", err)
+		} else if lockedUntil != nil {
+			h.logger.WarnContext(r.Context(), "account locked out", "username", req.Username, "until", *lockedUntil)
+		}
 		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "invalid credentials"})
 		return
 	}
 
-	// Create a new token
-	token, err := h.tokenStore.CreateNewToken(user.ID, 24*time.Hour, tokens.ScopeAuth)
+	secret, err := h.twoFactor.store.GetTOTP(r.Context(), user.ID)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "getTOTP", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	if secret.Enabled() {
+		// failures are only reset once the code is right as well, so that the
+		// password cannot be used to keep guessing codes
+		pending, err := h.tokenStore.CreateNewToken(r.Context(), user.ID, h.twoFactorTTL, tokens.Scope2FAPending)
+		if err != nil {
+			h.logger.ErrorContext(r.Context(), "creating 2FA pending token", "error", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+			return
+		}
+		utils.WriteJSON(w, http.StatusAccepted, utils.Envelope{"2fa_pending_token": pending})
+		return
+	}
+
+	h.issueTokens(w, r, user.ID)
+}
+
+// HandleTwoFactorLogin finishes the login of a user with 2FA on, exchanging
+// the pending token HandleCreateToken gave out and a valid code for an
+// authentication and a refresh token.
+func (h *TokenHandler) HandleTwoFactorLogin(w http.ResponseWriter, r *http.Request) {
+	var req twoFactorLoginRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil || req.PendingToken == "" {
+		h.logger.ErrorContext(r.Context(), "decodingTwoFactorLogin", "error", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request sent"})
+		return
+	}
+
+	user, err := h.userStore.GetUserToken(r.Context(), tokens.Scope2FAPending, req.PendingToken)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "getUserToken", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	if user == nil {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "invalid or expired pending token"})
+		return
+	}
+
+	lockedUntil, err := h.loginAttemptStore.GetLockout(r.Context(), user.ID)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "getLockout", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	if lockedUntil != nil {
+		h.metrics.LoginFailed(metrics.LoginLockedOut)
+		middleware.SetRetryAfter(w, time.Until(*lockedUntil))
+		utils.WriteJSON(w, http.StatusTooManyRequests, utils.Envelope{"error": "too many failed login attempts, try again later"})
+		return
+	}
+
+	secret, err := h.twoFactor.store.GetTOTP(r.Context(), user.ID)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "getTOTP", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	ok := false
+	if secret.Enabled() {
+		ok, err = h.twoFactor.verify(r.Context(), secret, req.twoFactorCodeRequest)
+		if err != nil {
+			h.logger.ErrorContext(r.Context(), "verifying 2FA code", "error", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+			return
+		}
+	}
+	if !ok {
+		h.metrics.LoginFailed(metrics.LoginWrongCode)
+		h.logger.WarnContext(r.Context(), "2FA code does not match", "username", user.Username)
+		lockedUntil, err = h.loginAttemptStore.RecordFailedLogin(r.Context(), user.ID)
+		if err != nil {
+			h.logger.ErrorContext(r.Context(), "recordFailedLogin", "error", err)
+		} else if lockedUntil != nil {
+			h.logger.WarnContext(r.Context(), "account locked out", "username", user.Username, "until", *lockedUntil)
+		}
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "invalid code"})
+		return
+	}
+
+	// the pending token is single use, like the code
+	err = h.tokenStore.DeleteToken(r.Context(), tokens.Hash(req.PendingToken))
+	if errors.Is(err, sql.ErrNoRows) {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "invalid or expired pending token"})
+		return
+	}
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "deleteToken", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	h.issueTokens(w, r, user.ID)
+}
+
+// issueTokens completes a login, clearing the user's failed attempts and
+// responding with a new authentication and refresh token.
+func (h *TokenHandler) issueTokens(w http.ResponseWriter, r *http.Request, userID int) {
+	err := h.loginAttemptStore.ResetFailedLogins(r.Context(), userID)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "resetFailedLogins", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	access, refresh, err := h.generateTokenPair(r, userID)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "generating new token", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	err = h.tokenStore.InsertFamily(r.Context(), access, refresh)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "creating new token", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"auth_token": access, "refresh_token": refresh})
+}
+
+// HandleRefreshToken exchanges a refresh token for a new authentication token
+// and a new refresh token. Every refresh token is good for one exchange only.
+func (h *TokenHandler) HandleRefreshToken(w http.ResponseWriter, r *http.Request) {
+	var req refreshTokenRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil || req.RefreshToken == "" {
+		h.logger.ErrorContext(r.Context(), "decodingRefreshToken", "error", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request sent"})
+		return
+	}
+
+	// the owner is only known once the store has found the old token
+	access, refresh, err := h.generateTokenPair(r, 0)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "generating new token", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	err = h.tokenStore.RotateRefreshToken(r.Context(), tokens.Hash(req.RefreshToken), access, refresh)
+	if errors.Is(err, sql.ErrNoRows) {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "invalid or expired refresh token"})
+		return
+	}
+	if errors.Is(err, store.ErrRefreshTokenReused) {
+		h.logger.WarnContext(r.Context(), "refresh token reused, session revoked")
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "refresh token was already used, please log in again"})
+		return
+	}
 	if err != nil {
-		h.logger.Printf("ERROR: creating new token: %v", err)
+		h.logger.ErrorContext(r.Context(), "rotateRefreshToken", "error", err)
 		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
 		return
 	}
 
-	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"auth_token": token})
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"auth_token": access, "refresh_token": refresh})
+}
+
+// generateTokenPair generates an authentication and a refresh token for the
+// client making r.
+func (h *TokenHandler) generateTokenPair(r *http.Request, userID int) (*tokens.Token, *tokens.Token, error) {
+	access, err := tokens.GenerateToken(userID, h.tokenTTL, tokens.ScopeAuth)
+	if err != nil {
+		return nil, nil, err
+	}
+	refresh, err := tokens.GenerateToken(userID, h.refreshTokenTTL, tokens.ScopeRefresh)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, token := range []*tokens.Token{access, refresh} {
+		token.UserAgent = truncate(r.UserAgent(), maxUserAgentLength)
+		token.IP = middleware.RemoteIP(r)
+	}
+	return access, refresh, nil
+}
+
+// session is an issued token as listed to its owner, marking the one the
+// listing was requested with.
+type session struct {
+	*tokens.Token
+	Current bool `json:"current"`
+}
+
+func (h *TokenHandler) HandleListTokens(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	list, err := h.tokenStore.ListTokensForUser(r.Context(), user.ID, tokens.ScopeAuth)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "listTokensForUser", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	current := middleware.GetTokenHash(r)
+	sessions := make([]session, len(list))
+	for i, token := range list {
+		sessions[i] = session{Token: token, Current: bytes.Equal(token.Hash, current)}
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"tokens": sessions})
+}
+
+// HandleRevokeCurrentToken logs out the session the request was made with.
+func (h *TokenHandler) HandleRevokeCurrentToken(w http.ResponseWriter, r *http.Request) {
+	err := h.tokenStore.DeleteToken(r.Context(), middleware.GetTokenHash(r))
+	if errors.Is(err, sql.ErrNoRows) {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "token not found"})
+		return
+	}
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "deleteToken", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	utils.WriteJSON(w, http.StatusNoContent, utils.Envelope{"message": "token revoked successfully"})
+}
+
+// HandleRevokeAllTokens logs out every session of the user, including the
+// one the request was made with, and their refresh tokens.
+func (h *TokenHandler) HandleRevokeAllTokens(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	for _, scope := range []string{tokens.ScopeAuth, tokens.ScopeRefresh} {
+		err := h.tokenStore.DeleteAllTokensForUser(r.Context(), user.ID, scope)
+		if err != nil {
+			h.logger.ErrorContext(r.Context(), "deleteAllTokensForUser", "error", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+			return
+		}
+	}
+	utils.WriteJSON(w, http.StatusNoContent, utils.Envelope{"message": "tokens revoked successfully"})
+}
+
+// truncate shortens s to at most n bytes without splitting a UTF-8 sequence.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
 }
@@ -0,0 +1,111 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dapoadedire/fem_project/internal/store"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type fakeLoginAttemptStore struct {
+	store.LoginAttemptStore
+	lockedUntil *time.Time
+	failed      []int
+}
+
+func (s *fakeLoginAttemptStore) GetLockout(ctx context.Context, userID int) (*time.Time, error) {
+	return s.lockedUntil, nil
+}
+
+func (s *fakeLoginAttemptStore) RecordFailedLogin(ctx context.Context, userID int) (*time.Time, error) {
+	s.failed = append(s.failed, userID)
+	return nil, nil
+}
+
+func TestCreateTokenRejectsUnknownUsers(t *testing.T) {
+	userStore := &fakeUserStore{user: newTestUser(t)}
+	loginAttempts := &fakeLoginAttemptStore{}
+	h := NewTokenHandler(&fakeTokenStore{}, userStore, loginAttempts, nil, nil, time.Hour, 24*time.Hour, time.Minute, bcrypt.MinCost, nil, discardLogger)
+
+	login := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/tokens/authentication", strings.NewReader(body))
+		res := httptest.NewRecorder()
+		h.HandleCreateToken(res, req)
+		return res
+	}
+
+	// an unknown username cannot be told apart from a wrong password
+	unknown := login(`{"username": "mallory", "password": "password123"}`)
+	wrong := login(`{"username": "alice", "password": "wrong password"}`)
+	assert.Equal(t, http.StatusUnauthorized, unknown.Code)
+	assert.Equal(t, wrong.Code, unknown.Code)
+	assert.Equal(t, wrong.Body.String(), unknown.Body.String())
+	assert.Equal(t, []int{1}, loginAttempts.failed)
+}
+
+func TestCreateTokenHidesLockouts(t *testing.T) {
+	userStore := &fakeUserStore{user: newTestUser(t)}
+	lockedUntil := time.Now().Add(time.Hour)
+	loginAttempts := &fakeLoginAttemptStore{lockedUntil: &lockedUntil}
+	h := NewTokenHandler(&fakeTokenStore{}, userStore, loginAttempts, nil, nil, time.Hour, 24*time.Hour, time.Minute, bcrypt.MinCost, nil, discardLogger)
+
+	login := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/tokens/authentication", strings.NewReader(body))
+		res := httptest.NewRecorder()
+		h.HandleCreateToken(res, req)
+		return res
+	}
+
+	// a locked account answers like an unknown username, even to the right password
+	unknown := login(`{"username": "mallory", "password": "password123"}`)
+	for _, body := range []string{
+		`{"username": "alice", "password": "wrong password"}`,
+		`{"username": "alice", "password": "password123"}`,
+	} {
+		res := login(body)
+		assert.Equal(t, unknown.Code, res.Code)
+		assert.Equal(t, unknown.Body.String(), res.Body.String())
+		assert.Empty(t, res.Header().Get("Retry-After"))
+	}
+	assert.Empty(t, loginAttempts.failed)
+}
+
+func TestRefreshToken(t *testing.T) {
+	tests := []struct {
+		name      string
+		body      string
+		rotateErr error
+		code      int
+	}{
+		{"exchanged", `{"refresh_token": "token"}`, nil, http.StatusCreated},
+		{"missing token", `{}`, nil, http.StatusBadRequest},
+		{"unknown or expired", `{"refresh_token": "token"}`, sql.ErrNoRows, http.StatusUnauthorized},
+		{"reused", `{"refresh_token": "token"}`, store.ErrRefreshTokenReused, http.StatusUnauthorized},
+		{"store failure", `{"refresh_token": "token"}`, errors.New("connection reset"), http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokenStore := &fakeTokenStore{rotateErr: tt.rotateErr}
+			h := NewTokenHandler(tokenStore, &fakeUserStore{}, nil, nil, nil, time.Hour, 24*time.Hour, time.Minute, bcrypt.MinCost, nil, discardLogger)
+
+			req := httptest.NewRequest(http.MethodPost, "/tokens/refresh", strings.NewReader(tt.body))
+			res := httptest.NewRecorder()
+			h.HandleRefreshToken(res, req)
+			assert.Equal(t, tt.code, res.Code, res.Body.String())
+			if tt.rotateErr == store.ErrRefreshTokenReused {
+				assert.Contains(t, res.Body.String(), "already used")
+			}
+			if tt.code == http.StatusCreated {
+				assert.Contains(t, res.Body.String(), "refresh_token")
+			}
+		})
+	}
+}
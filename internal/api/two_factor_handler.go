@@ -0,0 +1,244 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/dapoadedire/fem_project/internal/encryption"
+	"github.com/dapoadedire/fem_project/internal/middleware"
+	"github.com/dapoadedire/fem_project/internal/store"
+	"github.com/dapoadedire/fem_project/internal/tokens"
+	"github.com/dapoadedire/fem_project/internal/totp"
+	"github.com/dapoadedire/fem_project/internal/utils"
+)
+
+const (
+	totpIssuer        = "fem_project"
+	recoveryCodeCount = 10
+)
+
+var errTwoFactorUnavailable = errors.New("two-factor authentication is not configured")
+
+// twoFactorCodeRequest carries either a code from the authenticator app or
+// one of the recovery codes.
+type twoFactorCodeRequest struct {
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+// secondFactor checks the codes of users who have 2FA on. cipher is nil when
+// no key is configured.
+type secondFactor struct {
+	store  store.TwoFactorStore
+	cipher *encryption.Cipher
+}
+
+// secretData binds an encrypted secret to its user.
+func secretData(userID int) []byte {
+	return []byte(strconv.Itoa(userID))
+}
+
+func (f secondFactor) decryptSecret(secret *store.TOTP) (string, error) {
+	if f.cipher == nil {
+		return "", errTwoFactorUnavailable
+	}
+	plain, err := f.cipher.Decrypt(secret.Secret, secretData(secret.UserID))
+	if err != nil {
+		return "", err
+	}
+	return string(plain), nil
+}
+
+// verify reports whether req holds a valid code for the enabled secret,
+// using up the code so it cannot be replayed.
+func (f secondFactor) verify(ctx context.Context, secret *store.TOTP, req twoFactorCodeRequest) (bool, error) {
+	if req.RecoveryCode != "" {
+		return f.store.UseRecoveryCode(ctx, secret.UserID, tokens.Hash(totp.NormalizeRecoveryCode(req.RecoveryCode)))
+	}
+
+	plain, err := f.decryptSecret(secret)
+	if err != nil {
+		return false, err
+	}
+	step, ok := totp.Validate(plain, req.Code, time.Now())
+	if !ok || step <= secret.LastStep {
+		return false, nil
+	}
+	return f.store.UseTOTPStep(ctx, secret.UserID, step)
+}
+
+type TwoFactorHandler struct {
+	twoFactor secondFactor
+	attempts  failedAttempts
+	logger    *slog.Logger
+}
+
+func NewTwoFactorHandler(twoFactorStore store.TwoFactorStore, loginAttemptStore store.LoginAttemptStore, cipher *encryption.Cipher, logger *slog.Logger) *TwoFactorHandler {
+	return &TwoFactorHandler{
+		twoFactor: secondFactor{store: twoFactorStore, cipher: cipher},
+		attempts:  failedAttempts{store: loginAttemptStore, logger: logger},
+		logger:    logger,
+	}
+}
+
+// HandleEnroll starts enabling 2FA with a new secret, which only takes
+// effect once HandleConfirm has seen a first code for it.
+func (h *TwoFactorHandler) HandleEnroll(w http.ResponseWriter, r *http.Request) {
+	if h.twoFactor.cipher == nil {
+		utils.WriteJSON(w, http.StatusNotImplemented, utils.Envelope{"error": errTwoFactorUnavailable.Error()})
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "generating TOTP secret", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	sealed, err := h.twoFactor.cipher.Encrypt([]byte(secret), secretData(currentUser.ID))
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "encrypting TOTP secret", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	err = h.twoFactor.store.SaveTOTPSecret(r.Context(), currentUser.ID, sealed)
+	if errors.Is(err, store.ErrTwoFactorEnabled) {
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "saveTOTPSecret", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{
+		"secret":      secret,
+		"otpauth_uri": totp.URI(totpIssuer, currentUser.Username, secret),
+	})
+}
+
+// HandleConfirm turns 2FA on once the user proves their authenticator has
+// the secret, and hands out the recovery codes. They are only ever shown here.
+// Wrong codes count towards the login lockout, as they do on HandleDisable.
+func (h *TwoFactorHandler) HandleConfirm(w http.ResponseWriter, r *http.Request) {
+	var req twoFactorCodeRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "decodingConfirmTwoFactor", "error", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request sent"})
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+	secret, err := h.twoFactor.store.GetTOTP(r.Context(), currentUser.ID)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "getTOTP", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	if secret == nil {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "no two-factor enrollment in progress"})
+		return
+	}
+	if secret.Enabled() {
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": store.ErrTwoFactorEnabled.Error()})
+		return
+	}
+
+	if h.attempts.lockedOut(w, r, currentUser.ID) {
+		return
+	}
+
+	plain, err := h.twoFactor.decryptSecret(secret)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "decrypting TOTP secret", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	step, ok := totp.Validate(plain, req.Code, time.Now())
+	if !ok {
+		h.attempts.record(r, currentUser.ID)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid code"})
+		return
+	}
+
+	codes, err := totp.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "generating recovery codes", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	hashes := make([][]byte, len(codes))
+	for i, code := range codes {
+		hashes[i] = tokens.Hash(totp.NormalizeRecoveryCode(code))
+	}
+
+	err = h.twoFactor.store.EnableTOTP(r.Context(), currentUser.ID, step, hashes)
+	if errors.Is(err, store.ErrTwoFactorEnabled) {
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "enableTOTP", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"recovery_codes": codes})
+}
+
+// HandleDisable turns 2FA off, which takes a valid code like a login does.
+func (h *TwoFactorHandler) HandleDisable(w http.ResponseWriter, r *http.Request) {
+	var req twoFactorCodeRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "decodingDisableTwoFactor", "error", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request sent"})
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+	secret, err := h.twoFactor.store.GetTOTP(r.Context(), currentUser.ID)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "getTOTP", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	if !secret.Enabled() {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "two-factor authentication is not enabled"})
+		return
+	}
+
+	if h.attempts.lockedOut(w, r, currentUser.ID) {
+		return
+	}
+
+	ok, err := h.twoFactor.verify(r.Context(), secret, req)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "verifying 2FA code", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	if !ok {
+		h.attempts.record(r, currentUser.ID)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid code"})
+		return
+	}
+
+	err = h.twoFactor.store.DisableTOTP(r.Context(), currentUser.ID)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "disableTOTP", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusNoContent, utils.Envelope{"message": "two-factor authentication disabled successfully"})
+}
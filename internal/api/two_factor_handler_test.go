@@ -0,0 +1,102 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dapoadedire/fem_project/internal/encryption"
+	"github.com/dapoadedire/fem_project/internal/middleware"
+	"github.com/dapoadedire/fem_project/internal/store"
+	"github.com/dapoadedire/fem_project/internal/totp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeTwoFactorStore struct {
+	store.TwoFactorStore
+	secret   *store.TOTP
+	enabled  int
+	disabled int
+}
+
+func (s *fakeTwoFactorStore) GetTOTP(ctx context.Context, userID int) (*store.TOTP, error) {
+	return s.secret, nil
+}
+
+func (s *fakeTwoFactorStore) EnableTOTP(ctx context.Context, userID int, step int64, recoveryCodeHashes [][]byte) error {
+	s.enabled++
+	return nil
+}
+
+func (s *fakeTwoFactorStore) UseTOTPStep(ctx context.Context, userID int, step int64) (bool, error) {
+	return true, nil
+}
+
+func (s *fakeTwoFactorStore) UseRecoveryCode(ctx context.Context, userID int, hash []byte) (bool, error) {
+	return false, nil
+}
+
+func (s *fakeTwoFactorStore) DisableTOTP(ctx context.Context, userID int) error {
+	s.disabled++
+	return nil
+}
+
+func TestTwoFactorCodesCountFailures(t *testing.T) {
+	tests := []struct {
+		name    string
+		enabled bool
+		handler func(h *TwoFactorHandler) http.HandlerFunc
+	}{
+		{"confirm", false, func(h *TwoFactorHandler) http.HandlerFunc { return h.HandleConfirm }},
+		{"disable", true, func(h *TwoFactorHandler) http.HandlerFunc { return h.HandleDisable }},
+	}
+
+	cipher, err := encryption.NewCipher(make([]byte, encryption.KeySize))
+	require.NoError(t, err)
+	plain, err := totp.GenerateSecret()
+	require.NoError(t, err)
+	sealed, err := cipher.Encrypt([]byte(plain), secretData(1))
+	require.NoError(t, err)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			secret := &store.TOTP{UserID: 1, Secret: sealed}
+			if tt.enabled {
+				enabledAt := time.Now()
+				secret.EnabledAt = &enabledAt
+			}
+			twoFactorStore := &fakeTwoFactorStore{secret: secret}
+			loginAttempts := &fakeLoginAttemptStore{}
+			h := NewTwoFactorHandler(twoFactorStore, loginAttempts, cipher, discardLogger)
+
+			send := func(code string) *httptest.ResponseRecorder {
+				req := httptest.NewRequest(http.MethodPost, "/users/me/2fa", strings.NewReader(`{"code": "`+code+`"}`))
+				req = middleware.SetUser(req, &store.User{ID: 1})
+				res := httptest.NewRecorder()
+				tt.handler(h)(res, req)
+				return res
+			}
+
+			// a code from long ago is never valid
+			wrong, err := totp.Code(plain, totp.Step(time.Now())-100)
+			require.NoError(t, err)
+			assert.Equal(t, http.StatusBadRequest, send(wrong).Code)
+			assert.Equal(t, []int{1}, loginAttempts.failed)
+
+			// once locked out, not even the right code is checked
+			right, err := totp.Code(plain, totp.Step(time.Now()))
+			require.NoError(t, err)
+			lockedUntil := time.Now().Add(time.Minute)
+			loginAttempts.lockedUntil = &lockedUntil
+			res := send(right)
+			assert.Equal(t, http.StatusTooManyRequests, res.Code)
+			assert.Equal(t, "60", res.Header().Get("Retry-After"))
+			assert.Zero(t, twoFactorStore.enabled)
+			assert.Zero(t, twoFactorStore.disabled)
+		})
+	}
+}
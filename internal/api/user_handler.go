@@ -1,15 +1,21 @@
 package api
 
 import (
+	"context"
+	"database/sql"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"net/mail"
 	"strings"
+	"time"
 
+	"github.com/dapoadedire/fem_project/internal/mailer"
+	"github.com/dapoadedire/fem_project/internal/middleware"
 	"github.com/dapoadedire/fem_project/internal/store"
+	"github.com/dapoadedire/fem_project/internal/tokens"
 	"github.com/dapoadedire/fem_project/internal/utils"
 )
 
@@ -23,70 +29,135 @@ type registeredUserRequest struct {
 	ProfilePicture string `json:"profile_picture"`
 }
 
+type activateUserRequest struct {
+	Token string `json:"token"`
+}
+
+type resendActivationRequest struct {
+	Email string `json:"email"`
+}
+
+// updateUserRequest is a partial update: fields left out keep their value.
+// Changing the username or email address also takes the current password.
+type updateUserRequest struct {
+	CurrentPassword string  `json:"current_password"`
+	Username        *string `json:"username"`
+	Email           *string `json:"email"`
+	Bio             *string `json:"bio"`
+	FirstName       *string `json:"first_name"`
+	LastName        *string `json:"last_name"`
+	ProfilePicture  *string `json:"profile_picture"`
+}
+
+type changePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+type deleteUserRequest struct {
+	Password string `json:"password"`
+}
+
 type UserHandler struct {
-	userStore store.UserStore
-	logger    *log.Logger
+	userStore     store.UserStore
+	tokenStore    store.TokenStore
+	blobStore     store.BlobStore
+	mailer        mailer.Mailer
+	bcryptCost    int
+	activationTTL time.Duration
+	logger        *slog.Logger
+	background    background
+	attempts      failedAttempts
 }
 
-func NewUserHandler(userStore store.UserStore, logger *log.Logger) *UserHandler {
+func NewUserHandler(userStore store.UserStore, tokenStore store.TokenStore, loginAttemptStore store.LoginAttemptStore, blobStore store.BlobStore, m mailer.Mailer, bcryptCost int, activationTTL time.Duration, logger *slog.Logger) *UserHandler {
 	return &UserHandler{
-		userStore: userStore,
-		logger:    logger,
+		userStore:     userStore,
+		tokenStore:    tokenStore,
+		blobStore:     blobStore,
+		mailer:        m,
+		bcryptCost:    bcryptCost,
+		activationTTL: activationTTL,
+		logger:        logger,
+		attempts:      failedAttempts{store: loginAttemptStore, logger: logger},
 	}
 }
 
-func (h *UserHandler) validateRegisterRequest(reg *registeredUserRequest) error {
-	const (
-		minUsernameLength = 3
-		maxUsernameLength = 30
-		minPasswordLength = 8
-		minNameLength     = 2
-	)
+const (
+	minUsernameLength       = 3
+	maxUsernameLength       = 30
+	minNameLength           = 2
+	maxProfilePictureLength = 255
+)
 
+func (h *UserHandler) validateRegisterRequest(reg *registeredUserRequest) error {
 	// Trim input to avoid leading/trailing whitespace issues
 	reg.Username = strings.TrimSpace(reg.Username)
 	reg.Email = strings.TrimSpace(reg.Email)
 	reg.FirstName = strings.TrimSpace(reg.FirstName)
 	reg.LastName = strings.TrimSpace(reg.LastName)
 
-	// Username validation
-	if reg.Username == "" {
+	if err := validateUsername(reg.Username); err != nil {
+		return err
+	}
+	if err := validateEmail(reg.Email); err != nil {
+		return err
+	}
+	if err := validatePassword(reg.Password); err != nil {
+		return err
+	}
+	if err := validateName("first name", reg.FirstName); err != nil {
+		return err
+	}
+	if err := validateName("last name", reg.LastName); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// validateUsername, validateEmail and validateName check fields of a new
+// user, or of a profile update.
+func validateUsername(username string) error {
+	if username == "" {
 		return errors.New("username is required")
 	}
-	if len(reg.Username) < minUsernameLength {
+	if len(username) < minUsernameLength {
 		return errors.New(fmt.Sprintf("username must be at least %d characters long", minUsernameLength))
 	}
-	if len(reg.Username) > maxUsernameLength {
+	if len(username) > maxUsernameLength {
 		return errors.New(fmt.Sprintf("username must be at most %d characters long", maxUsernameLength))
 	}
+	return nil
+}
 
-	// Email validation
-	if reg.Email == "" {
+func validateEmail(email string) error {
+	if email == "" {
 		return errors.New("email is required")
 	}
-	if _, err := mail.ParseAddress(reg.Email); err != nil {
+	if _, err := mail.ParseAddress(email); err != nil {
 		return errors.New("invalid email address")
 	}
-	
+	return nil
+}
 
-	// Password validation
-	if reg.Password == "" {
-		return errors.New("password is required")
-	}
-	if len(reg.Password) < minPasswordLength {
-		return errors.New(fmt.Sprintf("password must be at least %d characters long", minPasswordLength))
+func validateName(field, name string) error {
+	if len(name) < minNameLength {
+		return errors.New(fmt.Sprintf("%s must be at least %d characters long", field, minNameLength))
 	}
+	return nil
+}
 
-	// First name validation
-	if len(reg.FirstName) < minNameLength {
-		return errors.New(fmt.Sprintf("first name must be at least %d characters long", minNameLength))
-	}
+// validatePassword checks a new password, wherever it is set.
+func validatePassword(password string) error {
+	const minPasswordLength = 8
 
-	// Last name validation
-	if len(reg.LastName) < minNameLength {
-		return errors.New(fmt.Sprintf("last name must be at least %d characters long", minNameLength))
+	if password == "" {
+		return errors.New("password is required")
+	}
+	if len(password) < minPasswordLength {
+		return fmt.Errorf("password must be at least %d characters long", minPasswordLength)
 	}
-
 	return nil
 }
 
@@ -94,14 +165,14 @@ func (h *UserHandler) HandleRegisterUser(w http.ResponseWriter, r *http.Request)
 	var regRequest registeredUserRequest
 	err := json.NewDecoder(r.Body).Decode(&regRequest)
 	if err != nil {
-		h.logger.Printf("ERROR: decoding register request: %v", err)
+		h.logger.ErrorContext(r.Context(), "decoding register request", "error", err)
 		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request sent"})
 		return
 	}
 
 	err = h.validateRegisterRequest(&regRequest)
 	if err != nil {
-		h.logger.Printf("ERROR: validating register request: %v", err)
+		h.logger.ErrorContext(r.Context(), "validating register request", "error", err)
 		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
 		return
 	}
@@ -114,19 +185,352 @@ func (h *UserHandler) HandleRegisterUser(w http.ResponseWriter, r *http.Request)
 		LastName:       regRequest.LastName,
 		ProfilePicture: regRequest.ProfilePicture,
 	}
-	err = user.PasswordHash.SetPassword(regRequest.Password)
+	err = user.PasswordHash.SetPasswordWithCost(regRequest.Password, h.bcryptCost)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "setting password hash", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	err = h.userStore.CreateUser(r.Context(), user)
+	if errors.Is(err, store.ErrDuplicateUsername) || errors.Is(err, store.ErrDuplicateEmail) {
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "creating user", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	// the account exists either way; if the email does not go out the user can
+	// ask for another one with POST /users/activation
+	err = h.sendActivationEmail(r.Context(), user)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "sending activation email", "error", err)
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"message": "user created successfully, check your email to activate your account"})
+}
+
+// sendActivationEmail mails the user a fresh activation token, voiding any
+// sent before.
+func (h *UserHandler) sendActivationEmail(ctx context.Context, user *store.User) error {
+	err := h.tokenStore.DeleteAllTokensForUser(ctx, user.ID, tokens.ScopeActivation)
+	if err != nil {
+		return err
+	}
+	token, err := h.tokenStore.CreateNewToken(ctx, user.ID, h.activationTTL, tokens.ScopeActivation)
+	if err != nil {
+		return err
+	}
+
+	msg, err := mailer.NewMessage(user.Email, "activation.tmpl", map[string]interface{}{
+		"Username": user.Username,
+		"Token":    token.PlainText,
+		"TTL":      h.activationTTL,
+	})
+	if err != nil {
+		return err
+	}
+	return h.mailer.Send(ctx, msg)
+}
+
+// sendEmailChangedNotice tells the previous address of the user that their
+// email address was changed, in case it was not them.
+func (h *UserHandler) sendEmailChangedNotice(ctx context.Context, user *store.User, oldEmail string) error {
+	msg, err := mailer.NewMessage(oldEmail, "email_changed.tmpl", map[string]interface{}{
+		"Username": user.Username,
+		"NewEmail": user.Email,
+	})
+	if err != nil {
+		return err
+	}
+	return h.mailer.Send(ctx, msg)
+}
+
+// HandleResendActivation mails a new activation token to the account with the
+// given address if it is not activated yet. Like HandleRequestPasswordReset it
+// answers the same either way, sending the email in the background.
+func (h *UserHandler) HandleResendActivation(w http.ResponseWriter, r *http.Request) {
+	var req resendActivationRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "decodingResendActivation", "error", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request sent"})
+		return
+	}
+	req.Email = strings.TrimSpace(req.Email)
+	if _, err := mail.ParseAddress(req.Email); err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid email address"})
+		return
+	}
+
+	user, err := h.userStore.GetUserByEmail(r.Context(), req.Email)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "getUserByEmail", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	if user != nil && !user.Activated {
+		h.background.run(r, h.logger, "sending activation email", func(ctx context.Context) error {
+			return h.sendActivationEmail(ctx, user)
+		})
+	}
+
+	utils.WriteJSON(w, http.StatusAccepted, utils.Envelope{"message": "if an inactive account with this email exists, an activation email has been sent"})
+}
+
+// Wait blocks until the activation and email change emails being sent have
+// gone out.
+func (h *UserHandler) Wait() {
+	h.background.wait()
+}
+
+// HandleActivateUser activates the account an activation token was mailed to.
+func (h *UserHandler) HandleActivateUser(w http.ResponseWriter, r *http.Request) {
+	var req activateUserRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "decodingActivateUser", "error", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request sent"})
+		return
+	}
+	if req.Token == "" {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "token is required"})
+		return
+	}
+
+	user, err := h.userStore.GetUserToken(r.Context(), tokens.ScopeActivation, req.Token)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "getUserToken", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	if user == nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid or expired activation token"})
+		return
+	}
+
+	user.Activated = true
+	err = h.userStore.UpdateUser(r.Context(), user)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "updateUser", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	err = h.tokenStore.DeleteAllTokensForUser(r.Context(), user.ID, tokens.ScopeActivation)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "deleteAllTokensForUser", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"user": user})
+}
+
+func (h *UserHandler) HandleGetCurrentUser(w http.ResponseWriter, r *http.Request) {
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"user": middleware.GetUser(r)})
+}
+
+// HandleUpdateCurrentUser changes the fields of the user's profile that are
+// in the request. A new email address has to be confirmed again, so changing
+// it deactivates the account until the user follows the activation email, and
+// the old address is told about the change.
+func (h *UserHandler) HandleUpdateCurrentUser(w http.ResponseWriter, r *http.Request) {
+	var req updateUserRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "decodingUpdateUser", "error", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request sent"})
+		return
+	}
+
+	user := middleware.GetUser(r)
+	oldUsername, oldEmail := user.Username, user.Email
+	emailChanged := false
+	if req.Username != nil {
+		username := strings.TrimSpace(*req.Username)
+		if err := validateUsername(username); err != nil {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+			return
+		}
+		user.Username = username
+	}
+	if req.Email != nil {
+		email := strings.TrimSpace(*req.Email)
+		if err := validateEmail(email); err != nil {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+			return
+		}
+		if !strings.EqualFold(email, user.Email) {
+			emailChanged = true
+			user.Activated = false
+		}
+		user.Email = email
+	}
+	if req.Bio != nil {
+		user.Bio = *req.Bio
+	}
+	if req.FirstName != nil {
+		firstName := strings.TrimSpace(*req.FirstName)
+		if err := validateName("first name", firstName); err != nil {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+			return
+		}
+		user.FirstName = firstName
+	}
+	if req.LastName != nil {
+		lastName := strings.TrimSpace(*req.LastName)
+		if err := validateName("last name", lastName); err != nil {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+			return
+		}
+		user.LastName = lastName
+	}
+	if req.ProfilePicture != nil {
+		if len(*req.ProfilePicture) > maxProfilePictureLength {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": fmt.Sprintf("profile picture must be at most %d characters long", maxProfilePictureLength)})
+			return
+		}
+		user.ProfilePicture = *req.ProfilePicture
+	}
+
+	// whoever controls the email address can reset the password, so a stolen
+	// session alone must not be enough to change it
+	if user.Username != oldUsername || user.Email != oldEmail {
+		if !h.checkPassword(w, r, user, req.CurrentPassword) {
+			return
+		}
+	}
+
+	err = h.userStore.UpdateUser(r.Context(), user)
+	if errors.Is(err, store.ErrDuplicateUsername) || errors.Is(err, store.ErrDuplicateEmail) {
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "updateUser", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	if emailChanged {
+		// a copy, as the response is still being written from user
+		changed := *user
+		h.background.run(r, h.logger, "sending email change emails", func(ctx context.Context) error {
+			return errors.Join(
+				h.sendActivationEmail(ctx, &changed),
+				h.sendEmailChangedNotice(ctx, &changed, oldEmail),
+			)
+		})
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"user": user})
+}
+
+// HandleChangePassword sets a new password for a user who knows the current
+// one. Every session is logged out, the one the request was made with
+// included, just like after a password reset.
+func (h *UserHandler) HandleChangePassword(w http.ResponseWriter, r *http.Request) {
+	var req changePasswordRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "decodingChangePassword", "error", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request sent"})
+		return
+	}
+	err = validatePassword(req.NewPassword)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	user := middleware.GetUser(r)
+	if !h.checkPassword(w, r, user, req.CurrentPassword) {
+		return
+	}
+
+	err = user.PasswordHash.SetPasswordWithCost(req.NewPassword, h.bcryptCost)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "setting password hash", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	err = h.userStore.UpdateUser(r.Context(), user)
 	if err != nil {
-		h.logger.Printf("ERROR: setting password hash: %v", err)
+		h.logger.ErrorContext(r.Context(), "updateUser", "error", err)
 		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
 		return
 	}
 
-	err = h.userStore.CreateUser(user)
+	for _, scope := range []string{tokens.ScopeAuth, tokens.ScopeRefresh, tokens.Scope2FAPending, tokens.ScopePasswordReset} {
+		err = h.tokenStore.DeleteAllTokensForUser(r.Context(), user.ID, scope)
+		if err != nil {
+			h.logger.ErrorContext(r.Context(), "deleteAllTokensForUser", "error", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+			return
+		}
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"message": "password changed successfully, log in again"})
+}
+
+// HandleDeleteCurrentUser deletes the user's account after checking their
+// password. Their workouts, avatar and everything else they own are deleted
+// with it.
+func (h *UserHandler) HandleDeleteCurrentUser(w http.ResponseWriter, r *http.Request) {
+	var req deleteUserRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
 	if err != nil {
-		h.logger.Printf("ERROR: creating user: %v", err)
+		h.logger.ErrorContext(r.Context(), "decodingDeleteUser", "error", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request sent"})
+		return
+	}
+
+	user := middleware.GetUser(r)
+	if !h.checkPassword(w, r, user, req.Password) {
+		return
+	}
+
+	err = h.userStore.DeleteUser(r.Context(), user.ID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		h.logger.ErrorContext(r.Context(), "deleteUser", "error", err)
 		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
 		return
 	}
 
-	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"message": "user created successfully"})
+	// avatars are served to anyone who knows the key, so they go as well
+	if dir := ownAvatarDir(user.ID, user.ProfilePicture); dir != "" {
+		deleteAvatar(r, h.blobStore, h.logger, dir)
+	}
+
+	utils.WriteJSON(w, http.StatusNoContent, utils.Envelope{"message": "user deleted successfully"})
+}
+
+// checkPassword makes sure a sensitive change is made by someone who knows
+// the user's password, writing the error response if not. Wrong passwords
+// count towards the same lockout as failed logins.
+func (h *UserHandler) checkPassword(w http.ResponseWriter, r *http.Request, user *store.User, password string) bool {
+	if password == "" {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "password is required"})
+		return false
+	}
+	if h.attempts.lockedOut(w, r, user.ID) {
+		return false
+	}
+	matches, err := user.PasswordHash.Matches(password)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "matching password", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return false
+	}
+	if !matches {
+		h.attempts.record(r, user.ID)
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "invalid password"})
+		return false
+	}
+	return true
 }
@@ -0,0 +1,328 @@
+package api
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dapoadedire/fem_project/internal/mailer"
+	"github.com/dapoadedire/fem_project/internal/middleware"
+	"github.com/dapoadedire/fem_project/internal/store"
+	"github.com/dapoadedire/fem_project/internal/tokens"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var discardLogger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+type fakeUserStore struct {
+	store.UserStore
+	// user is found by its email address and by any token
+	user      *store.User
+	updateErr error
+	updated   []store.User
+	deleted   []int
+}
+
+func (s *fakeUserStore) GetUserByEmail(ctx context.Context, email string) (*store.User, error) {
+	if s.user != nil && strings.EqualFold(s.user.Email, email) {
+		return s.user, nil
+	}
+	return nil, nil
+}
+
+func (s *fakeUserStore) GetUserByUsername(ctx context.Context, username string) (*store.User, error) {
+	if s.user != nil && s.user.Username == username {
+		return s.user, nil
+	}
+	return nil, nil
+}
+
+func (s *fakeUserStore) GetUserToken(ctx context.Context, scope, token string) (*store.User, error) {
+	return s.user, nil
+}
+
+func (s *fakeUserStore) UpdateUser(ctx context.Context, user *store.User) error {
+	if s.updateErr != nil {
+		return s.updateErr
+	}
+	s.updated = append(s.updated, *user)
+	return nil
+}
+
+func (s *fakeUserStore) DeleteUser(ctx context.Context, id int) error {
+	s.deleted = append(s.deleted, id)
+	return nil
+}
+
+type fakeTokenStore struct {
+	store.TokenStore
+	rotateErr error
+	created   []string
+	revoked   []string
+}
+
+func (s *fakeTokenStore) RotateRefreshToken(ctx context.Context, hash []byte, access, refresh *tokens.Token) error {
+	if s.rotateErr != nil {
+		return s.rotateErr
+	}
+	access.UserID, refresh.UserID = 1, 1
+	return nil
+}
+
+func (s *fakeTokenStore) CreateNewToken(ctx context.Context, userID int, ttl time.Duration, scope string) (*tokens.Token, error) {
+	s.created = append(s.created, scope)
+	return tokens.GenerateToken(userID, ttl, scope)
+}
+
+func (s *fakeTokenStore) DeleteAllTokensForUser(ctx context.Context, userID int, scope string) error {
+	s.revoked = append(s.revoked, scope)
+	return nil
+}
+
+type fakeBlobStore struct {
+	store.BlobStore
+	deleted []string
+}
+
+func (s *fakeBlobStore) DeleteBlob(ctx context.Context, key string) error {
+	s.deleted = append(s.deleted, key)
+	return nil
+}
+
+func newTestUserHandler() (*UserHandler, *fakeUserStore, *fakeTokenStore, *mailer.MemoryMailer) {
+	userStore := &fakeUserStore{}
+	tokenStore := &fakeTokenStore{}
+	m := mailer.NewMemory()
+	return NewUserHandler(userStore, tokenStore, &fakeLoginAttemptStore{}, &fakeBlobStore{}, m, bcrypt.MinCost, time.Hour, discardLogger), userStore, tokenStore, m
+}
+
+func newTestUser(t *testing.T) *store.User {
+	user := &store.User{ID: 1, Username: "alice", Email: "alice@example.com", FirstName: "Alice", LastName: "Smith", Activated: true}
+	require.NoError(t, user.PasswordHash.SetPasswordWithCost("password123", bcrypt.MinCost))
+	return user
+}
+
+// serveAs calls handler with body as the given user would.
+func serveAs(handler http.HandlerFunc, user *store.User, method, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, "/users/me", strings.NewReader(body))
+	req = middleware.SetUser(req, user)
+	res := httptest.NewRecorder()
+	handler(res, req)
+	return res
+}
+
+func TestResendActivation(t *testing.T) {
+	tests := []struct {
+		name      string
+		email     string
+		activated bool
+		sent      int
+	}{
+		{"inactive account", "alice@example.com", false, 1},
+		{"active account", "alice@example.com", true, 0},
+		{"unknown address", "bob@example.com", false, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, userStore, _, m := newTestUserHandler()
+			userStore.user = newTestUser(t)
+			userStore.user.Activated = tt.activated
+
+			req := httptest.NewRequest(http.MethodPost, "/users/activation", strings.NewReader(`{"email": "`+tt.email+`"}`))
+			res := httptest.NewRecorder()
+			h.HandleResendActivation(res, req)
+			h.Wait()
+
+			assert.Equal(t, http.StatusAccepted, res.Code)
+			assert.Len(t, m.Messages(), tt.sent)
+		})
+	}
+}
+
+func TestGetCurrentUser(t *testing.T) {
+	h, _, _, _ := newTestUserHandler()
+	res := serveAs(h.HandleGetCurrentUser, newTestUser(t), http.MethodGet, "")
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Contains(t, res.Body.String(), `"username": "alice"`)
+	assert.NotContains(t, res.Body.String(), "password")
+	assert.NotContains(t, res.Body.String(), "workouts")
+}
+
+func TestUpdateCurrentUserValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		code int
+	}{
+		{"short username", `{"username": "al", "current_password": "password123"}`, http.StatusBadRequest},
+		{"invalid email", `{"email": "alice", "current_password": "password123"}`, http.StatusBadRequest},
+		{"short first name", `{"first_name": "A"}`, http.StatusBadRequest},
+		{"short last name", `{"last_name": " S "}`, http.StatusBadRequest},
+		{"long profile picture", `{"profile_picture": "` + strings.Repeat("x", 256) + `"}`, http.StatusBadRequest},
+		{"username without password", `{"username": "alicia"}`, http.StatusBadRequest},
+		{"email with wrong password", `{"email": "eve@example.com", "current_password": "wrong password"}`, http.StatusUnauthorized},
+		{"bio without password", `{"bio": "lifts things"}`, http.StatusOK},
+		{"same username without password", `{"username": "alice"}`, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, userStore, _, m := newTestUserHandler()
+			res := serveAs(h.HandleUpdateCurrentUser, newTestUser(t), http.MethodPatch, tt.body)
+			assert.Equal(t, tt.code, res.Code, res.Body.String())
+			if tt.code != http.StatusOK {
+				assert.Empty(t, userStore.updated)
+			}
+			assert.Empty(t, m.Messages())
+		})
+	}
+}
+
+func TestUpdateCurrentUserConflict(t *testing.T) {
+	for _, err := range []error{store.ErrDuplicateUsername, store.ErrDuplicateEmail} {
+		h, userStore, _, m := newTestUserHandler()
+		userStore.updateErr = err
+		res := serveAs(h.HandleUpdateCurrentUser, newTestUser(t), http.MethodPatch,
+			`{"username": "bob", "email": "bob@example.com", "current_password": "password123"}`)
+		assert.Equal(t, http.StatusConflict, res.Code)
+		assert.Contains(t, res.Body.String(), err.Error())
+		assert.Empty(t, m.Messages())
+	}
+}
+
+func TestUpdateCurrentUserEmail(t *testing.T) {
+	h, userStore, tokenStore, m := newTestUserHandler()
+	res := serveAs(h.HandleUpdateCurrentUser, newTestUser(t), http.MethodPatch,
+		`{"email": " alice@new.example.com ", "current_password": "password123"}`)
+	require.Equal(t, http.StatusOK, res.Code, res.Body.String())
+	h.Wait()
+
+	// the new address has to be verified before the account can write again
+	require.Len(t, userStore.updated, 1)
+	assert.Equal(t, "alice@new.example.com", userStore.updated[0].Email)
+	assert.False(t, userStore.updated[0].Activated)
+	assert.Equal(t, []string{tokens.ScopeActivation}, tokenStore.created)
+
+	messages := m.Messages()
+	require.Len(t, messages, 2)
+	assert.Equal(t, "alice@new.example.com", messages[0].To)
+	assert.Equal(t, "alice@example.com", messages[1].To)
+	assert.Contains(t, messages[1].Body, "alice@new.example.com")
+
+	// the emails are sent after the response, so failing them does not fail it
+	h.mailer = failingMailer{}
+	res = serveAs(h.HandleUpdateCurrentUser, newTestUser(t), http.MethodPatch,
+		`{"email": "alice@other.example.com", "current_password": "password123"}`)
+	assert.Equal(t, http.StatusOK, res.Code, res.Body.String())
+	h.Wait()
+}
+
+func TestChangePassword(t *testing.T) {
+	h, userStore, tokenStore, _ := newTestUserHandler()
+	user := newTestUser(t)
+
+	res := serveAs(h.HandleChangePassword, user, http.MethodPut, `{"current_password": "password123", "new_password": "short"}`)
+	assert.Equal(t, http.StatusBadRequest, res.Code)
+	res = serveAs(h.HandleChangePassword, user, http.MethodPut, `{"current_password": "wrong password", "new_password": "new password"}`)
+	assert.Equal(t, http.StatusUnauthorized, res.Code)
+	assert.Empty(t, userStore.updated)
+
+	res = serveAs(h.HandleChangePassword, user, http.MethodPut, `{"current_password": "password123", "new_password": "new password"}`)
+	require.Equal(t, http.StatusOK, res.Code, res.Body.String())
+	require.Len(t, userStore.updated, 1)
+	matches, err := userStore.updated[0].PasswordHash.Matches("new password")
+	require.NoError(t, err)
+	assert.True(t, matches)
+	assert.Subset(t, tokenStore.revoked, []string{tokens.ScopeAuth, tokens.ScopeRefresh})
+}
+
+func TestDeleteCurrentUser(t *testing.T) {
+	h, userStore, _, _ := newTestUserHandler()
+	user := newTestUser(t)
+
+	res := serveAs(h.HandleDeleteCurrentUser, user, http.MethodDelete, `{}`)
+	assert.Equal(t, http.StatusBadRequest, res.Code)
+	res = serveAs(h.HandleDeleteCurrentUser, user, http.MethodDelete, `{"password": "wrong password"}`)
+	assert.Equal(t, http.StatusUnauthorized, res.Code)
+	assert.Empty(t, userStore.deleted)
+
+	res = serveAs(h.HandleDeleteCurrentUser, user, http.MethodDelete, `{"password": "password123"}`)
+	assert.Equal(t, http.StatusNoContent, res.Code)
+	assert.Equal(t, []int{1}, userStore.deleted)
+}
+
+func TestCheckPasswordCountsFailures(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler func(h *UserHandler) http.HandlerFunc
+		method  string
+		wrong   string
+		right   string
+	}{
+		{"update", func(h *UserHandler) http.HandlerFunc { return h.HandleUpdateCurrentUser }, http.MethodPatch,
+			`{"email": "alice@example.org", "current_password": "wrong password"}`,
+			`{"email": "alice@example.org", "current_password": "password123"}`},
+		{"change password", func(h *UserHandler) http.HandlerFunc { return h.HandleChangePassword }, http.MethodPut,
+			`{"current_password": "wrong password", "new_password": "new password"}`,
+			`{"current_password": "password123", "new_password": "new password"}`},
+		{"delete", func(h *UserHandler) http.HandlerFunc { return h.HandleDeleteCurrentUser }, http.MethodDelete,
+			`{"password": "wrong password"}`,
+			`{"password": "password123"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, userStore, _, _ := newTestUserHandler()
+			loginAttempts := &fakeLoginAttemptStore{}
+			h.attempts.store = loginAttempts
+			user := newTestUser(t)
+			userStore.user = user
+
+			res := serveAs(tt.handler(h), user, tt.method, tt.wrong)
+			assert.Equal(t, http.StatusUnauthorized, res.Code)
+			assert.Equal(t, []int{1}, loginAttempts.failed)
+
+			// once locked out, not even the right password is checked
+			lockedUntil := time.Now().Add(time.Minute)
+			loginAttempts.lockedUntil = &lockedUntil
+			res = serveAs(tt.handler(h), newTestUser(t), tt.method, tt.right)
+			assert.Equal(t, http.StatusTooManyRequests, res.Code)
+			assert.Equal(t, "60", res.Header().Get("Retry-After"))
+			assert.Empty(t, userStore.updated)
+			assert.Empty(t, userStore.deleted)
+		})
+	}
+}
+
+func TestDeleteCurrentUserAvatar(t *testing.T) {
+	tests := []struct {
+		name    string
+		picture string
+		deleted []string
+	}{
+		{"uploaded avatar", "avatars/1/0123456789abcdef0123456789abcdef/256.jpg", []string{
+			"avatars/1/0123456789abcdef0123456789abcdef/256.jpg",
+			"avatars/1/0123456789abcdef0123456789abcdef/64.jpg",
+		}},
+		{"another user's avatar", "avatars/2/0123456789abcdef0123456789abcdef/256.jpg", nil},
+		{"external picture", "https://example.com/alice.png", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, _, _, _ := newTestUserHandler()
+			blobStore := &fakeBlobStore{}
+			h.blobStore = blobStore
+			user := newTestUser(t)
+			user.ProfilePicture = tt.picture
+
+			res := serveAs(h.HandleDeleteCurrentUser, user, http.MethodDelete, `{"password": "password123"}`)
+			assert.Equal(t, http.StatusNoContent, res.Code)
+			assert.Equal(t, tt.deleted, blobStore.deleted)
+		})
+	}
+}
@@ -3,7 +3,8 @@ package api
 import (
 	"database/sql"
 	"encoding/json"
-	"log"
+	"fmt"
+	"log/slog"
 	"net/http"
 
 	"github.com/dapoadedire/fem_project/internal/middleware"
@@ -14,10 +15,10 @@ import (
 
 type WorkoutHandler struct {
 	workoutStore store.WorkoutStore
-	logger       *log.Logger
+	logger       *slog.Logger
 }
 
-func NewWorkoutHandler(workoutStore store.WorkoutStore, logger *log.Logger) *WorkoutHandler {
+func NewWorkoutHandler(workoutStore store.WorkoutStore, logger *slog.Logger) *WorkoutHandler {
 	return &WorkoutHandler{
 		workoutStore: workoutStore,
 		logger:       logger,
@@ -28,30 +29,100 @@ func (wh *WorkoutHandler) HandleGetWorkoutByID(w http.ResponseWriter, r *http.Re
 
 	workoutID, err := utils.ReadIDParam(r)
 	if err != nil {
-		wh.logger.Printf("ERROR: readIDParam: %v", err)
+		wh.logger.ErrorContext(r.Context(), "readIDParam", "error", err)
 		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid workout ID"})
 		return
 	}
 
-	workout, err := wh.workoutStore.GetWorkoutByID(workoutID)
+	workout, err := wh.workoutStore.GetWorkoutByID(r.Context(), workoutID)
 	if err != nil {
-		wh.logger.Printf("ERROR: getWorkoutByID: %v", err)
+		wh.logger.ErrorContext(r.Context(), "getWorkoutByID", "error", err)
 		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
 		return
 	}
+	// another user's workout is answered like a missing one, so that its
+	// existence is not given away either
+	currentUser := middleware.GetUser(r)
+	if workout == nil || currentUser == nil || workout.UserID != currentUser.ID {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "workout not found"})
+		return
+	}
 
 	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"workout": workout})
 
 }
 
+func (wh *WorkoutHandler) HandleListWorkouts(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+
+	filter := store.WorkoutFilter{
+		UserID:   currentUser.ID,
+		Title:    r.URL.Query().Get("title"),
+		Exercise: r.URL.Query().Get("exercise"),
+		Sort:     r.URL.Query().Get("sort"),
+		Cursor:   r.URL.Query().Get("cursor"),
+	}
+
+	var err error
+	if filter.From, err = utils.ReadTimeQuery(r, "from"); err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+	if filter.To, err = utils.ReadTimeQuery(r, "to"); err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+	if filter.MinDuration, err = utils.ReadIntQuery(r, "min_duration"); err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+	if filter.MaxDuration, err = utils.ReadIntQuery(r, "max_duration"); err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+	if filter.ExerciseID, err = utils.ReadIntQuery(r, "exercise_id"); err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+	limit, err := utils.ReadIntQuery(r, "limit")
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+	if limit != nil {
+		if *limit < 1 || *limit > store.MaxWorkoutPageSize {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": fmt.Sprintf("limit must be between 1 and %d", store.MaxWorkoutPageSize)})
+			return
+		}
+		filter.Limit = *limit
+	}
+
+	workouts, nextCursor, err := wh.workoutStore.ListWorkouts(r.Context(), filter)
+	if err != nil {
+		if errors.Is(err, store.ErrInvalidCursor) || errors.Is(err, store.ErrInvalidSort) {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+			return
+		}
+		wh.logger.ErrorContext(r.Context(), "listWorkouts", "error", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"workouts": workouts, "next_cursor": nextCursor})
+}
+
 func (wh *WorkoutHandler) HandleCreateWorkout(w http.ResponseWriter, r *http.Request) {
 	var workout store.Workout
 	err := json.NewDecoder(r.Body).Decode(&workout)
 	if err != nil {
-		wh.logger.Printf("ERROR: decodingCreateWorkout: %v", err)
+		wh.logger.ErrorContext(r.Context(), "decodingCreateWorkout", "error", err)
 		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "1 invalid request sent"})
 		return
 	}
+	if err := validateEntries(workout.Entries); err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
 
 	currentUser := middleware.GetUser(r)
 	if currentUser == nil || currentUser == store.AnonymousUser {
@@ -60,25 +131,29 @@ func (wh *WorkoutHandler) HandleCreateWorkout(w http.ResponseWriter, r *http.Req
 	}
 	workout.UserID = currentUser.ID
 
-	createdWorkout, err := wh.workoutStore.CreateWorkout(&workout)
+	createdWorkout, err := wh.workoutStore.CreateWorkout(r.Context(), &workout)
+	if isInvalidWorkoutError(err) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
 	if err != nil {
-		wh.logger.Printf("ERROR: createWorkout: %v", err)
+		wh.logger.ErrorContext(r.Context(), "createWorkout", "error", err)
 		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "2 invalid request sent"})
 		return
 	}
-	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"workout": createdWorkout})
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"workout": createdWorkout, "new_records": createdWorkout.NewRecords})
 }
 
 func (wh *WorkoutHandler) HandleUpdateWorkoutByID(w http.ResponseWriter, r *http.Request) {
 	workoutID, err := utils.ReadIDParam(r)
 	if err != nil {
-		wh.logger.Printf("ERROR: readIDParam: %v", err)
+		wh.logger.ErrorContext(r.Context(), "readIDParam", "error", err)
 		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid workout update ID"})
 		return
 	}
-	exixtingWorkout, err := wh.workoutStore.GetWorkoutByID(workoutID)
+	exixtingWorkout, err := wh.workoutStore.GetWorkoutByID(r.Context(), workoutID)
 	if err != nil {
-		wh.logger.Printf("ERROR: getWorkoutByID: %v", err)
+		wh.logger.ErrorContext(r.Context(), "getWorkoutByID", "error", err)
 		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid workout update ID"})
 		return
 	}
@@ -100,10 +175,14 @@ func (wh *WorkoutHandler) HandleUpdateWorkoutByID(w http.ResponseWriter, r *http
 
 	err = json.NewDecoder(r.Body).Decode(&updateWorkoutRequest)
 	if err != nil {
-		wh.logger.Printf("ERROR: decodingUpdateRequest: %v", err)
+		wh.logger.ErrorContext(r.Context(), "decodingUpdateRequest", "error", err)
 		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request sent"})
 		return
 	}
+	if err := validateEntries(updateWorkoutRequest.Entries); err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
 
 	if updateWorkoutRequest.Title != nil {
 		exixtingWorkout.Title = *updateWorkoutRequest.Title
@@ -132,14 +211,14 @@ func (wh *WorkoutHandler) HandleUpdateWorkoutByID(w http.ResponseWriter, r *http
 		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "you must be logged in to update a workout"})
 		return
 	}
-	ownerID, err := wh.workoutStore.GetWorkoutOwner(workoutID)
+	ownerID, err := wh.workoutStore.GetWorkoutOwner(r.Context(), workoutID)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			wh.logger.Printf("ERROR: workout not found: %v", err)
+			wh.logger.ErrorContext(r.Context(), "workout not found", "error", err)
 			utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "workout not found"})
 			return
 		}
-		wh.logger.Printf("ERROR: getWorkoutOwner: %v", err)
+		wh.logger.ErrorContext(r.Context(), "getWorkoutOwner", "error", err)
 		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
 		return
 	}
@@ -148,19 +227,23 @@ func (wh *WorkoutHandler) HandleUpdateWorkoutByID(w http.ResponseWriter, r *http
 		return
 	}
 
-	err = wh.workoutStore.UpdateWorkout(exixtingWorkout)
+	err = wh.workoutStore.UpdateWorkout(r.Context(), exixtingWorkout)
+	if isInvalidWorkoutError(err) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
 	if err != nil {
-		wh.logger.Printf("ERROR: updateWorkoutByID: %v", err)
+		wh.logger.ErrorContext(r.Context(), "updateWorkoutByID", "error", err)
 		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
 		return
 	}
-	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"workout": exixtingWorkout})
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"workout": exixtingWorkout, "new_records": exixtingWorkout.NewRecords})
 }
 
 func (wh *WorkoutHandler) HandleDeleteWorkout(w http.ResponseWriter, r *http.Request) {
 	workoutID, err := utils.ReadIDParam(r)
 	if err != nil {
-		wh.logger.Printf("ERROR: readIDParam: %v", err)
+		wh.logger.ErrorContext(r.Context(), "readIDParam", "error", err)
 		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid workout ID"})
 		return
 	}
@@ -171,14 +254,14 @@ func (wh *WorkoutHandler) HandleDeleteWorkout(w http.ResponseWriter, r *http.Req
 		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "you must be logged in to update a workout"})
 		return
 	}
-	ownerID, err := wh.workoutStore.GetWorkoutOwner(workoutID)
+	ownerID, err := wh.workoutStore.GetWorkoutOwner(r.Context(), workoutID)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			wh.logger.Printf("ERROR: workout not found: %v", err)
+			wh.logger.ErrorContext(r.Context(), "workout not found", "error", err)
 			utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "workout not found"})
 			return
 		}
-		wh.logger.Printf("ERROR: getWorkoutOwner: %v", err)
+		wh.logger.ErrorContext(r.Context(), "getWorkoutOwner", "error", err)
 		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
 		return
 	}
@@ -187,16 +270,44 @@ func (wh *WorkoutHandler) HandleDeleteWorkout(w http.ResponseWriter, r *http.Req
 		return
 	}
 
-	err = wh.workoutStore.DeleteWorkout(workoutID)
+	err = wh.workoutStore.DeleteWorkout(r.Context(), workoutID)
 	if err == sql.ErrNoRows {
-		wh.logger.Printf("ERROR: workout not found: %v", err)
+		wh.logger.ErrorContext(r.Context(), "workout not found", "error", err)
 		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "workout not found"})
 		return
 	}
 	if err != nil {
-		wh.logger.Printf("ERROR: deleteWorkout: %v", err)
+		wh.logger.ErrorContext(r.Context(), "deleteWorkout", "error", err)
 		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
 		return
 	}
 	utils.WriteJSON(w, http.StatusNoContent, utils.Envelope{"message": "Workout deleted successfully"})
 }
+
+// validateEntries checks the entry fields the workout_entries table
+// constrains but the store doesn't, so they fail with 400 instead of 500.
+func validateEntries(entries []store.WorkoutEntry) error {
+	for _, entry := range entries {
+		if err := validateRPE(entry.OrderIndex, entry.RPE); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateRPE checks an entry's optional rpe against the 1 to 10 range the
+// entry tables allow.
+func validateRPE(orderIndex int, rpe *float64) error {
+	if rpe != nil && (*rpe < 1 || *rpe > 10) {
+		return fmt.Errorf("entry %d: rpe must be between 1 and 10", orderIndex)
+	}
+	return nil
+}
+
+// isInvalidWorkoutError reports whether err came from an entry that doesn't fit
+// the exercise catalog or a program day the user isn't enrolled in.
+func isInvalidWorkoutError(err error) bool {
+	return errors.Is(err, store.ErrExerciseNotFound) ||
+		errors.Is(err, store.ErrMeasurementMismatch) ||
+		errors.Is(err, store.ErrProgramDayNotFound)
+}
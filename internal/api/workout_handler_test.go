@@ -0,0 +1,120 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dapoadedire/fem_project/internal/middleware"
+	"github.com/dapoadedire/fem_project/internal/store"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func (s *fakeWorkoutStore) CreateWorkout(ctx context.Context, workout *store.Workout) (*store.Workout, error) {
+	s.created = append(s.created, workout)
+	return workout, nil
+}
+
+func (s *fakeWorkoutStore) GetWorkoutByID(ctx context.Context, id int64) (*store.Workout, error) {
+	for _, workout := range s.workouts {
+		if int64(workout.ID) == id {
+			return workout, nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *fakeWorkoutStore) GetWorkoutOwner(ctx context.Context, id int64) (int, error) {
+	return s.workouts[0].UserID, nil
+}
+
+func (s *fakeWorkoutStore) UpdateWorkout(ctx context.Context, workout *store.Workout) error {
+	s.updated = append(s.updated, workout)
+	return nil
+}
+
+func TestGetWorkoutByID(t *testing.T) {
+	tests := []struct {
+		name   string
+		id     string
+		status int
+	}{
+		{"own workout", "1", http.StatusOK},
+		{"another user's workout", "2", http.StatusNotFound},
+		{"missing workout", "3", http.StatusNotFound},
+	}
+
+	workoutStore := &fakeWorkoutStore{workouts: []*store.Workout{{ID: 1, UserID: 1, Title: "Push"}, {ID: 2, UserID: 2, Title: "Pull"}}}
+	handler := NewWorkoutHandler(workoutStore, discardLogger)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/workouts/"+tt.id, nil)
+			routeContext := chi.NewRouteContext()
+			routeContext.URLParams.Add("id", tt.id)
+			req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, routeContext))
+			req = middleware.SetUser(req, &store.User{ID: 1})
+			res := httptest.NewRecorder()
+			handler.HandleGetWorkoutByID(res, req)
+
+			assert.Equal(t, tt.status, res.Code)
+			if tt.status == http.StatusNotFound {
+				assert.NotContains(t, res.Body.String(), "Pull")
+			}
+		})
+	}
+}
+
+func TestWorkoutEntryRPE(t *testing.T) {
+	tests := []struct {
+		name   string
+		rpe    string
+		status int
+	}{
+		{"no rpe", "null", http.StatusOK},
+		{"lowest", "1", http.StatusOK},
+		{"highest", "10", http.StatusOK},
+		{"too low", "0.5", http.StatusBadRequest},
+		{"too high", "10.5", http.StatusBadRequest},
+	}
+
+	user := &store.User{ID: 1}
+	for _, tt := range tests {
+		body := `{"title": "Push", "entries": [{"exercise_name": "Bench Press", "sets": 3, "reps": 5, "rpe": ` + tt.rpe + `, "order_index": 1}]}`
+
+		t.Run("create "+tt.name, func(t *testing.T) {
+			workoutStore := &fakeWorkoutStore{}
+			handler := NewWorkoutHandler(workoutStore, discardLogger)
+
+			req := httptest.NewRequest(http.MethodPost, "/workouts", strings.NewReader(body))
+			req = middleware.SetUser(req, user)
+			res := httptest.NewRecorder()
+			handler.HandleCreateWorkout(res, req)
+
+			status := tt.status
+			if status == http.StatusOK {
+				status = http.StatusCreated
+			}
+			assert.Equal(t, status, res.Code)
+			assert.Equal(t, status == http.StatusCreated, len(workoutStore.created) == 1)
+		})
+
+		t.Run("update "+tt.name, func(t *testing.T) {
+			workoutStore := &fakeWorkoutStore{workouts: []*store.Workout{{ID: 1, UserID: user.ID, Title: "Push"}}}
+			handler := NewWorkoutHandler(workoutStore, discardLogger)
+
+			req := httptest.NewRequest(http.MethodPut, "/workouts/1", strings.NewReader(body))
+			routeContext := chi.NewRouteContext()
+			routeContext.URLParams.Add("id", "1")
+			req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, routeContext))
+			req = middleware.SetUser(req, user)
+			res := httptest.NewRecorder()
+			handler.HandleUpdateWorkoutByID(res, req)
+
+			assert.Equal(t, tt.status, res.Code)
+			assert.Equal(t, tt.status == http.StatusOK, len(workoutStore.updated) == 1)
+		})
+	}
+}
@@ -1,30 +1,83 @@
 package app
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
+	"net/netip"
 	"os"
+	"time"
 
 	"github.com/dapoadedire/fem_project/internal/api"
-	"github.com/dapoadedire/fem_project/internal/store"
+	"github.com/dapoadedire/fem_project/internal/config"
+	"github.com/dapoadedire/fem_project/internal/encryption"
+	"github.com/dapoadedire/fem_project/internal/health"
+	"github.com/dapoadedire/fem_project/internal/lifecycle"
+	"github.com/dapoadedire/fem_project/internal/logging"
+	"github.com/dapoadedire/fem_project/internal/mailer"
+	"github.com/dapoadedire/fem_project/internal/metrics"
 	"github.com/dapoadedire/fem_project/internal/middleware"
+	"github.com/dapoadedire/fem_project/internal/ratelimit"
+	"github.com/dapoadedire/fem_project/internal/store"
+	"github.com/dapoadedire/fem_project/internal/tracing"
 	"github.com/dapoadedire/fem_project/migrations"
 )
 
-
 type Application struct {
-	Logger         *log.Logger
-	WorkoutHandler *api.WorkoutHandler
-	UserHandler    *api.UserHandler
-	TokenHandler   *api.TokenHandler
-	Middleware     middleware.UserMiddleware
-	DB             *sql.DB
+	Config               *config.Config
+	Logger               *slog.Logger
+	WorkoutHandler       *api.WorkoutHandler
+	UserHandler          *api.UserHandler
+	TokenHandler         *api.TokenHandler
+	APIKeyHandler        *api.APIKeyHandler
+	TwoFactorHandler     *api.TwoFactorHandler
+	PasswordResetHandler *api.PasswordResetHandler
+	AvatarHandler        *api.AvatarHandler
+	ExerciseHandler      *api.ExerciseHandler
+	RecordHandler        *api.PersonalRecordHandler
+	StatsHandler         *api.StatsHandler
+	TemplateHandler      *api.TemplateHandler
+	ProgramHandler       *api.ProgramHandler
+	ProgressionHandler   *api.ProgressionHandler
+	ExportHandler        *api.ExportHandler
+	ImportHandler        *api.ImportHandler
+	HealthHandler        *api.HealthHandler
+	Middleware           middleware.UserMiddleware
+	DB                   *sql.DB
+	Lifecycle            *lifecycle.Manager
+	Metrics              *metrics.Metrics
+	// Mailer delivers the emails sent to users.
+	Mailer mailer.Mailer
+	// RateLimits holds the token buckets of the rate limited routes.
+	RateLimits ratelimit.Store
+	// Health holds the readiness checks; subsystems register their own probes.
+	Health *health.Registry
+	// TrustedProxies are the reverse proxies whose X-Forwarded-For headers
+	// name the client.
+	TrustedProxies []netip.Prefix
 }
 
-func NewApplication() (*Application, error) {
-	pgDB, err := store.Open()
+func NewApplication(cfg *config.Config) (*Application, error) {
+	logger, err := logging.New(os.Stdout, cfg.LogFormat, cfg.LogLevel)
+	if err != nil {
+		return nil, err
+	}
+
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Options{
+		Exporter:    cfg.Tracing.Exporter,
+		Endpoint:    cfg.Tracing.Endpoint,
+		Insecure:    cfg.Tracing.Insecure,
+		File:        cfg.Tracing.File,
+		ServiceName: cfg.Tracing.ServiceName,
+		SampleRatio: cfg.Tracing.SampleRatio,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	pgDB, err := store.Open(cfg.DB)
 	if err != nil {
 		return nil, err
 	}
@@ -34,31 +87,168 @@ func NewApplication() (*Application, error) {
 		panic(err)
 	}
 
-	logger := log.New(os.Stdout, "", log.Ldate|log.Ltime)
+	manager := lifecycle.New(cfg.Server.ShutdownDelay, cfg.Server.ShutdownTimeout, logger)
+	manager.OnShutdown("tracing", shutdownTracing)
+	manager.OnShutdown("database", pgDB.Close)
+
+	healthRegistry := health.NewRegistry(cfg.Health.CheckTimeout, cfg.Health.CacheTTL)
+	healthRegistry.Register(health.DBPing(pgDB))
+	healthRegistry.Register(health.MigrationVersion(pgDB, migrations.FS))
+	healthRegistry.Register(health.PoolSaturation(pgDB, cfg.Health.PoolSaturation))
+
+	appMetrics := metrics.New(pgDB)
+
+	timeouts := store.QueryTimeouts{Default: cfg.DB.QueryTimeout, Operations: cfg.DB.OperationTimeouts}
 
 	// our stores will go here
-	workoutStore := store.NewPostgresWorkoutStore(pgDB)
-	userStore := store.NewPostgresUserStore(pgDB)
-	tokenStore := store.NewPostgresTokenStore(pgDB)
+	workoutStore := metrics.InstrumentWorkoutStore(store.NewPostgresWorkoutStore(pgDB, timeouts), appMetrics)
+	userStore := metrics.InstrumentUserStore(store.NewPostgresUserStore(pgDB, timeouts), appMetrics)
+	tokenStore := metrics.InstrumentTokenStore(store.NewPostgresTokenStore(pgDB, timeouts), appMetrics)
+	exerciseStore := store.NewPostgresExerciseStore(pgDB, timeouts)
+	recordStore := store.NewPostgresPersonalRecordStore(pgDB, timeouts)
+	analyticsStore := store.NewPostgresAnalyticsStore(pgDB, timeouts)
+	templateStore := store.NewPostgresTemplateStore(pgDB, timeouts)
+	programStore := store.NewPostgresProgramStore(pgDB, timeouts)
+	progressionStore := store.NewPostgresProgressionStore(pgDB, timeouts)
+	apiKeyStore := store.NewPostgresAPIKeyStore(pgDB, timeouts)
+	twoFactorStore := store.NewPostgresTwoFactorStore(pgDB, timeouts)
+	loginAttemptStore := store.NewPostgresLoginAttemptStore(pgDB, timeouts, store.LockoutPolicy{
+		Threshold: cfg.Auth.LockoutThreshold,
+		Base:      cfg.Auth.LockoutBase,
+		Max:       cfg.Auth.LockoutMax,
+		Window:    cfg.Auth.LockoutWindow,
+	})
+
+	rateLimits := ratelimit.NewMemoryStore()
+	manager.Go("rate limit sweeper", func(ctx context.Context) error {
+		return rateLimits.Run(ctx, time.Minute)
+	})
+
+	// without a key 2FA stays off, since its secrets could not be stored
+	var totpCipher *encryption.Cipher
+	if cfg.Auth.TOTPKey != "" {
+		key, err := encryption.ParseKey(cfg.Auth.TOTPKey)
+		if err != nil {
+			return nil, err
+		}
+		totpCipher, err = encryption.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	appMailer, err := newMailer(cfg.Mail, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	blobStore, err := newBlobStore(cfg.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	trustedProxies, err := cfg.Server.TrustedProxyPrefixes()
+	if err != nil {
+		return nil, err
+	}
 
 	// our handlers will go here
 	workoutHandler := api.NewWorkoutHandler(workoutStore, logger)
-	userHandler := api.NewUserHandler(userStore, logger)
-	tokenHandler := api.NewTokenHandler(tokenStore, userStore, logger)
-	middlewareHandler := middleware.UserMiddleware{UserStore: userStore}
+	userHandler := api.NewUserHandler(userStore, tokenStore, loginAttemptStore, blobStore, appMailer, cfg.Auth.BcryptCost, cfg.Auth.ActivationTTL, logger)
+	tokenHandler := api.NewTokenHandler(tokenStore, userStore, loginAttemptStore, twoFactorStore, totpCipher,
+		cfg.Auth.TokenTTL, cfg.Auth.RefreshTokenTTL, cfg.Auth.TwoFactorTTL, cfg.Auth.BcryptCost, appMetrics, logger)
+	apiKeyHandler := api.NewAPIKeyHandler(apiKeyStore, logger)
+	twoFactorHandler := api.NewTwoFactorHandler(twoFactorStore, loginAttemptStore, totpCipher, logger)
+	passwordResetHandler := api.NewPasswordResetHandler(userStore, tokenStore, appMailer, cfg.Auth.PasswordResetTTL, cfg.Auth.BcryptCost, logger)
+	manager.OnShutdown("password reset emails", func() error {
+		passwordResetHandler.Wait()
+		return nil
+	})
+	manager.OnShutdown("account emails", func() error {
+		userHandler.Wait()
+		return nil
+	})
+	avatarHandler := api.NewAvatarHandler(userStore, blobStore, cfg.Storage.MaxAvatarSize, logger)
+	exerciseHandler := api.NewExerciseHandler(exerciseStore, logger)
+	recordHandler := api.NewPersonalRecordHandler(recordStore, logger)
+	statsHandler := api.NewStatsHandler(analyticsStore, logger)
+	templateHandler := api.NewTemplateHandler(templateStore, workoutStore, logger)
+	programHandler := api.NewProgramHandler(programStore, templateStore, logger)
+	progressionHandler := api.NewProgressionHandler(progressionStore, logger)
+	exportHandler := api.NewExportHandler(workoutStore, logger)
+	importHandler := api.NewImportHandler(workoutStore, logger)
+	healthHandler := api.NewHealthHandler(healthRegistry, manager.Draining)
+	middlewareHandler := middleware.UserMiddleware{UserStore: userStore, APIKeyStore: apiKeyStore}
 
 	app := &Application{
-		Logger:         logger,
-		WorkoutHandler: workoutHandler,
-		UserHandler:    userHandler,
-		TokenHandler:   tokenHandler,
-		Middleware:     middlewareHandler,
-		DB:             pgDB,
+		Config:               cfg,
+		Logger:               logger,
+		WorkoutHandler:       workoutHandler,
+		UserHandler:          userHandler,
+		TokenHandler:         tokenHandler,
+		APIKeyHandler:        apiKeyHandler,
+		TwoFactorHandler:     twoFactorHandler,
+		PasswordResetHandler: passwordResetHandler,
+		AvatarHandler:        avatarHandler,
+		ExerciseHandler:      exerciseHandler,
+		RecordHandler:        recordHandler,
+		StatsHandler:         statsHandler,
+		TemplateHandler:      templateHandler,
+		ProgramHandler:       programHandler,
+		ProgressionHandler:   progressionHandler,
+		ExportHandler:        exportHandler,
+		ImportHandler:        importHandler,
+		HealthHandler:        healthHandler,
+		Middleware:           middlewareHandler,
+		DB:                   pgDB,
+		Lifecycle:            manager,
+		Metrics:              appMetrics,
+		Mailer:               appMailer,
+		RateLimits:           rateLimits,
+		Health:               healthRegistry,
+		TrustedProxies:       trustedProxies,
 	}
 
 	return app, nil
 }
 
+func newMailer(cfg config.MailConfig, logger *slog.Logger) (mailer.Mailer, error) {
+	switch cfg.Backend {
+	case config.MailBackendSMTP:
+		return mailer.NewSMTP(mailer.SMTPOptions{
+			Host:     cfg.SMTPHost,
+			Port:     cfg.SMTPPort,
+			Username: cfg.SMTPUsername,
+			Password: cfg.SMTPPassword,
+			From:     cfg.From,
+		}), nil
+	case config.MailBackendFile:
+		return mailer.NewFile(cfg.Dir, cfg.From)
+	case config.MailBackendLog:
+		return mailer.NewLog(logger), nil
+	default:
+		return mailer.NewMemory(), nil
+	}
+}
+
+func newBlobStore(cfg config.StorageConfig) (store.BlobStore, error) {
+	if cfg.Backend == config.StorageBackendS3 {
+		return store.NewS3BlobStore(store.S3Options{
+			Endpoint:  cfg.S3Endpoint,
+			Region:    cfg.S3Region,
+			Bucket:    cfg.S3Bucket,
+			AccessKey: cfg.S3AccessKey,
+			SecretKey: cfg.S3SecretKey,
+		})
+	}
+	return store.NewLocalBlobStore(cfg.Dir)
+}
+
 func (a *Application) HealthCheck(w http.ResponseWriter, r *http.Request) {
+	if a.Lifecycle.Draining() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintf(w, "Status is shutting down\n")
+		return
+	}
 	fmt.Fprintf(w, "Status is available\n")
-}
\ No newline at end of file
+}
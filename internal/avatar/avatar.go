@@ -0,0 +1,83 @@
+package avatar
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// Sizes are the edges, in pixels, of the square thumbnails made of every
+// avatar, largest first.
+var Sizes = []int{256, 64}
+
+// MaxPixels bounds the dimensions of accepted images, since a small file can
+// decode into a huge one.
+const MaxPixels = 40_000_000
+
+const jpegQuality = 85
+
+var (
+	ErrInvalidImage = errors.New("avatar: not a supported image")
+	ErrTooLarge     = errors.New("avatar: image dimensions too large")
+)
+
+// Thumbnails decodes a JPEG, PNG, GIF or WebP image and returns it as JPEG
+// thumbnails, one per entry of Sizes, cropped to a centered square. The
+// thumbnails are encoded from pixels only, so EXIF and any other metadata of
+// the upload are dropped; the EXIF orientation of JPEGs is applied first.
+func Thumbnails(data []byte) (map[int][]byte, error) {
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrInvalidImage
+	}
+	if config.Width <= 0 || config.Height <= 0 || config.Width*config.Height > MaxPixels {
+		return nil, ErrTooLarge
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrInvalidImage
+	}
+
+	orientation := 1
+	if format == "jpeg" {
+		orientation = jpegOrientation(data)
+	}
+
+	thumbnails := make(map[int][]byte, len(Sizes))
+	for _, size := range Sizes {
+		// a centered square looks the same whichever way it is turned, so the
+		// cheap thing is to orient the thumbnail rather than the upload
+		thumbnail := orient(thumbnail(img, size), orientation)
+
+		var buf bytes.Buffer
+		err = jpeg.Encode(&buf, thumbnail, &jpeg.Options{Quality: jpegQuality})
+		if err != nil {
+			return nil, fmt.Errorf("avatar: %w", err)
+		}
+		thumbnails[size] = buf.Bytes()
+	}
+	return thumbnails, nil
+}
+
+// thumbnail scales the largest centered square of img to size×size pixels,
+// on white since JPEG has no transparency.
+func thumbnail(img image.Image, size int) *image.RGBA {
+	b := img.Bounds()
+	side := min(b.Dx(), b.Dy())
+	x := b.Min.X + (b.Dx()-side)/2
+	y := b.Min.Y + (b.Dy()-side)/2
+	src := image.Rect(x, y, x+side, y+side)
+
+	dst := image.NewRGBA(image.Rect(0, 0, size, size))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, src, draw.Over, nil)
+	return dst
+}
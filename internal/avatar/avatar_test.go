@@ -0,0 +1,116 @@
+package avatar
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	red  = color.RGBA{R: 255, A: 255}
+	blue = color.RGBA{B: 255, A: 255}
+)
+
+// halves is a w×h image, red on the left half and blue on the right.
+func halves(w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if x < w/2 {
+				img.Set(x, y, red)
+			} else {
+				img.Set(x, y, blue)
+			}
+		}
+	}
+	return img
+}
+
+// withOrientation inserts an EXIF segment with the given orientation right
+// after the start of a JPEG.
+func withOrientation(t *testing.T, data []byte, orientation uint16) []byte {
+	var tiff bytes.Buffer
+	tiff.WriteString("MM")
+	binary.Write(&tiff, binary.BigEndian, uint16(42))
+	binary.Write(&tiff, binary.BigEndian, uint32(8))
+	binary.Write(&tiff, binary.BigEndian, uint16(1))
+	binary.Write(&tiff, binary.BigEndian, []uint16{0x0112, 3})
+	binary.Write(&tiff, binary.BigEndian, uint32(1))
+	binary.Write(&tiff, binary.BigEndian, []uint16{orientation, 0})
+	binary.Write(&tiff, binary.BigEndian, uint32(0))
+
+	segment := append([]byte("Exif\x00\x00"), tiff.Bytes()...)
+	var out bytes.Buffer
+	out.Write(data[:2])
+	out.Write([]byte{0xFF, 0xE1})
+	binary.Write(&out, binary.BigEndian, uint16(len(segment)+2))
+	out.Write(segment)
+	out.Write(data[2:])
+	require.Equal(t, int(orientation), jpegOrientation(out.Bytes()))
+	return out.Bytes()
+}
+
+func decode(t *testing.T, data []byte) image.Image {
+	img, format, err := image.Decode(bytes.NewReader(data))
+	require.NoError(t, err)
+	require.Equal(t, "jpeg", format)
+	return img
+}
+
+func isRed(c color.Color) bool {
+	r, _, b, _ := c.RGBA()
+	return r > 0xC000 && b < 0x4000
+}
+
+func TestThumbnails(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, halves(300, 200)))
+
+	thumbnails, err := Thumbnails(buf.Bytes())
+	require.NoError(t, err)
+	require.Len(t, thumbnails, len(Sizes))
+	for _, size := range Sizes {
+		img := decode(t, thumbnails[size])
+		assert.Equal(t, image.Rect(0, 0, size, size), img.Bounds())
+		assert.True(t, isRed(img.At(size/8, size/2)), "left stays red")
+		assert.False(t, isRed(img.At(size-1-size/8, size/2)), "right stays blue")
+	}
+
+	_, err = Thumbnails([]byte("not an image"))
+	assert.ErrorIs(t, err, ErrInvalidImage)
+}
+
+func TestThumbnailsOrientation(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, jpeg.Encode(&buf, halves(200, 200), nil))
+	data := withOrientation(t, buf.Bytes(), 6)
+
+	thumbnails, err := Thumbnails(data)
+	require.NoError(t, err)
+	assert.NotContains(t, string(thumbnails[64]), "Exif")
+
+	// turned right, the red left half ends up on top
+	img := decode(t, thumbnails[64])
+	assert.True(t, isRed(img.At(32, 8)))
+	assert.False(t, isRed(img.At(32, 56)))
+}
+
+func TestOrient(t *testing.T) {
+	// each orientation, applied to its own transform of a marked pixel,
+	// brings the mark back to the top left
+	marked := map[int]image.Point{
+		2: {3, 0}, 3: {3, 3}, 4: {0, 3}, 5: {0, 0}, 6: {0, 3}, 7: {3, 3}, 8: {3, 0},
+	}
+	for o, p := range marked {
+		img := image.NewRGBA(image.Rect(0, 0, 4, 4))
+		img.SetRGBA(p.X, p.Y, red)
+		assert.Equal(t, red, orient(img, o).RGBAAt(0, 0), "orientation %d", o)
+	}
+}
@@ -0,0 +1,532 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"net/mail"
+	"net/netip"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dapoadedire/fem_project/internal/encryption"
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// EnvPrefix starts the name of every environment variable read by Load.
+	EnvPrefix = "FEM_"
+
+	LogLevelDebug = "debug"
+	LogLevelInfo  = "info"
+	LogLevelWarn  = "warn"
+	LogLevelError = "error"
+
+	LogFormatJSON = "json"
+	LogFormatText = "text"
+
+	TracingExporterNone   = "none"
+	TracingExporterStdout = "stdout"
+	TracingExporterOTLP   = "otlp"
+
+	MailBackendSMTP   = "smtp"
+	MailBackendFile   = "file"
+	MailBackendLog    = "log"
+	MailBackendMemory = "memory"
+
+	StorageBackendLocal = "local"
+	StorageBackendS3    = "s3"
+)
+
+type Config struct {
+	Port      int           `yaml:"port"`
+	LogLevel  string        `yaml:"log_level"`
+	LogFormat string        `yaml:"log_format"`
+	DB        DBConfig      `yaml:"db"`
+	Server    ServerConfig  `yaml:"server"`
+	Auth      AuthConfig    `yaml:"auth"`
+	Health    HealthConfig  `yaml:"health"`
+	Tracing   TracingConfig `yaml:"tracing"`
+	Mail      MailConfig    `yaml:"mail"`
+	Storage   StorageConfig `yaml:"storage"`
+}
+
+type DBConfig struct {
+	DSN             string        `yaml:"dsn"`
+	MaxOpenConns    int           `yaml:"max_open_conns"`
+	MaxIdleConns    int           `yaml:"max_idle_conns"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime"`
+	ConnMaxIdleTime time.Duration `yaml:"conn_max_idle_time"`
+	// QueryTimeout bounds each store operation, unless OperationTimeouts
+	// names it, e.g. "WorkoutStore.ImportWorkouts". Zero means no timeout.
+	QueryTimeout      time.Duration            `yaml:"query_timeout"`
+	OperationTimeouts map[string]time.Duration `yaml:"operation_timeouts"`
+}
+
+type ServerConfig struct {
+	ReadTimeout  time.Duration `yaml:"read_timeout"`
+	WriteTimeout time.Duration `yaml:"write_timeout"`
+	IdleTimeout  time.Duration `yaml:"idle_timeout"`
+	// ShutdownDelay is how long the server keeps serving while reporting not
+	// ready before it starts draining; ShutdownTimeout bounds the drain.
+	ShutdownDelay   time.Duration `yaml:"shutdown_delay"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+	// TrustedProxies is a comma-separated list of the addresses or CIDR
+	// prefixes of the reverse proxies in front of the server, whose
+	// X-Forwarded-For headers are believed. Empty means no proxy is trusted.
+	TrustedProxies string `yaml:"trusted_proxies"`
+}
+
+// TrustedProxyPrefixes parses TrustedProxies, turning single addresses
+// into prefixes of their own.
+func (c ServerConfig) TrustedProxyPrefixes() ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, field := range strings.Split(c.TrustedProxies, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		if !strings.Contains(field, "/") {
+			addr, err := netip.ParseAddr(field)
+			if err != nil {
+				return nil, err
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(field)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+type HealthConfig struct {
+	CheckTimeout time.Duration `yaml:"check_timeout"`
+	CacheTTL     time.Duration `yaml:"cache_ttl"`
+	// PoolSaturation is the share of the connection pool in use, from 0 to
+	// 1, at which the application stops reporting ready.
+	PoolSaturation float64 `yaml:"pool_saturation"`
+}
+
+type TracingConfig struct {
+	// Exporter is none, stdout (written to File, or standard output when
+	// File is empty) or otlp (sent over HTTP to Endpoint).
+	Exporter    string  `yaml:"exporter"`
+	Endpoint    string  `yaml:"endpoint"`
+	Insecure    bool    `yaml:"insecure"`
+	File        string  `yaml:"file"`
+	ServiceName string  `yaml:"service_name"`
+	SampleRatio float64 `yaml:"sample_ratio"`
+}
+
+type MailConfig struct {
+	// Backend is smtp, file (messages are written to Dir as .eml files), log
+	// (messages are logged) or memory (messages are dropped, for tests).
+	Backend      string `yaml:"backend"`
+	From         string `yaml:"from"`
+	Dir          string `yaml:"dir"`
+	SMTPHost     string `yaml:"smtp_host"`
+	SMTPPort     int    `yaml:"smtp_port"`
+	SMTPUsername string `yaml:"smtp_username"`
+	SMTPPassword string `yaml:"smtp_password"`
+}
+
+type StorageConfig struct {
+	// Backend is local (files are kept in Dir) or s3 (objects are kept in
+	// S3Bucket of the S3-compatible service at S3Endpoint).
+	Backend     string `yaml:"backend"`
+	Dir         string `yaml:"dir"`
+	S3Endpoint  string `yaml:"s3_endpoint"`
+	S3Region    string `yaml:"s3_region"`
+	S3Bucket    string `yaml:"s3_bucket"`
+	S3AccessKey string `yaml:"s3_access_key"`
+	S3SecretKey string `yaml:"s3_secret_key"`
+	// MaxAvatarSize is the largest avatar upload accepted, in bytes.
+	MaxAvatarSize int `yaml:"max_avatar_size"`
+}
+
+type AuthConfig struct {
+	// TokenTTL is the lifetime of the access tokens used on every request;
+	// RefreshTokenTTL that of the refresh tokens they are renewed with.
+	TokenTTL        time.Duration `yaml:"token_ttl"`
+	RefreshTokenTTL time.Duration `yaml:"refresh_token_ttl"`
+	BcryptCost      int           `yaml:"bcrypt_cost"`
+	// Login attempts are rate limited per client IP and per username: each
+	// allows a burst of attempts, then one more per interval.
+	LoginIPBurst          int           `yaml:"login_ip_burst"`
+	LoginIPInterval       time.Duration `yaml:"login_ip_interval"`
+	LoginUsernameBurst    int           `yaml:"login_username_burst"`
+	LoginUsernameInterval time.Duration `yaml:"login_username_interval"`
+	// After LockoutThreshold wrong passwords in a row an account is locked
+	// for LockoutBase, doubling with each further failure up to LockoutMax.
+	// Failures older than LockoutWindow are forgotten.
+	LockoutThreshold int           `yaml:"lockout_threshold"`
+	LockoutBase      time.Duration `yaml:"lockout_base"`
+	LockoutMax       time.Duration `yaml:"lockout_max"`
+	LockoutWindow    time.Duration `yaml:"lockout_window"`
+	// TOTPKey is the base64 AES-256 key TOTP secrets are encrypted with.
+	// Without it two-factor authentication cannot be enabled.
+	TOTPKey string `yaml:"totp_key"`
+	// TwoFactorTTL is how long a correct password stays good for while the
+	// user enters their code.
+	TwoFactorTTL time.Duration `yaml:"two_factor_ttl"`
+	// PasswordResetTTL is how long the token mailed for a password reset
+	// can be used.
+	PasswordResetTTL time.Duration `yaml:"password_reset_ttl"`
+	// ActivationTTL is how long the token mailed to confirm the email address
+	// of a new account can be used.
+	ActivationTTL time.Duration `yaml:"activation_ttl"`
+}
+
+func Default() *Config {
+	return &Config{
+		Port:      8080,
+		LogLevel:  LogLevelInfo,
+		LogFormat: LogFormatText,
+		DB: DBConfig{
+			DSN:             "host=localhost user=postgres password=postgres dbname=postgres port=5432 sslmode=disable",
+			MaxOpenConns:    25,
+			MaxIdleConns:    25,
+			ConnMaxLifetime: time.Hour,
+			ConnMaxIdleTime: 15 * time.Minute,
+			QueryTimeout:    5 * time.Second,
+			OperationTimeouts: map[string]time.Duration{
+				// exports stream the whole history while writing the response
+				"WorkoutStore.StreamWorkouts": 0,
+				"WorkoutStore.ImportWorkouts": 2 * time.Minute,
+			},
+		},
+		Server: ServerConfig{
+			ReadTimeout:     10 * time.Second,
+			WriteTimeout:    20 * time.Second,
+			IdleTimeout:     time.Minute,
+			ShutdownTimeout: 30 * time.Second,
+		},
+		Auth: AuthConfig{
+			TokenTTL:        15 * time.Minute,
+			RefreshTokenTTL: 30 * 24 * time.Hour,
+			BcryptCost:      bcrypt.DefaultCost,
+
+			LoginIPBurst:          20,
+			LoginIPInterval:       3 * time.Second,
+			LoginUsernameBurst:    5,
+			LoginUsernameInterval: 30 * time.Second,
+
+			LockoutThreshold: 5,
+			LockoutBase:      time.Minute,
+			LockoutMax:       time.Hour,
+			LockoutWindow:    24 * time.Hour,
+
+			TwoFactorTTL:     5 * time.Minute,
+			PasswordResetTTL: 30 * time.Minute,
+			ActivationTTL:    72 * time.Hour,
+		},
+		Health: HealthConfig{
+			CheckTimeout:   2 * time.Second,
+			CacheTTL:       5 * time.Second,
+			PoolSaturation: 0.9,
+		},
+		Tracing: TracingConfig{
+			Exporter:    TracingExporterNone,
+			ServiceName: "fem_project",
+			SampleRatio: 1,
+		},
+		Mail: MailConfig{
+			Backend:  MailBackendFile,
+			From:     "fem_project <no-reply@localhost>",
+			Dir:      "mail",
+			SMTPHost: "localhost",
+			SMTPPort: 587,
+		},
+		Storage: StorageConfig{
+			Backend:       StorageBackendLocal,
+			Dir:           "uploads",
+			S3Region:      "us-east-1",
+			MaxAvatarSize: 5 << 20,
+		},
+	}
+}
+
+// setting is one option that can be given as a flag or as an environment
+// variable named after the flag, e.g. -db-dsn and FEM_DB_DSN.
+type setting struct {
+	name  string
+	usage string
+	field func(*Config) interface{}
+}
+
+var settings = []setting{
+	{"port", "go backend server port", func(c *Config) interface{} { return &c.Port }},
+	{"log-level", "minimum level logged: debug, info, warn or error", func(c *Config) interface{} { return &c.LogLevel }},
+	{"log-format", "log output format: json or text", func(c *Config) interface{} { return &c.LogFormat }},
+	{"db-dsn", "postgres connection string", func(c *Config) interface{} { return &c.DB.DSN }},
+	{"db-max-open-conns", "maximum open database connections, 0 for no limit", func(c *Config) interface{} { return &c.DB.MaxOpenConns }},
+	{"db-max-idle-conns", "maximum idle database connections", func(c *Config) interface{} { return &c.DB.MaxIdleConns }},
+	{"db-conn-max-lifetime", "maximum time a database connection is reused, 0 for no limit", func(c *Config) interface{} { return &c.DB.ConnMaxLifetime }},
+	{"db-conn-max-idle-time", "maximum time a database connection stays idle, 0 for no limit", func(c *Config) interface{} { return &c.DB.ConnMaxIdleTime }},
+	{"db-query-timeout", "maximum duration of a store operation, 0 for no limit", func(c *Config) interface{} { return &c.DB.QueryTimeout }},
+	{"read-timeout", "maximum duration for reading a request", func(c *Config) interface{} { return &c.Server.ReadTimeout }},
+	{"write-timeout", "maximum duration for writing a response", func(c *Config) interface{} { return &c.Server.WriteTimeout }},
+	{"idle-timeout", "maximum time to wait for the next request on a keep-alive connection", func(c *Config) interface{} { return &c.Server.IdleTimeout }},
+	{"shutdown-delay", "time to keep serving while reporting not ready before draining", func(c *Config) interface{} { return &c.Server.ShutdownDelay }},
+	{"shutdown-timeout", "maximum time to drain requests and stop workers on shutdown", func(c *Config) interface{} { return &c.Server.ShutdownTimeout }},
+	{"trusted-proxies", "comma-separated addresses or CIDR prefixes of trusted reverse proxies", func(c *Config) interface{} { return &c.Server.TrustedProxies }},
+	{"token-ttl", "lifetime of authentication tokens", func(c *Config) interface{} { return &c.Auth.TokenTTL }},
+	{"refresh-token-ttl", "lifetime of refresh tokens", func(c *Config) interface{} { return &c.Auth.RefreshTokenTTL }},
+	{"bcrypt-cost", "bcrypt cost of password hashes", func(c *Config) interface{} { return &c.Auth.BcryptCost }},
+	{"login-ip-burst", "login attempts a client IP can make at once", func(c *Config) interface{} { return &c.Auth.LoginIPBurst }},
+	{"login-ip-interval", "time for a client IP to regain one login attempt", func(c *Config) interface{} { return &c.Auth.LoginIPInterval }},
+	{"login-username-burst", "login attempts for a username that can be made at once", func(c *Config) interface{} { return &c.Auth.LoginUsernameBurst }},
+	{"login-username-interval", "time for a username to regain one login attempt", func(c *Config) interface{} { return &c.Auth.LoginUsernameInterval }},
+	{"lockout-threshold", "wrong passwords in a row that lock an account", func(c *Config) interface{} { return &c.Auth.LockoutThreshold }},
+	{"lockout-base", "duration of the first account lockout", func(c *Config) interface{} { return &c.Auth.LockoutBase }},
+	{"lockout-max", "maximum duration of an account lockout", func(c *Config) interface{} { return &c.Auth.LockoutMax }},
+	{"lockout-window", "time after which failed logins are forgotten", func(c *Config) interface{} { return &c.Auth.LockoutWindow }},
+	{"totp-key", "base64 AES-256 key encrypting TOTP secrets, 2FA is unavailable without it", func(c *Config) interface{} { return &c.Auth.TOTPKey }},
+	{"two-factor-ttl", "time to enter the 2FA code after a correct password", func(c *Config) interface{} { return &c.Auth.TwoFactorTTL }},
+	{"password-reset-ttl", "lifetime of password reset tokens", func(c *Config) interface{} { return &c.Auth.PasswordResetTTL }},
+	{"activation-ttl", "lifetime of email verification tokens", func(c *Config) interface{} { return &c.Auth.ActivationTTL }},
+	{"health-check-timeout", "maximum duration of each readiness check", func(c *Config) interface{} { return &c.Health.CheckTimeout }},
+	{"health-cache-ttl", "how long readiness check results are reused", func(c *Config) interface{} { return &c.Health.CacheTTL }},
+	{"health-pool-saturation", "share of the connection pool in use at which the app is not ready", func(c *Config) interface{} { return &c.Health.PoolSaturation }},
+	{"tracing-exporter", "where spans are exported: none, stdout or otlp", func(c *Config) interface{} { return &c.Tracing.Exporter }},
+	{"tracing-endpoint", "host:port of the OTLP/HTTP collector", func(c *Config) interface{} { return &c.Tracing.Endpoint }},
+	{"tracing-insecure", "send spans to the OTLP collector over plain HTTP", func(c *Config) interface{} { return &c.Tracing.Insecure }},
+	{"tracing-file", "file the stdout exporter appends spans to instead of standard output", func(c *Config) interface{} { return &c.Tracing.File }},
+	{"tracing-service-name", "service name reported with every span", func(c *Config) interface{} { return &c.Tracing.ServiceName }},
+	{"tracing-sample-ratio", "share of new traces recorded, from 0 to 1", func(c *Config) interface{} { return &c.Tracing.SampleRatio }},
+	{"mail-backend", "how email is delivered: smtp, file, log or memory", func(c *Config) interface{} { return &c.Mail.Backend }},
+	{"mail-from", "sender address of outgoing email", func(c *Config) interface{} { return &c.Mail.From }},
+	{"mail-dir", "directory the file backend writes email to", func(c *Config) interface{} { return &c.Mail.Dir }},
+	{"mail-smtp-host", "SMTP server host", func(c *Config) interface{} { return &c.Mail.SMTPHost }},
+	{"mail-smtp-port", "SMTP server port", func(c *Config) interface{} { return &c.Mail.SMTPPort }},
+	{"mail-smtp-username", "SMTP username, empty for no authentication", func(c *Config) interface{} { return &c.Mail.SMTPUsername }},
+	{"mail-smtp-password", "SMTP password", func(c *Config) interface{} { return &c.Mail.SMTPPassword }},
+	{"storage-backend", "where uploaded files are kept: local or s3", func(c *Config) interface{} { return &c.Storage.Backend }},
+	{"storage-dir", "directory the local backend keeps uploaded files in", func(c *Config) interface{} { return &c.Storage.Dir }},
+	{"storage-s3-endpoint", "base URL of the S3-compatible service", func(c *Config) interface{} { return &c.Storage.S3Endpoint }},
+	{"storage-s3-region", "region of the S3 bucket", func(c *Config) interface{} { return &c.Storage.S3Region }},
+	{"storage-s3-bucket", "S3 bucket uploaded files are kept in", func(c *Config) interface{} { return &c.Storage.S3Bucket }},
+	{"storage-s3-access-key", "S3 access key ID", func(c *Config) interface{} { return &c.Storage.S3AccessKey }},
+	{"storage-s3-secret-key", "S3 secret access key", func(c *Config) interface{} { return &c.Storage.S3SecretKey }},
+	{"storage-max-avatar-size", "largest avatar upload accepted, in bytes", func(c *Config) interface{} { return &c.Storage.MaxAvatarSize }},
+}
+
+func (s setting) env() string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(s.name, "-", "_"))
+}
+
+// Load builds the config from, in increasing order of precedence, the
+// defaults, the YAML file named by -config or FEM_CONFIG, FEM_* environment
+// variables and the command line flags in args. It returns flag.ErrHelp when
+// args ask for usage.
+func Load(args []string) (*Config, error) {
+	cfg := Default()
+	path := os.Getenv(EnvPrefix + "CONFIG")
+
+	// the file has to be found before the flags that override it are applied
+	probe := newFlagSet(Default(), &path)
+	probe.SetOutput(io.Discard)
+	if err := probe.Parse(args); err != nil {
+		return nil, newFlagSet(cfg, &path).Parse(args)
+	}
+
+	if path != "" {
+		err := loadFile(cfg, path)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err := loadEnv(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	err = newFlagSet(cfg, &path).Parse(args)
+	if err != nil {
+		return nil, err
+	}
+
+	err = cfg.Validate()
+	if err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// newFlagSet binds a flag to every setting of cfg, defaulting to its current value.
+func newFlagSet(cfg *Config, path *string) *flag.FlagSet {
+	fs := flag.NewFlagSet("fem_project", flag.ContinueOnError)
+	fs.StringVar(path, "config", *path, "path to a YAML config file")
+	for _, s := range settings {
+		switch p := s.field(cfg).(type) {
+		case *int:
+			fs.IntVar(p, s.name, *p, s.usage)
+		case *string:
+			fs.StringVar(p, s.name, *p, s.usage)
+		case *bool:
+			fs.BoolVar(p, s.name, *p, s.usage)
+		case *float64:
+			fs.Float64Var(p, s.name, *p, s.usage)
+		case *time.Duration:
+			fs.DurationVar(p, s.name, *p, s.usage)
+		}
+	}
+	return fs
+}
+
+func loadFile(cfg *Config, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+	defer file.Close()
+
+	decoder := yaml.NewDecoder(file)
+	decoder.KnownFields(true)
+	err = decoder.Decode(cfg)
+	if err != nil && err != io.EOF {
+		return fmt.Errorf("config: %s: %w", path, err)
+	}
+	return nil
+}
+
+func loadEnv(cfg *Config) error {
+	for _, s := range settings {
+		value, ok := os.LookupEnv(s.env())
+		if !ok {
+			continue
+		}
+
+		var err error
+		switch p := s.field(cfg).(type) {
+		case *int:
+			*p, err = strconv.Atoi(value)
+		case *string:
+			*p = value
+		case *bool:
+			*p, err = strconv.ParseBool(value)
+		case *float64:
+			*p, err = strconv.ParseFloat(value, 64)
+		case *time.Duration:
+			*p, err = time.ParseDuration(value)
+		}
+		if err != nil {
+			return fmt.Errorf("config: %s: %w", s.env(), err)
+		}
+	}
+	return nil
+}
+
+// Validate reports every invalid setting at once.
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.Port > 0 && c.Port <= 65535, "port must be between 1 and 65535")
+	switch c.LogLevel {
+	case LogLevelDebug, LogLevelInfo, LogLevelWarn, LogLevelError:
+	default:
+		errs = append(errs, errors.New("log_level must be debug, info, warn or error"))
+	}
+	check(c.LogFormat == LogFormatJSON || c.LogFormat == LogFormatText, "log_format must be json or text")
+
+	check(strings.TrimSpace(c.DB.DSN) != "", "db.dsn is required")
+	check(c.DB.MaxOpenConns >= 0, "db.max_open_conns must not be negative")
+	check(c.DB.MaxIdleConns >= 0, "db.max_idle_conns must not be negative")
+	check(c.DB.MaxOpenConns == 0 || c.DB.MaxIdleConns <= c.DB.MaxOpenConns, "db.max_idle_conns must not exceed db.max_open_conns")
+	check(c.DB.ConnMaxLifetime >= 0, "db.conn_max_lifetime must not be negative")
+	check(c.DB.ConnMaxIdleTime >= 0, "db.conn_max_idle_time must not be negative")
+	check(c.DB.QueryTimeout >= 0, "db.query_timeout must not be negative")
+	for _, op := range slices.Sorted(maps.Keys(c.DB.OperationTimeouts)) {
+		check(c.DB.OperationTimeouts[op] >= 0, "db.operation_timeouts.%s must not be negative", op)
+	}
+
+	check(c.Server.ReadTimeout >= 0, "server.read_timeout must not be negative")
+	check(c.Server.WriteTimeout >= 0, "server.write_timeout must not be negative")
+	check(c.Server.IdleTimeout >= 0, "server.idle_timeout must not be negative")
+	check(c.Server.ShutdownDelay >= 0, "server.shutdown_delay must not be negative")
+	check(c.Server.ShutdownTimeout > 0, "server.shutdown_timeout must be positive")
+	_, err := c.Server.TrustedProxyPrefixes()
+	check(err == nil, "server.trusted_proxies must be a comma-separated list of IP addresses or CIDR prefixes")
+
+	check(c.Health.CheckTimeout > 0, "health.check_timeout must be positive")
+	check(c.Health.CacheTTL >= 0, "health.cache_ttl must not be negative")
+	check(c.Health.PoolSaturation > 0 && c.Health.PoolSaturation <= 1, "health.pool_saturation must be greater than 0 and at most 1")
+
+	switch c.Tracing.Exporter {
+	case TracingExporterNone, TracingExporterStdout, TracingExporterOTLP:
+	default:
+		errs = append(errs, errors.New("tracing.exporter must be none, stdout or otlp"))
+	}
+	check(c.Tracing.Exporter == TracingExporterNone || strings.TrimSpace(c.Tracing.ServiceName) != "", "tracing.service_name is required")
+	check(c.Tracing.SampleRatio >= 0 && c.Tracing.SampleRatio <= 1, "tracing.sample_ratio must be between 0 and 1")
+
+	check(c.Auth.TokenTTL > 0, "auth.token_ttl must be positive")
+	check(c.Auth.RefreshTokenTTL >= c.Auth.TokenTTL, "auth.refresh_token_ttl must not be less than auth.token_ttl")
+	check(c.Auth.BcryptCost >= bcrypt.MinCost && c.Auth.BcryptCost <= bcrypt.MaxCost,
+		"auth.bcrypt_cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+	check(c.Auth.LoginIPBurst > 0, "auth.login_ip_burst must be positive")
+	check(c.Auth.LoginIPInterval > 0, "auth.login_ip_interval must be positive")
+	check(c.Auth.LoginUsernameBurst > 0, "auth.login_username_burst must be positive")
+	check(c.Auth.LoginUsernameInterval > 0, "auth.login_username_interval must be positive")
+	check(c.Auth.LockoutThreshold > 0, "auth.lockout_threshold must be positive")
+	check(c.Auth.LockoutBase > 0, "auth.lockout_base must be positive")
+	check(c.Auth.LockoutMax >= c.Auth.LockoutBase, "auth.lockout_max must not be less than auth.lockout_base")
+	check(c.Auth.LockoutWindow > 0, "auth.lockout_window must be positive")
+	if c.Auth.TOTPKey != "" {
+		_, err := encryption.ParseKey(c.Auth.TOTPKey)
+		check(err == nil, "auth.totp_key must be %d base64 encoded bytes", encryption.KeySize)
+	}
+	check(c.Auth.TwoFactorTTL > 0, "auth.two_factor_ttl must be positive")
+	check(c.Auth.PasswordResetTTL > 0, "auth.password_reset_ttl must be positive")
+	check(c.Auth.ActivationTTL > 0, "auth.activation_ttl must be positive")
+
+	switch c.Mail.Backend {
+	case MailBackendSMTP:
+		check(c.Mail.SMTPHost != "", "mail.smtp_host is required")
+		check(c.Mail.SMTPPort > 0 && c.Mail.SMTPPort <= 65535, "mail.smtp_port must be between 1 and 65535")
+	case MailBackendFile:
+		check(c.Mail.Dir != "", "mail.dir is required")
+	case MailBackendLog, MailBackendMemory:
+	default:
+		errs = append(errs, errors.New("mail.backend must be smtp, file, log or memory"))
+	}
+	_, err = mail.ParseAddress(c.Mail.From)
+	check(err == nil, "mail.from must be a valid email address")
+
+	switch c.Storage.Backend {
+	case StorageBackendLocal:
+		check(c.Storage.Dir != "", "storage.dir is required")
+	case StorageBackendS3:
+		endpoint, err := url.Parse(c.Storage.S3Endpoint)
+		check(err == nil && (endpoint.Scheme == "http" || endpoint.Scheme == "https") && endpoint.Host != "",
+			"storage.s3_endpoint must be an http or https URL")
+		check(c.Storage.S3Region != "", "storage.s3_region is required")
+		check(c.Storage.S3Bucket != "", "storage.s3_bucket is required")
+		check(c.Storage.S3AccessKey != "" && c.Storage.S3SecretKey != "", "storage.s3_access_key and storage.s3_secret_key are required")
+	default:
+		errs = append(errs, errors.New("storage.backend must be local or s3"))
+	}
+	check(c.Storage.MaxAvatarSize > 0, "storage.max_avatar_size must be positive")
+
+	if len(errs) > 0 {
+		return fmt.Errorf("config: %w", errors.Join(errs...))
+	}
+	return nil
+}
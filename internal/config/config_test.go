@@ -0,0 +1,123 @@
+package config
+
+import (
+	"flag"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadDefaults(t *testing.T) {
+	cfg, err := Load(nil)
+	require.NoError(t, err)
+	assert.Equal(t, Default(), cfg)
+	assert.Equal(t, 15*time.Minute, cfg.Auth.TokenTTL)
+	assert.Equal(t, 30*24*time.Hour, cfg.Auth.RefreshTokenTTL)
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	err := os.WriteFile(path, []byte(`
+port: 9000
+log_level: debug
+db:
+  dsn: host=db
+  max_open_conns: 10
+  max_idle_conns: 5
+auth:
+  token_ttl: 2h
+`), 0o600)
+	require.NoError(t, err)
+
+	t.Setenv("FEM_CONFIG", path)
+	t.Setenv("FEM_PORT", "9100")
+	t.Setenv("FEM_TOKEN_TTL", "90m")
+
+	cfg, err := Load([]string{"-port", "9200", "-bcrypt-cost", "12"})
+	require.NoError(t, err)
+
+	assert.Equal(t, 9200, cfg.Port)
+	assert.Equal(t, 90*time.Minute, cfg.Auth.TokenTTL)
+	assert.Equal(t, 12, cfg.Auth.BcryptCost)
+	assert.Equal(t, "host=db", cfg.DB.DSN)
+	assert.Equal(t, 5, cfg.DB.MaxIdleConns)
+	assert.Equal(t, LogLevelDebug, cfg.LogLevel)
+	// untouched settings keep their defaults
+	assert.Equal(t, 10*time.Second, cfg.Server.ReadTimeout)
+}
+
+func TestLoadConfigFlag(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("port: 9000\n"), 0o600))
+
+	cfg, err := Load([]string{"-config", path})
+	require.NoError(t, err)
+	assert.Equal(t, 9000, cfg.Port)
+}
+
+func TestLoadErrors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("prot: 9000\n"), 0o600))
+	_, err := Load([]string{"-config", path})
+	assert.ErrorContains(t, err, "prot")
+
+	_, err = Load([]string{"-help"})
+	assert.ErrorIs(t, err, flag.ErrHelp)
+
+	t.Setenv("FEM_TRACING_INSECURE", "yes please")
+	_, err = Load(nil)
+	assert.ErrorContains(t, err, "FEM_TRACING_INSECURE")
+
+	t.Setenv("FEM_TRACING_INSECURE", "true")
+	t.Setenv("FEM_DB_MAX_OPEN_CONNS", "many")
+	_, err = Load(nil)
+	assert.ErrorContains(t, err, "FEM_DB_MAX_OPEN_CONNS")
+}
+
+func TestValidate(t *testing.T) {
+	cfg := Default()
+	require.NoError(t, cfg.Validate())
+
+	cfg.Port = 0
+	cfg.LogLevel = "verbose"
+	cfg.DB.MaxOpenConns = 5
+	cfg.DB.MaxIdleConns = 10
+	cfg.Auth.BcryptCost = 2
+	cfg.Auth.RefreshTokenTTL = time.Minute
+	cfg.Auth.TOTPKey = "c2hvcnQ="
+	cfg.Tracing.Exporter = "jaeger"
+	cfg.Mail.Backend = "sendmail"
+	cfg.Storage.Backend = "s3"
+	cfg.Server.TrustedProxies = "10.0.0.0/8, proxy.internal"
+	err := cfg.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "port")
+	assert.Contains(t, err.Error(), "log_level")
+	assert.Contains(t, err.Error(), "max_idle_conns")
+	assert.Contains(t, err.Error(), "bcrypt_cost")
+	assert.Contains(t, err.Error(), "refresh_token_ttl")
+	assert.Contains(t, err.Error(), "totp_key")
+	assert.Contains(t, err.Error(), "tracing.exporter")
+	assert.Contains(t, err.Error(), "mail.backend")
+	assert.Contains(t, err.Error(), "storage.s3_bucket")
+	assert.Contains(t, err.Error(), "server.trusted_proxies")
+}
+
+func TestTrustedProxyPrefixes(t *testing.T) {
+	prefixes, err := ServerConfig{TrustedProxies: "10.1.2.3/8, 192.0.2.1,,2001:db8::/32"}.TrustedProxyPrefixes()
+	require.NoError(t, err)
+	assert.Equal(t, []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("192.0.2.1/32"),
+		netip.MustParsePrefix("2001:db8::/32"),
+	}, prefixes)
+
+	prefixes, err = ServerConfig{}.TrustedProxyPrefixes()
+	require.NoError(t, err)
+	assert.Empty(t, prefixes)
+}
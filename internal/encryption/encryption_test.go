@@ -0,0 +1,41 @@
+package encryption
+
+import (
+	"bytes"
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCipher(t *testing.T) {
+	key, err := ParseKey(base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{7}, KeySize)))
+	require.NoError(t, err)
+	c, err := NewCipher(key)
+	require.NoError(t, err)
+
+	sealed, err := c.Encrypt([]byte("JBSWY3DPEHPK3PXP"), []byte("1"))
+	require.NoError(t, err)
+	assert.NotContains(t, string(sealed), "JBSWY3DPEHPK3PXP")
+
+	again, err := c.Encrypt([]byte("JBSWY3DPEHPK3PXP"), []byte("1"))
+	require.NoError(t, err)
+	assert.NotEqual(t, sealed, again, "nonces must differ")
+
+	plain, err := c.Decrypt(sealed, []byte("1"))
+	require.NoError(t, err)
+	assert.Equal(t, "JBSWY3DPEHPK3PXP", string(plain))
+
+	_, err = c.Decrypt(sealed, []byte("2"))
+	assert.ErrorIs(t, err, ErrDecrypt)
+	_, err = c.Decrypt(sealed[:4], []byte("1"))
+	assert.ErrorIs(t, err, ErrDecrypt)
+}
+
+func TestParseKey(t *testing.T) {
+	_, err := ParseKey("not base64!")
+	assert.Error(t, err)
+	_, err = ParseKey(base64.StdEncoding.EncodeToString([]byte("short")))
+	assert.Error(t, err)
+}
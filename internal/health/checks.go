@@ -0,0 +1,114 @@
+package health
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io/fs"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/pressly/goose/v3"
+)
+
+// DBPing fails when the database does not answer a ping in time.
+func DBPing(db *sql.DB) Checker {
+	return CheckerFunc{
+		CheckName: "database",
+		Func: func(ctx context.Context) (interface{}, error) {
+			return nil, db.PingContext(ctx)
+		},
+	}
+}
+
+type migrationDetails struct {
+	Current  int64 `json:"current"`
+	Expected int64 `json:"expected"`
+}
+
+// MigrationVersion fails when the database schema is not at the latest
+// version of the goose migrations embedded in migrationFS.
+func MigrationVersion(db *sql.DB, migrationFS fs.FS) Checker {
+	return CheckerFunc{
+		CheckName: "migrations",
+		Func: func(ctx context.Context) (interface{}, error) {
+			expected, err := LatestMigration(migrationFS)
+			if err != nil {
+				return nil, err
+			}
+			current, err := goose.GetDBVersionContext(ctx, db)
+			if err != nil {
+				return nil, err
+			}
+
+			details := migrationDetails{Current: current, Expected: expected}
+			if current != expected {
+				return details, fmt.Errorf("schema is at version %d, expected %d", current, expected)
+			}
+			return details, nil
+		},
+	}
+}
+
+// LatestMigration returns the highest version among the goose migrations in
+// the root of migrationFS, whose names start with the version, e.g. 00012_progression.sql.
+func LatestMigration(migrationFS fs.FS) (int64, error) {
+	names, err := fs.Glob(migrationFS, "*.sql")
+	if err != nil {
+		return 0, err
+	}
+
+	var latest int64
+	for _, name := range names {
+		prefix, _, ok := strings.Cut(path.Base(name), "_")
+		if !ok {
+			continue
+		}
+		version, err := strconv.ParseInt(prefix, 10, 64)
+		if err != nil {
+			continue
+		}
+		latest = max(latest, version)
+	}
+	if latest == 0 {
+		return 0, fmt.Errorf("no migrations found")
+	}
+	return latest, nil
+}
+
+type poolDetails struct {
+	Open      int     `json:"open"`
+	InUse     int     `json:"in_use"`
+	Idle      int     `json:"idle"`
+	MaxOpen   int     `json:"max_open"`
+	WaitCount int64   `json:"wait_count"`
+	Usage     float64 `json:"usage"`
+}
+
+// PoolSaturation fails when at least threshold (0 to 1) of the connections
+// the pool may open are in use. It never fails for an unlimited pool.
+func PoolSaturation(db *sql.DB, threshold float64) Checker {
+	return CheckerFunc{
+		CheckName: "database_pool",
+		Func: func(ctx context.Context) (interface{}, error) {
+			stats := db.Stats()
+			details := poolDetails{
+				Open:      stats.OpenConnections,
+				InUse:     stats.InUse,
+				Idle:      stats.Idle,
+				MaxOpen:   stats.MaxOpenConnections,
+				WaitCount: stats.WaitCount,
+			}
+			if stats.MaxOpenConnections == 0 {
+				return details, nil
+			}
+
+			details.Usage = float64(stats.InUse) / float64(stats.MaxOpenConnections)
+			if details.Usage >= threshold {
+				return details, fmt.Errorf("%d of %d connections in use", stats.InUse, stats.MaxOpenConnections)
+			}
+			return details, nil
+		},
+	}
+}
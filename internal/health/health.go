@@ -0,0 +1,140 @@
+package health
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	StatusOK   = "ok"
+	StatusFail = "fail"
+)
+
+// Checker probes one dependency of the application. Check returns details
+// worth reporting, which may be nil, and an error when the dependency is
+// unhealthy. It must give up once ctx is done.
+type Checker interface {
+	Name() string
+	Check(ctx context.Context) (interface{}, error)
+}
+
+// CheckerFunc adapts a function to the Checker interface.
+type CheckerFunc struct {
+	CheckName string
+	Func      func(ctx context.Context) (interface{}, error)
+}
+
+func (c CheckerFunc) Name() string { return c.CheckName }
+
+func (c CheckerFunc) Check(ctx context.Context) (interface{}, error) { return c.Func(ctx) }
+
+type Result struct {
+	Name      string      `json:"name"`
+	Status    string      `json:"status"`
+	Error     string      `json:"error,omitempty"`
+	Details   interface{} `json:"details,omitempty"`
+	Duration  string      `json:"duration"`
+	CheckedAt time.Time   `json:"checked_at"`
+}
+
+type Report struct {
+	Status string   `json:"status"`
+	Checks []Result `json:"checks"`
+}
+
+// Healthy reports whether every check passed.
+func (r *Report) Healthy() bool {
+	return r.Status == StatusOK
+}
+
+// Registry runs the registered checkers with a per-check timeout and caches
+// each result for ttl, so frequent probes do not hammer the dependencies.
+type Registry struct {
+	timeout time.Duration
+	ttl     time.Duration
+	now     func() time.Time
+
+	mu       sync.Mutex
+	checkers []Checker
+	cache    map[string]Result
+}
+
+func NewRegistry(timeout, ttl time.Duration) *Registry {
+	return &Registry{
+		timeout: timeout,
+		ttl:     ttl,
+		now:     time.Now,
+		cache:   map[string]Result{},
+	}
+}
+
+func (r *Registry) Register(checker Checker) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.checkers = append(r.checkers, checker)
+}
+
+// Run returns the result of every checker, in registration order, running
+// the ones whose cached result has expired concurrently.
+func (r *Registry) Run(ctx context.Context) Report {
+	r.mu.Lock()
+	checkers := append([]Checker{}, r.checkers...)
+	r.mu.Unlock()
+
+	report := Report{Status: StatusOK, Checks: make([]Result, len(checkers))}
+	var wg sync.WaitGroup
+	for i, checker := range checkers {
+		if result, ok := r.cached(checker.Name()); ok {
+			report.Checks[i] = result
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			report.Checks[i] = r.check(ctx, checker)
+		}()
+	}
+	wg.Wait()
+
+	for _, result := range report.Checks {
+		if result.Status != StatusOK {
+			report.Status = StatusFail
+		}
+	}
+	return report
+}
+
+func (r *Registry) cached(name string) (Result, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	result, ok := r.cache[name]
+	if !ok || r.now().Sub(result.CheckedAt) >= r.ttl {
+		return Result{}, false
+	}
+	return result, true
+}
+
+func (r *Registry) check(ctx context.Context, checker Checker) Result {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	start := r.now()
+	details, err := checker.Check(ctx)
+	result := Result{
+		Name:      checker.Name(),
+		Status:    StatusOK,
+		Details:   details,
+		Duration:  r.now().Sub(start).String(),
+		CheckedAt: start,
+	}
+	if err != nil {
+		result.Status = StatusFail
+		result.Error = err.Error()
+	}
+
+	r.mu.Lock()
+	r.cache[result.Name] = result
+	r.mu.Unlock()
+	return result
+}
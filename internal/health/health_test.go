@@ -0,0 +1,79 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/dapoadedire/fem_project/migrations"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistryCachesResults(t *testing.T) {
+	registry := NewRegistry(time.Second, 10*time.Second)
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	registry.now = func() time.Time { return now }
+
+	calls := 0
+	var failure error
+	registry.Register(CheckerFunc{CheckName: "flaky", Func: func(ctx context.Context) (interface{}, error) {
+		calls++
+		return map[string]int{"calls": calls}, failure
+	}})
+	registry.Register(CheckerFunc{CheckName: "steady", Func: func(ctx context.Context) (interface{}, error) {
+		return nil, nil
+	}})
+
+	report := registry.Run(context.Background())
+	assert.True(t, report.Healthy())
+	require.Len(t, report.Checks, 2)
+	assert.Equal(t, "flaky", report.Checks[0].Name)
+	assert.Equal(t, "steady", report.Checks[1].Name)
+
+	failure = errors.New("down")
+	now = now.Add(5 * time.Second)
+	report = registry.Run(context.Background())
+	assert.True(t, report.Healthy(), "the cached result is still fresh")
+	assert.Equal(t, 1, calls)
+
+	now = now.Add(5 * time.Second)
+	report = registry.Run(context.Background())
+	assert.False(t, report.Healthy())
+	assert.Equal(t, StatusFail, report.Checks[0].Status)
+	assert.Equal(t, "down", report.Checks[0].Error)
+	assert.Equal(t, StatusOK, report.Checks[1].Status)
+	assert.Equal(t, 2, calls)
+}
+
+func TestRegistryTimeout(t *testing.T) {
+	registry := NewRegistry(10*time.Millisecond, time.Second)
+	registry.Register(CheckerFunc{CheckName: "slow", Func: func(ctx context.Context) (interface{}, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}})
+
+	report := registry.Run(context.Background())
+	assert.False(t, report.Healthy())
+	assert.Contains(t, report.Checks[0].Error, "deadline exceeded")
+}
+
+func TestLatestMigration(t *testing.T) {
+	version, err := LatestMigration(fstest.MapFS{
+		"00001_users.sql":    {},
+		"00012_progress.sql": {},
+		"00003_entries.sql":  {},
+		"fs.go":              {},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int64(12), version)
+
+	_, err = LatestMigration(fstest.MapFS{})
+	assert.Error(t, err)
+
+	version, err = LatestMigration(migrations.FS)
+	require.NoError(t, err)
+	assert.Positive(t, version)
+}
@@ -0,0 +1,507 @@
+package importer
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dapoadedire/fem_project/internal/store"
+)
+
+const (
+	PresetNative = "native"
+	PresetStrong = "strong"
+	PresetHevy   = "hevy"
+
+	DurationMinutes = "minutes"
+	DurationSeconds = "seconds"
+	// DurationText is a Go-style duration with optional spaces, e.g. "1h 5m".
+	DurationText = "text"
+
+	defaultTitle  = "Imported workout"
+	maxNameLength = 255
+	// workout_entries.weight is DECIMAL(5,2)
+	maxWeight = 1000
+)
+
+// Mapping names the CSV column (by header) that holds each field. Empty
+// fields are not imported. Date and Exercise are required, as is one of Reps
+// and DurationSeconds.
+//
+// Rows are grouped into workouts by WorkoutID when it is mapped, otherwise by
+// Date and Title. Workout fields are taken from the first row of each group.
+// When Sets is not mapped every row is one set, and consecutive identical sets
+// of an exercise are merged into a single entry.
+//
+// DateLayout is a time.Parse layout; when empty RFC3339 and YYYY-MM-DD are
+// accepted. Dates without a zone are read in the location passed to Parse.
+// DurationUnit is one of "minutes" (the default), "seconds" or "text". When
+// Duration is not mapped it is computed from Date and EndDate.
+type Mapping struct {
+	WorkoutID       string `json:"workout_id"`
+	Date            string `json:"date"`
+	EndDate         string `json:"end_date"`
+	DateLayout      string `json:"date_layout"`
+	Title           string `json:"title"`
+	Description     string `json:"description"`
+	Duration        string `json:"duration"`
+	DurationUnit    string `json:"duration_unit"`
+	Calories        string `json:"calories"`
+	Exercise        string `json:"exercise"`
+	Sets            string `json:"sets"`
+	Reps            string `json:"reps"`
+	DurationSeconds string `json:"duration_seconds"`
+	Weight          string `json:"weight"`
+	RPE             string `json:"rpe"`
+	Notes           string `json:"notes"`
+}
+
+var presets = map[string]Mapping{
+	// the format written by GET /users/me/export?format=csv
+	PresetNative: {
+		WorkoutID:       "workout_id",
+		Date:            "workout_date",
+		Title:           "title",
+		Description:     "description",
+		Duration:        "duration_minutes",
+		Calories:        "calories_burned",
+		Exercise:        "exercise_name",
+		Sets:            "sets",
+		Reps:            "reps",
+		DurationSeconds: "duration_seconds",
+		Weight:          "weight",
+		RPE:             "rpe",
+		Notes:           "notes",
+	},
+	PresetStrong: {
+		Date:            "Date",
+		DateLayout:      "2006-01-02 15:04:05",
+		Title:           "Workout Name",
+		Description:     "Workout Notes",
+		Duration:        "Duration",
+		DurationUnit:    DurationText,
+		Exercise:        "Exercise Name",
+		Reps:            "Reps",
+		DurationSeconds: "Seconds",
+		Weight:          "Weight",
+		RPE:             "RPE",
+		Notes:           "Notes",
+	},
+	PresetHevy: {
+		Date:            "start_time",
+		EndDate:         "end_time",
+		DateLayout:      "2 Jan 2006, 15:04",
+		Title:           "title",
+		Description:     "description",
+		Exercise:        "exercise_title",
+		Reps:            "reps",
+		DurationSeconds: "duration_seconds",
+		Weight:          "weight_kg",
+		RPE:             "rpe",
+		Notes:           "exercise_notes",
+	},
+}
+
+func Preset(name string) (Mapping, bool) {
+	mapping, ok := presets[name]
+	return mapping, ok
+}
+
+// PresetNames lists the built-in mappings in alphabetical order.
+func PresetNames() []string {
+	names := make([]string, 0, len(presets))
+	for name := range presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (m *Mapping) Validate() error {
+	switch {
+	case m.Date == "":
+		return errors.New("mapping must name the date column")
+	case m.Exercise == "":
+		return errors.New("mapping must name the exercise column")
+	case m.Reps == "" && m.DurationSeconds == "":
+		return errors.New("mapping must name the reps or duration_seconds column")
+	}
+	switch m.DurationUnit {
+	case "", DurationMinutes, DurationSeconds, DurationText:
+	default:
+		return errors.New("duration_unit must be minutes, seconds or text")
+	}
+	return nil
+}
+
+// Group is a workout assembled from one or more CSV rows.
+type Group struct {
+	Workout store.Workout
+	// Rows are the line numbers the workout was read from.
+	Rows []int
+}
+
+type RowError struct {
+	Row   int    `json:"row"`
+	Error string `json:"error"`
+}
+
+// Parse reads CSV with a header line from r and groups its rows into workouts
+// according to m. Invalid rows are reported as RowErrors and the workouts they
+// belong to are left out of the result. The error is only set when the input
+// as a whole cannot be read.
+func Parse(r io.Reader, m Mapping, loc *time.Location) ([]*Group, []RowError, error) {
+	err := m.Validate()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, nil, errors.New("the file is empty")
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	columns, err := newColumns(header, &m)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	p := &parser{mapping: m, columns: columns, loc: loc, groups: map[string]*Group{}, invalid: map[string]bool{}}
+	rowErrors := []RowError{}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			rowErrors = append(rowErrors, RowError{Row: parseErr.StartLine, Error: parseErr.Err.Error()})
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		line, _ := reader.FieldPos(0)
+		err = p.addRow(line, record)
+		if err != nil {
+			rowErrors = append(rowErrors, RowError{Row: line, Error: err.Error()})
+		}
+	}
+
+	groups := make([]*Group, 0, len(p.order))
+	for _, key := range p.order {
+		if !p.invalid[key] {
+			groups = append(groups, p.groups[key])
+		}
+	}
+	return groups, rowErrors, nil
+}
+
+// columns maps the header name of each mapped field to its index.
+type columns map[string]int
+
+func newColumns(header []string, m *Mapping) (columns, error) {
+	index := make(map[string]int, len(header))
+	for i, name := range header {
+		if i == 0 {
+			name = strings.TrimPrefix(name, "\ufeff")
+		}
+		index[strings.TrimSpace(name)] = i
+	}
+
+	c := columns{}
+	for _, name := range []string{
+		m.WorkoutID, m.Date, m.EndDate, m.Title, m.Description, m.Duration, m.Calories,
+		m.Exercise, m.Sets, m.Reps, m.DurationSeconds, m.Weight, m.RPE, m.Notes,
+	} {
+		if name == "" {
+			continue
+		}
+		i, ok := index[name]
+		if !ok {
+			return nil, fmt.Errorf("column %q not found in the header", name)
+		}
+		c[name] = i
+	}
+	return c, nil
+}
+
+type parser struct {
+	mapping Mapping
+	columns columns
+	loc     *time.Location
+	groups  map[string]*Group
+	order   []string
+	invalid map[string]bool
+}
+
+func (p *parser) field(record []string, column string) string {
+	i, ok := p.columns[column]
+	if column == "" || !ok || i >= len(record) {
+		return ""
+	}
+	return strings.TrimSpace(record[i])
+}
+
+func (p *parser) addRow(line int, record []string) error {
+	m := &p.mapping
+	key := p.field(record, m.WorkoutID)
+	if key == "" {
+		key = p.field(record, m.Date) + "\x00" + p.field(record, m.Title)
+	}
+
+	group, ok := p.groups[key]
+	if !ok {
+		group = &Group{Workout: store.Workout{Entries: []store.WorkoutEntry{}}}
+		p.groups[key] = group
+		p.order = append(p.order, key)
+	}
+	group.Rows = append(group.Rows, line)
+
+	var err error
+	if !ok {
+		err = p.readWorkout(record, &group.Workout)
+	}
+	if err == nil {
+		err = p.readEntry(record, &group.Workout)
+	}
+	if err != nil {
+		p.invalid[key] = true
+	}
+	return err
+}
+
+func (p *parser) readWorkout(record []string, workout *store.Workout) error {
+	m := &p.mapping
+	start, err := p.parseDate(p.field(record, m.Date))
+	if err != nil {
+		return fmt.Errorf("%s: %w", m.Date, err)
+	}
+	workout.CreatedAt = start
+
+	workout.Title = p.field(record, m.Title)
+	if workout.Title == "" {
+		workout.Title = defaultTitle
+	}
+	if len(workout.Title) > maxNameLength {
+		return fmt.Errorf("%s: must not be longer than %d characters", m.Title, maxNameLength)
+	}
+	workout.Description = p.field(record, m.Description)
+
+	if m.Duration != "" {
+		workout.DurationMinutes, err = parseDuration(p.field(record, m.Duration), m.DurationUnit)
+		if err != nil {
+			return fmt.Errorf("%s: %w", m.Duration, err)
+		}
+	} else if end := p.field(record, m.EndDate); end != "" {
+		endTime, err := p.parseDate(end)
+		if err != nil {
+			return fmt.Errorf("%s: %w", m.EndDate, err)
+		}
+		workout.DurationMinutes = int(endTime.Sub(start).Round(time.Minute).Minutes())
+	}
+	if workout.DurationMinutes < 0 {
+		return errors.New("duration must not be negative")
+	}
+
+	calories, err := parseOptionalInt(p.field(record, m.Calories))
+	if err != nil {
+		return fmt.Errorf("%s: %w", m.Calories, err)
+	}
+	if calories != nil {
+		workout.CaloriesBurned = *calories
+	}
+	return nil
+}
+
+// readEntry adds the row's entry to the workout, merging it into the previous
+// entry when it is another identical set. A row without an exercise only
+// describes the workout.
+func (p *parser) readEntry(record []string, workout *store.Workout) error {
+	m := &p.mapping
+	entry := store.WorkoutEntry{
+		ExerciseName: p.field(record, m.Exercise),
+		Notes:        p.field(record, m.Notes),
+		Sets:         1,
+	}
+
+	var err error
+	if entry.Reps, err = parseOptionalInt(p.field(record, m.Reps)); err != nil {
+		return fmt.Errorf("%s: %w", m.Reps, err)
+	}
+	if entry.DurationSeconds, err = parseOptionalInt(p.field(record, m.DurationSeconds)); err != nil {
+		return fmt.Errorf("%s: %w", m.DurationSeconds, err)
+	}
+	if entry.Weight, err = parseOptionalFloat(p.field(record, m.Weight)); err != nil {
+		return fmt.Errorf("%s: %w", m.Weight, err)
+	}
+	if entry.Weight != nil {
+		// round to the column's scale first, so 999.995 fails the range
+		// check below rather than overflowing as 1000.00
+		*entry.Weight = math.Round(*entry.Weight*100) / 100
+	}
+	if entry.RPE, err = parseOptionalFloat(p.field(record, m.RPE)); err != nil {
+		return fmt.Errorf("%s: %w", m.RPE, err)
+	}
+	if m.Sets != "" {
+		sets, err := parseOptionalInt(p.field(record, m.Sets))
+		if err != nil {
+			return fmt.Errorf("%s: %w", m.Sets, err)
+		}
+		if sets != nil {
+			entry.Sets = *sets
+		}
+	}
+
+	// exports write 0 rather than nothing for the measurement they don't use
+	if entry.Reps != nil && *entry.Reps == 0 {
+		entry.Reps = nil
+	}
+	if entry.DurationSeconds != nil && *entry.DurationSeconds == 0 {
+		entry.DurationSeconds = nil
+	}
+	if entry.Weight != nil && *entry.Weight == 0 {
+		entry.Weight = nil
+	}
+
+	if entry.ExerciseName == "" {
+		if entry.Reps != nil || entry.DurationSeconds != nil {
+			return fmt.Errorf("%s: is required", m.Exercise)
+		}
+		return nil
+	}
+
+	switch {
+	case len(entry.ExerciseName) > maxNameLength:
+		return fmt.Errorf("%s: must not be longer than %d characters", m.Exercise, maxNameLength)
+	case entry.Reps == nil && entry.DurationSeconds == nil:
+		return errors.New("either reps or duration_seconds is required")
+	case entry.Reps != nil && entry.DurationSeconds != nil:
+		return errors.New("only one of reps and duration_seconds may be set")
+	case entry.Reps != nil && *entry.Reps < 0, entry.DurationSeconds != nil && *entry.DurationSeconds < 0:
+		return errors.New("reps and duration_seconds must not be negative")
+	case entry.Sets < 1:
+		return errors.New("sets must be at least 1")
+	case entry.Weight != nil && (*entry.Weight < 0 || *entry.Weight >= maxWeight):
+		return fmt.Errorf("weight must be between 0 and %d", maxWeight)
+	case entry.RPE != nil && (*entry.RPE < 1 || *entry.RPE > 10):
+		return errors.New("rpe must be between 1 and 10")
+	}
+
+	if m.Sets == "" && len(workout.Entries) > 0 {
+		last := &workout.Entries[len(workout.Entries)-1]
+		if sameSet(last, &entry) {
+			last.Sets++
+			if last.Notes == "" {
+				last.Notes = entry.Notes
+			}
+			return nil
+		}
+	}
+
+	entry.OrderIndex = len(workout.Entries) + 1
+	workout.Entries = append(workout.Entries, entry)
+	return nil
+}
+
+func sameSet(a, b *store.WorkoutEntry) bool {
+	return strings.EqualFold(a.ExerciseName, b.ExerciseName) &&
+		equalInt(a.Reps, b.Reps) &&
+		equalInt(a.DurationSeconds, b.DurationSeconds) &&
+		equalFloat(a.Weight, b.Weight) &&
+		equalFloat(a.RPE, b.RPE)
+}
+
+func equalInt(a, b *int) bool {
+	return (a == nil && b == nil) || (a != nil && b != nil && *a == *b)
+}
+
+func equalFloat(a, b *float64) bool {
+	return (a == nil && b == nil) || (a != nil && b != nil && *a == *b)
+}
+
+func (p *parser) parseDate(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, errors.New("is required")
+	}
+	if p.mapping.DateLayout != "" {
+		t, err := time.ParseInLocation(p.mapping.DateLayout, value, p.loc)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("must match the layout %q", p.mapping.DateLayout)
+		}
+		return t, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", value, p.loc)
+	if err != nil {
+		return time.Time{}, errors.New("must be an RFC3339 timestamp or a YYYY-MM-DD date")
+	}
+	return t, nil
+}
+
+// parseDuration returns value, in the given unit, as whole minutes.
+func parseDuration(value, unit string) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+	switch unit {
+	case DurationSeconds:
+		seconds, err := strconv.Atoi(value)
+		if err != nil {
+			return 0, errors.New("must be a whole number of seconds")
+		}
+		return int((time.Duration(seconds) * time.Second).Round(time.Minute).Minutes()), nil
+	case DurationText:
+		if minutes, err := strconv.Atoi(value); err == nil {
+			return minutes, nil
+		}
+		d, err := time.ParseDuration(strings.ReplaceAll(value, " ", ""))
+		if err != nil {
+			return 0, errors.New(`must be a duration such as "1h 5m"`)
+		}
+		return int(d.Round(time.Minute).Minutes()), nil
+	default:
+		minutes, err := strconv.Atoi(value)
+		if err != nil {
+			return 0, errors.New("must be a whole number of minutes")
+		}
+		return minutes, nil
+	}
+}
+
+func parseOptionalInt(value string) (*int, error) {
+	if value == "" {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return nil, errors.New("must be a whole number")
+	}
+	return &n, nil
+}
+
+func parseOptionalFloat(value string) (*float64, error) {
+	if value == "" {
+		return nil, nil
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return nil, errors.New("must be a number")
+	}
+	return &f, nil
+}
@@ -0,0 +1,134 @@
+package importer
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseStrong(t *testing.T) {
+	input := `Date,Workout Name,Duration,Exercise Name,Set Order,Weight,Reps,Distance,Seconds,Notes,Workout Notes,RPE
+2024-01-08 18:00:00,Push,1h 5m,Bench Press (Barbell),1,80,5,0,0,,felt good,
+2024-01-08 18:00:00,Push,1h 5m,Bench Press (Barbell),2,80,5,0,0,,felt good,
+2024-01-08 18:00:00,Push,1h 5m,Bench Press (Barbell),3,80,4,0,0,,felt good,8.5
+2024-01-08 18:00:00,Push,1h 5m,Plank,1,0,0,0,60,,felt good,
+2024-01-10 18:00:00,Pull,45m,Deadlift,1,140,5,0,0,,,
+`
+	mapping, ok := Preset(PresetStrong)
+	require.True(t, ok)
+
+	groups, rowErrors, err := Parse(strings.NewReader(input), mapping, time.UTC)
+	require.NoError(t, err)
+	assert.Empty(t, rowErrors)
+	require.Len(t, groups, 2)
+
+	push := groups[0].Workout
+	assert.Equal(t, "Push", push.Title)
+	assert.Equal(t, "felt good", push.Description)
+	assert.Equal(t, 65, push.DurationMinutes)
+	assert.Equal(t, time.Date(2024, 1, 8, 18, 0, 0, 0, time.UTC), push.CreatedAt)
+	assert.Equal(t, []int{2, 3, 4, 5}, groups[0].Rows)
+	require.Len(t, push.Entries, 3)
+
+	assert.Equal(t, "Bench Press (Barbell)", push.Entries[0].ExerciseName)
+	assert.Equal(t, 2, push.Entries[0].Sets)
+	assert.Equal(t, 5, *push.Entries[0].Reps)
+	assert.Equal(t, 80.0, *push.Entries[0].Weight)
+	assert.Equal(t, 1, push.Entries[0].OrderIndex)
+
+	assert.Equal(t, 1, push.Entries[1].Sets)
+	assert.Equal(t, 8.5, *push.Entries[1].RPE)
+
+	assert.Nil(t, push.Entries[2].Reps)
+	assert.Nil(t, push.Entries[2].Weight)
+	assert.Equal(t, 60, *push.Entries[2].DurationSeconds)
+	assert.Equal(t, 3, push.Entries[2].OrderIndex)
+
+	assert.Equal(t, 45, groups[1].Workout.DurationMinutes)
+}
+
+func TestParseHevy(t *testing.T) {
+	input := `"title","start_time","end_time","description","exercise_title","superset_id","exercise_notes","set_index","set_type","weight_kg","reps","distance_km","duration_seconds","rpe"
+"Legs","26 Jan 2024, 07:05","26 Jan 2024, 08:15","","Squat (Barbell)",,"",0,"normal",100,5,,,
+"Legs","26 Jan 2024, 07:05","26 Jan 2024, 08:15","","Squat (Barbell)",,"",1,"normal",100,5,,,
+`
+	mapping, _ := Preset(PresetHevy)
+	location, err := time.LoadLocation("Europe/Berlin")
+	require.NoError(t, err)
+
+	groups, rowErrors, err := Parse(strings.NewReader(input), mapping, location)
+	require.NoError(t, err)
+	assert.Empty(t, rowErrors)
+	require.Len(t, groups, 1)
+
+	workout := groups[0].Workout
+	assert.Equal(t, 70, workout.DurationMinutes)
+	assert.Equal(t, time.Date(2024, 1, 26, 6, 5, 0, 0, time.UTC), workout.CreatedAt.UTC())
+	require.Len(t, workout.Entries, 1)
+	assert.Equal(t, 2, workout.Entries[0].Sets)
+}
+
+func TestParseNative(t *testing.T) {
+	input := `workout_id,workout_date,title,description,duration_minutes,calories_burned,entry_id,exercise_id,exercise_name,sets,reps,duration_seconds,weight,rpe,notes,order_index
+7,2024-03-01T10:00:00Z,Run,,30,300,,,,,,,,,,
+8,2024-03-02T10:00:00Z,Legs,,60,0,11,1,Squat,5,5,,100,,,1
+8,2024-03-02T10:00:00Z,Legs,,60,0,12,,Lunge,3,10,,20,,,2
+`
+	mapping, _ := Preset(PresetNative)
+	groups, rowErrors, err := Parse(strings.NewReader(input), mapping, time.UTC)
+	require.NoError(t, err)
+	assert.Empty(t, rowErrors)
+	require.Len(t, groups, 2)
+
+	assert.Equal(t, 300, groups[0].Workout.CaloriesBurned)
+	assert.Empty(t, groups[0].Workout.Entries)
+
+	legs := groups[1].Workout
+	require.Len(t, legs.Entries, 2)
+	assert.Equal(t, 5, legs.Entries[0].Sets)
+	assert.Nil(t, legs.Entries[0].ExerciseID)
+	assert.Equal(t, "Lunge", legs.Entries[1].ExerciseName)
+}
+
+func TestParseRowErrors(t *testing.T) {
+	input := `date,title,exercise,reps,seconds,weight
+2024-03-01,A,Squat,5,,100
+2024-03-01,A,Plank,,,
+2024-03-02,B,Plank,,60,
+2024-03-03,C,Squat,5,30,
+2024-03-04,D,Squat,five,,
+2024-03-05,E,Squat,5,,999.995
+2024-03-06,F,Squat,5,,999.994
+`
+	mapping := Mapping{Date: "date", Title: "title", Exercise: "exercise", Reps: "reps", DurationSeconds: "seconds", Weight: "weight"}
+	groups, rowErrors, err := Parse(strings.NewReader(input), mapping, time.UTC)
+	require.NoError(t, err)
+
+	// workouts with an invalid row are left out entirely
+	require.Len(t, groups, 2)
+	assert.Equal(t, "B", groups[0].Workout.Title)
+	assert.Equal(t, "F", groups[1].Workout.Title)
+	assert.Equal(t, 999.99, *groups[1].Workout.Entries[0].Weight)
+
+	require.Len(t, rowErrors, 4)
+	assert.Equal(t, 3, rowErrors[0].Row)
+	assert.Contains(t, rowErrors[0].Error, "either reps or duration_seconds")
+	assert.Equal(t, 5, rowErrors[1].Row)
+	assert.Contains(t, rowErrors[1].Error, "only one of")
+	assert.Equal(t, 6, rowErrors[2].Row)
+	assert.Contains(t, rowErrors[2].Error, "reps: must be a whole number")
+	assert.Equal(t, 7, rowErrors[3].Row)
+	assert.Contains(t, rowErrors[3].Error, "weight must be between")
+}
+
+func TestParseMissingColumn(t *testing.T) {
+	mapping, _ := Preset(PresetStrong)
+	_, _, err := Parse(strings.NewReader("Date,Exercise Name\n"), mapping, time.UTC)
+	assert.ErrorContains(t, err, "not found")
+
+	_, _, err = Parse(strings.NewReader("date\n"), Mapping{Date: "date"}, time.UTC)
+	assert.ErrorContains(t, err, "exercise")
+}
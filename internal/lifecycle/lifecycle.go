@@ -0,0 +1,153 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// Manager runs the HTTP server alongside background workers and, on SIGINT,
+// SIGTERM or cancellation, shuts them down in order: readiness turns
+// unhealthy, the server stops accepting connections and drains in-flight
+// requests, the workers are stopped and finally the registered closers run.
+type Manager struct {
+	// ShutdownDelay keeps the server accepting requests, while reporting not
+	// ready, so load balancers can stop routing to it before it drains.
+	ShutdownDelay time.Duration
+	// ShutdownTimeout bounds draining requests and stopping workers together.
+	ShutdownTimeout time.Duration
+
+	logger   *slog.Logger
+	draining atomic.Bool
+	workers  []worker
+	closers  []closer
+}
+
+type worker struct {
+	name string
+	run  func(ctx context.Context) error
+}
+
+type closer struct {
+	name  string
+	close func() error
+}
+
+func New(shutdownDelay, shutdownTimeout time.Duration, logger *slog.Logger) *Manager {
+	return &Manager{
+		ShutdownDelay:   shutdownDelay,
+		ShutdownTimeout: shutdownTimeout,
+		logger:          logger,
+	}
+}
+
+// Go registers a background worker started by Run. Its context is cancelled
+// once the server has drained and it should return promptly after that.
+func (m *Manager) Go(name string, run func(ctx context.Context) error) {
+	m.workers = append(m.workers, worker{name: name, run: run})
+}
+
+// OnShutdown registers a resource closed after the server and workers have
+// stopped. Closers run in the reverse order they were registered in.
+func (m *Manager) OnShutdown(name string, close func() error) {
+	m.closers = append(m.closers, closer{name: name, close: close})
+}
+
+// Draining reports whether shutdown has started, in which case the
+// application should no longer be considered ready.
+func (m *Manager) Draining() bool {
+	return m.draining.Load()
+}
+
+// Run listens on server.Addr and serves until a shutdown signal arrives or ctx
+// is cancelled, then shuts everything down.
+func (m *Manager) Run(ctx context.Context, server *http.Server) error {
+	listener, err := net.Listen("tcp", server.Addr)
+	if err != nil {
+		m.close()
+		return err
+	}
+	return m.Serve(ctx, server, listener)
+}
+
+// Serve is Run on an existing listener.
+func (m *Manager) Serve(ctx context.Context, server *http.Server, listener net.Listener) error {
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+	var wg sync.WaitGroup
+	for _, w := range m.workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := w.run(workerCtx)
+			if err != nil && !errors.Is(err, context.Canceled) {
+				m.logger.Error("worker stopped", "worker", w.name, "error", err)
+			}
+		}()
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- server.Serve(listener)
+	}()
+
+	var err error
+	select {
+	case err = <-serveErr:
+		// the server failed on its own, there are no requests left to drain
+		m.draining.Store(true)
+	case <-ctx.Done():
+		stop()
+		m.logger.Info("shutting down", "delay", m.ShutdownDelay, "timeout", m.ShutdownTimeout)
+		m.draining.Store(true)
+		time.Sleep(m.ShutdownDelay)
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), m.ShutdownTimeout)
+	defer cancel()
+	if err == nil {
+		err = server.Shutdown(shutdownCtx)
+		if err != nil {
+			m.logger.Error("draining requests", "error", err)
+			server.Close()
+		}
+	}
+
+	stopWorkers()
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-shutdownCtx.Done():
+		m.logger.Error("workers did not stop before the shutdown deadline")
+	}
+
+	m.close()
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+func (m *Manager) close() {
+	for i := len(m.closers) - 1; i >= 0; i-- {
+		err := m.closers[i].close()
+		if err != nil {
+			m.logger.Error("closing", "resource", m.closers[i].name, "error", err)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package lifecycle
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServeDrainsAndClosesInOrder(t *testing.T) {
+	m := New(0, 5*time.Second, slog.New(slog.DiscardHandler))
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.Write([]byte("done"))
+	})}
+
+	var order []string
+	workerStopped := make(chan struct{})
+	m.Go("worker", func(ctx context.Context) error {
+		<-ctx.Done()
+		order = append(order, "worker")
+		close(workerStopped)
+		return ctx.Err()
+	})
+	m.OnShutdown("db", func() error {
+		order = append(order, "db")
+		return nil
+	})
+	m.OnShutdown("cache", func() error {
+		order = append(order, "cache")
+		return nil
+	})
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() {
+		served <- m.Serve(ctx, server, listener)
+	}()
+
+	body := make(chan string, 1)
+	go func() {
+		res, err := http.Get("http://" + listener.Addr().String())
+		if err != nil {
+			body <- err.Error()
+			return
+		}
+		defer res.Body.Close()
+		b, _ := io.ReadAll(res.Body)
+		body <- string(b)
+	}()
+
+	<-started
+	assert.False(t, m.Draining())
+	cancel()
+	require.Eventually(t, m.Draining, time.Second, 10*time.Millisecond)
+
+	// the in-flight request finishes before the workers stop
+	select {
+	case <-workerStopped:
+		t.Fatal("worker stopped before the request drained")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+
+	assert.Equal(t, "done", <-body)
+	require.NoError(t, <-served)
+	assert.Equal(t, []string{"worker", "cache", "db"}, order)
+}
+
+func TestServeDeadline(t *testing.T) {
+	m := New(0, 50*time.Millisecond, slog.New(slog.DiscardHandler))
+
+	started := make(chan struct{})
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-r.Context().Done()
+	})}
+	closed := false
+	m.OnShutdown("db", func() error {
+		closed = true
+		return nil
+	})
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() {
+		served <- m.Serve(ctx, server, listener)
+	}()
+	go http.Get("http://" + listener.Addr().String())
+
+	<-started
+	cancel()
+	assert.ErrorIs(t, <-served, context.DeadlineExceeded)
+	assert.True(t, closed)
+}
@@ -0,0 +1,149 @@
+package mailer
+
+import (
+	"context"
+	"net"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testMessage = Message{
+	To:      "alice@example.com",
+	Subject: "Reset your password",
+	Body:    "Your token is ABC.\nIt expires soon.",
+}
+
+func TestFormat(t *testing.T) {
+	data, err := format("fem_project <no-reply@example.com>", testMessage, time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC))
+	require.NoError(t, err)
+
+	msg := string(data)
+	assert.Contains(t, msg, "From: fem_project <no-reply@example.com>\r\n")
+	assert.Contains(t, msg, "To: alice@example.com\r\n")
+	assert.Contains(t, msg, "Subject: Reset your password\r\n")
+	assert.Contains(t, msg, "Date: Thu, 02 Jan 2025 03:04:05 +0000\r\n")
+	assert.Contains(t, msg, "@example.com>\r\n")
+	assert.True(t, strings.HasSuffix(msg, "\r\n\r\nYour token is ABC.\r\nIt expires soon."))
+
+	// line breaks in headers must not smuggle in headers of their own
+	data, err = format("no-reply@example.com", Message{To: "alice@example.com", Subject: "Hi\r\nBcc: eve@example.com"}, time.Now())
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "\r\nBcc:")
+
+	_, err = format("no-reply@example.com", Message{To: "not an address"}, time.Now())
+	assert.Error(t, err)
+}
+
+func TestFileMailer(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "mail")
+	m, err := NewFile(dir, "no-reply@example.com")
+	require.NoError(t, err)
+
+	require.NoError(t, m.Send(context.Background(), testMessage))
+	require.NoError(t, m.Send(context.Background(), testMessage))
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+	require.NoError(t, err)
+	require.Len(t, files, 2)
+	data, err := os.ReadFile(files[0])
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "To: alice@example.com")
+}
+
+func TestMemoryMailer(t *testing.T) {
+	m := NewMemory()
+	require.NoError(t, m.Send(context.Background(), testMessage))
+	assert.Equal(t, []Message{testMessage}, m.Messages())
+}
+
+func TestNewMessage(t *testing.T) {
+	data := map[string]interface{}{"Username": "alice", "Token": "ABC", "TTL": time.Hour}
+	for _, name := range []string{"activation.tmpl", "password_reset.tmpl"} {
+		msg, err := NewMessage("alice@example.com", name, data)
+		require.NoError(t, err, name)
+		assert.Equal(t, "alice@example.com", msg.To)
+		assert.NotEmpty(t, msg.Subject)
+		assert.NotContains(t, msg.Subject, "\n")
+		assert.Contains(t, msg.Body, "Hi alice,")
+		assert.Contains(t, msg.Body, "ABC")
+		assert.Contains(t, msg.Body, "1h0m0s")
+	}
+
+	msg, err := NewMessage("alice@example.com", "email_changed.tmpl", map[string]interface{}{"Username": "alice", "NewEmail": "eve@example.com"})
+	require.NoError(t, err)
+	assert.Contains(t, msg.Body, "Hi alice,")
+	assert.Contains(t, msg.Body, "eve@example.com")
+
+	_, err = NewMessage("alice@example.com", "missing.tmpl", data)
+	assert.Error(t, err)
+}
+
+func TestSMTPMailer(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	received := make(chan []string, 1)
+	go serveSMTP(t, listener, received)
+
+	port := listener.Addr().(*net.TCPAddr).Port
+	m := NewSMTP(SMTPOptions{Host: "127.0.0.1", Port: port, From: "no-reply@example.com"})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, m.Send(ctx, testMessage))
+
+	lines := <-received
+	assert.Contains(t, lines, "MAIL FROM:<no-reply@example.com> BODY=8BITMIME")
+	assert.Contains(t, lines, "RCPT TO:<alice@example.com>")
+	assert.Contains(t, lines, "Subject: Reset your password")
+	assert.Contains(t, lines, "It expires soon.")
+}
+
+// serveSMTP speaks just enough SMTP to accept one message, sending back every
+// line the client wrote.
+func serveSMTP(t *testing.T, listener net.Listener, received chan<- []string) {
+	conn, err := listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	c := textproto.NewConn(conn)
+
+	var lines []string
+	c.PrintfLine("220 localhost ESMTP")
+	for {
+		line, err := c.ReadLine()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		lines = append(lines, line)
+		switch {
+		case strings.HasPrefix(line, "EHLO"):
+			c.PrintfLine("250-localhost")
+			c.PrintfLine("250 8BITMIME")
+		case strings.HasPrefix(line, "DATA"):
+			c.PrintfLine("354 go ahead")
+			data, err := c.ReadDotLines()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			lines = append(lines, data...)
+			c.PrintfLine("250 queued")
+		case strings.HasPrefix(line, "QUIT"):
+			c.PrintfLine("221 bye")
+			received <- lines
+			return
+		default:
+			c.PrintfLine("250 ok")
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package mailer
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"time"
+)
+
+type SMTPOptions struct {
+	Host string
+	Port int
+	// Username and Password are sent with PLAIN authentication when
+	// Username is set, which net/smtp only allows over TLS or to localhost.
+	Username string
+	Password string
+	From     string
+}
+
+// SMTPMailer hands messages to an SMTP server, upgrading the connection with
+// STARTTLS when the server offers it.
+type SMTPMailer struct {
+	opts SMTPOptions
+	now  func() time.Time
+}
+
+func NewSMTP(opts SMTPOptions) *SMTPMailer {
+	return &SMTPMailer{opts: opts, now: time.Now}
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, msg Message) error {
+	data, err := format(m.opts.From, msg, m.now())
+	if err != nil {
+		return err
+	}
+	from, err := mail.ParseAddress(m.opts.From)
+	if err != nil {
+		return fmt.Errorf("mailer: invalid sender: %w", err)
+	}
+	to, err := mail.ParseAddress(msg.To)
+	if err != nil {
+		return fmt.Errorf("mailer: invalid recipient: %w", err)
+	}
+
+	addr := net.JoinHostPort(m.opts.Host, strconv.Itoa(m.opts.Port))
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return fmt.Errorf("mailer: %w", err)
+	}
+	// net/smtp knows nothing of contexts, so the deadline goes on the
+	// connection instead
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	client, err := smtp.NewClient(conn, m.opts.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("mailer: %w", err)
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		err = client.StartTLS(&tls.Config{ServerName: m.opts.Host})
+		if err != nil {
+			return fmt.Errorf("mailer: %w", err)
+		}
+	}
+	if m.opts.Username != "" {
+		err = client.Auth(smtp.PlainAuth("", m.opts.Username, m.opts.Password, m.opts.Host))
+		if err != nil {
+			return fmt.Errorf("mailer: %w", err)
+		}
+	}
+
+	err = client.Mail(from.Address)
+	if err != nil {
+		return fmt.Errorf("mailer: %w", err)
+	}
+	err = client.Rcpt(to.Address)
+	if err != nil {
+		return fmt.Errorf("mailer: %w", err)
+	}
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("mailer: %w", err)
+	}
+	_, err = w.Write(data)
+	if err != nil {
+		return fmt.Errorf("mailer: %w", err)
+	}
+	err = w.Close()
+	if err != nil {
+		return fmt.Errorf("mailer: %w", err)
+	}
+	return client.Quit()
+}
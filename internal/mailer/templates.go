@@ -0,0 +1,34 @@
+package mailer
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+//go:embed templates/*.tmpl
+var templateFS embed.FS
+
+// NewMessage renders the named template from the templates directory, e.g.
+// "activation.tmpl", into a message to the given address. Each template
+// defines a "subject" and a "body".
+func NewMessage(to, name string, data interface{}) (Message, error) {
+	// every file defines the same names, so each is parsed on its own
+	tmpl, err := template.New("").ParseFS(templateFS, "templates/"+name)
+	if err != nil {
+		return Message{}, fmt.Errorf("mailer: %w", err)
+	}
+
+	var subject, body bytes.Buffer
+	err = tmpl.ExecuteTemplate(&subject, "subject", data)
+	if err != nil {
+		return Message{}, fmt.Errorf("mailer: %w", err)
+	}
+	err = tmpl.ExecuteTemplate(&body, "body", data)
+	if err != nil {
+		return Message{}, fmt.Errorf("mailer: %w", err)
+	}
+	return Message{To: to, Subject: strings.TrimSpace(subject.String()), Body: body.String()}, nil
+}
@@ -0,0 +1,138 @@
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "fem"
+
+const (
+	LoginUnknownUser   = "unknown_user"
+	LoginWrongPassword = "wrong_password"
+	LoginLockedOut     = "locked_out"
+	LoginWrongCode     = "wrong_2fa_code"
+)
+
+// Metrics owns the application's Prometheus registry and the collectors
+// updated by the HTTP middleware, the instrumented stores and the handlers.
+// A nil *Metrics records nothing.
+type Metrics struct {
+	registry        *prometheus.Registry
+	httpRequests    *prometheus.CounterVec
+	httpDuration    *prometheus.HistogramVec
+	queryDuration   *prometheus.HistogramVec
+	workoutsCreated prometheus.Counter
+	tokensIssued    *prometheus.CounterVec
+	failedLogins    *prometheus.CounterVec
+}
+
+// New registers the metrics, including the pool stats of db and the Go
+// runtime and process collectors.
+func New(db *sql.DB) *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		httpRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "HTTP requests by method, chi route pattern and status.",
+		}, []string{"method", "route", "status"}),
+		httpDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "HTTP request latency by method, chi route pattern and status.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route", "status"}),
+		queryDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "store_query_duration_seconds",
+			Help:      "Duration of store method calls by store, method and outcome.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"store", "method", "outcome"}),
+		workoutsCreated: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "workouts_created_total",
+			Help:      "Workouts created, including imported ones.",
+		}),
+		tokensIssued: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "tokens_issued_total",
+			Help:      "Tokens issued by scope.",
+		}, []string{"scope"}),
+		failedLogins: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "failed_logins_total",
+			Help:      "Rejected login attempts by reason.",
+		}, []string{"reason"}),
+	}
+
+	m.registry.MustRegister(
+		m.httpRequests,
+		m.httpDuration,
+		m.queryDuration,
+		m.workoutsCreated,
+		m.tokensIssued,
+		m.failedLogins,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	if db != nil {
+		m.registry.MustRegister(collectors.NewDBStatsCollector(db, "postgres"))
+	}
+	return m
+}
+
+// Handler serves the metrics in the Prometheus text format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{Registry: m.registry})
+}
+
+func (m *Metrics) ObserveRequest(method, route string, status int, duration time.Duration) {
+	if m == nil {
+		return
+	}
+	labels := prometheus.Labels{"method": method, "route": route, "status": strconv.Itoa(status)}
+	m.httpRequests.With(labels).Inc()
+	m.httpDuration.With(labels).Observe(duration.Seconds())
+}
+
+// ObserveQuery records how long a store method took since start.
+func (m *Metrics) ObserveQuery(store, method string, start time.Time, err error) {
+	if m == nil {
+		return
+	}
+	outcome := "success"
+	if err != nil {
+		outcome = "error"
+	}
+	m.queryDuration.WithLabelValues(store, method, outcome).Observe(time.Since(start).Seconds())
+}
+
+func (m *Metrics) WorkoutsCreated(n int) {
+	if m == nil {
+		return
+	}
+	m.workoutsCreated.Add(float64(n))
+}
+
+func (m *Metrics) TokenIssued(scope string) {
+	if m == nil {
+		return
+	}
+	m.tokensIssued.WithLabelValues(scope).Inc()
+}
+
+// LoginFailed counts a rejected login; reason is LoginUnknownUser,
+// LoginWrongPassword or LoginLockedOut.
+func (m *Metrics) LoginFailed(reason string) {
+	if m == nil {
+		return
+	}
+	m.failedLogins.WithLabelValues(reason).Inc()
+}
@@ -0,0 +1,86 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dapoadedire/fem_project/internal/store"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeWorkoutStore struct {
+	store.WorkoutStore
+	err error
+}
+
+func (s *fakeWorkoutStore) CreateWorkout(ctx context.Context, workout *store.Workout) (*store.Workout, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	workout.ID = 1
+	return workout, nil
+}
+
+func (s *fakeWorkoutStore) ImportWorkouts(ctx context.Context, workouts []*store.Workout, chunkSize int) ([]error, error) {
+	failures := make([]error, len(workouts))
+	for i, workout := range workouts {
+		if workout.Title == "" {
+			failures[i] = errors.New("title is required")
+			continue
+		}
+		workout.ID = i + 1
+	}
+	return failures, nil
+}
+
+func TestInstrumentWorkoutStore(t *testing.T) {
+	m := New(nil)
+	fake := &fakeWorkoutStore{}
+	workouts := InstrumentWorkoutStore(fake, m)
+
+	_, err := workouts.CreateWorkout(context.Background(), &store.Workout{Title: "Legs"})
+	require.NoError(t, err)
+	fake.err = errors.New("connection refused")
+	_, err = workouts.CreateWorkout(context.Background(), &store.Workout{Title: "Legs"})
+	require.Error(t, err)
+
+	_, err = workouts.ImportWorkouts(context.Background(), []*store.Workout{{Title: "A"}, {}, {Title: "C"}}, 0)
+	require.NoError(t, err)
+
+	assert.Equal(t, 3.0, testutil.ToFloat64(m.workoutsCreated))
+	// success and error series for CreateWorkout, plus ImportWorkouts
+	assert.Equal(t, 3, testutil.CollectAndCount(m.queryDuration))
+}
+
+func TestHandler(t *testing.T) {
+	m := New(nil)
+	m.ObserveRequest(http.MethodGet, "/workouts/{id}", http.StatusOK, 20*time.Millisecond)
+	m.TokenIssued("authentication")
+	m.LoginFailed(LoginWrongPassword)
+
+	res := httptest.NewRecorder()
+	m.Handler().ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, res.Code)
+
+	body := res.Body.String()
+	assert.Contains(t, body, `fem_http_requests_total{method="GET",route="/workouts/{id}",status="200"} 1`)
+	assert.Contains(t, body, `fem_tokens_issued_total{scope="authentication"} 1`)
+	assert.Contains(t, body, `fem_failed_logins_total{reason="wrong_password"} 1`)
+	assert.True(t, strings.Contains(body, "go_goroutines"))
+}
+
+func TestNilMetrics(t *testing.T) {
+	var m *Metrics
+	assert.NotPanics(t, func() {
+		m.ObserveRequest(http.MethodGet, "/", http.StatusOK, time.Millisecond)
+		m.WorkoutsCreated(1)
+		m.LoginFailed(LoginUnknownUser)
+	})
+}
@@ -0,0 +1,188 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/dapoadedire/fem_project/internal/store"
+	"github.com/dapoadedire/fem_project/internal/tokens"
+)
+
+// The instrumented stores time every call to the store they wrap and count
+// the domain events that go through them.
+
+type workoutStore struct {
+	next    store.WorkoutStore
+	metrics *Metrics
+}
+
+func InstrumentWorkoutStore(next store.WorkoutStore, m *Metrics) store.WorkoutStore {
+	return &workoutStore{next: next, metrics: m}
+}
+
+func (s *workoutStore) CreateWorkout(ctx context.Context, workout *store.Workout) (created *store.Workout, err error) {
+	defer s.observe("CreateWorkout", time.Now(), &err)
+	created, err = s.next.CreateWorkout(ctx, workout)
+	if err == nil {
+		s.metrics.WorkoutsCreated(1)
+	}
+	return created, err
+}
+
+func (s *workoutStore) GetWorkoutByID(ctx context.Context, id int64) (workout *store.Workout, err error) {
+	defer s.observe("GetWorkoutByID", time.Now(), &err)
+	return s.next.GetWorkoutByID(ctx, id)
+}
+
+func (s *workoutStore) UpdateWorkout(ctx context.Context, workout *store.Workout) (err error) {
+	defer s.observe("UpdateWorkout", time.Now(), &err)
+	return s.next.UpdateWorkout(ctx, workout)
+}
+
+func (s *workoutStore) DeleteWorkout(ctx context.Context, id int64) (err error) {
+	defer s.observe("DeleteWorkout", time.Now(), &err)
+	return s.next.DeleteWorkout(ctx, id)
+}
+
+func (s *workoutStore) GetWorkoutOwner(ctx context.Context, id int64) (owner int, err error) {
+	defer s.observe("GetWorkoutOwner", time.Now(), &err)
+	return s.next.GetWorkoutOwner(ctx, id)
+}
+
+func (s *workoutStore) ListWorkouts(ctx context.Context, filter store.WorkoutFilter) (workouts []store.Workout, cursor string, err error) {
+	defer s.observe("ListWorkouts", time.Now(), &err)
+	return s.next.ListWorkouts(ctx, filter)
+}
+
+func (s *workoutStore) StreamWorkouts(ctx context.Context, filter store.WorkoutFilter, fn func(*store.Workout) error) (err error) {
+	defer s.observe("StreamWorkouts", time.Now(), &err)
+	return s.next.StreamWorkouts(ctx, filter, fn)
+}
+
+func (s *workoutStore) ImportWorkouts(ctx context.Context, workouts []*store.Workout, chunkSize int) (failures []error, err error) {
+	defer s.observe("ImportWorkouts", time.Now(), &err)
+	failures, err = s.next.ImportWorkouts(ctx, workouts, chunkSize)
+	if err == nil {
+		created := 0
+		for _, workout := range workouts {
+			if workout.ID != 0 {
+				created++
+			}
+		}
+		s.metrics.WorkoutsCreated(created)
+	}
+	return failures, err
+}
+
+func (s *workoutStore) observe(method string, start time.Time, err *error) {
+	s.metrics.ObserveQuery("workout", method, start, *err)
+}
+
+type userStore struct {
+	next    store.UserStore
+	metrics *Metrics
+}
+
+func InstrumentUserStore(next store.UserStore, m *Metrics) store.UserStore {
+	return &userStore{next: next, metrics: m}
+}
+
+func (s *userStore) CreateUser(ctx context.Context, user *store.User) (err error) {
+	defer s.observe("CreateUser", time.Now(), &err)
+	return s.next.CreateUser(ctx, user)
+}
+
+func (s *userStore) GetUserByUsername(ctx context.Context, username string) (user *store.User, err error) {
+	defer s.observe("GetUserByUsername", time.Now(), &err)
+	return s.next.GetUserByUsername(ctx, username)
+}
+
+func (s *userStore) GetUserByEmail(ctx context.Context, email string) (user *store.User, err error) {
+	defer s.observe("GetUserByEmail", time.Now(), &err)
+	return s.next.GetUserByEmail(ctx, email)
+}
+
+func (s *userStore) UpdateUser(ctx context.Context, user *store.User) (err error) {
+	defer s.observe("UpdateUser", time.Now(), &err)
+	return s.next.UpdateUser(ctx, user)
+}
+
+func (s *userStore) GetUserToken(ctx context.Context, scope, tokenPlainText string) (user *store.User, err error) {
+	defer s.observe("GetUserToken", time.Now(), &err)
+	return s.next.GetUserToken(ctx, scope, tokenPlainText)
+}
+
+func (s *userStore) DeleteUser(ctx context.Context, id int) (err error) {
+	defer s.observe("DeleteUser", time.Now(), &err)
+	return s.next.DeleteUser(ctx, id)
+}
+
+func (s *userStore) observe(method string, start time.Time, err *error) {
+	s.metrics.ObserveQuery("user", method, start, *err)
+}
+
+type tokenStore struct {
+	next    store.TokenStore
+	metrics *Metrics
+}
+
+func InstrumentTokenStore(next store.TokenStore, m *Metrics) store.TokenStore {
+	return &tokenStore{next: next, metrics: m}
+}
+
+func (s *tokenStore) Insert(ctx context.Context, token *tokens.Token) (err error) {
+	defer s.observe("Insert", time.Now(), &err)
+	err = s.next.Insert(ctx, token)
+	if err == nil {
+		s.metrics.TokenIssued(token.Scope)
+	}
+	return err
+}
+
+func (s *tokenStore) InsertFamily(ctx context.Context, access, refresh *tokens.Token) (err error) {
+	defer s.observe("InsertFamily", time.Now(), &err)
+	err = s.next.InsertFamily(ctx, access, refresh)
+	if err == nil {
+		s.metrics.TokenIssued(access.Scope)
+		s.metrics.TokenIssued(refresh.Scope)
+	}
+	return err
+}
+
+func (s *tokenStore) RotateRefreshToken(ctx context.Context, hash []byte, access, refresh *tokens.Token) (err error) {
+	defer s.observe("RotateRefreshToken", time.Now(), &err)
+	err = s.next.RotateRefreshToken(ctx, hash, access, refresh)
+	if err == nil {
+		s.metrics.TokenIssued(access.Scope)
+		s.metrics.TokenIssued(refresh.Scope)
+	}
+	return err
+}
+
+func (s *tokenStore) CreateNewToken(ctx context.Context, userID int, ttl time.Duration, scope string) (token *tokens.Token, err error) {
+	defer s.observe("CreateNewToken", time.Now(), &err)
+	token, err = s.next.CreateNewToken(ctx, userID, ttl, scope)
+	if err == nil {
+		s.metrics.TokenIssued(scope)
+	}
+	return token, err
+}
+
+func (s *tokenStore) ListTokensForUser(ctx context.Context, userID int, scope string) (list []*tokens.Token, err error) {
+	defer s.observe("ListTokensForUser", time.Now(), &err)
+	return s.next.ListTokensForUser(ctx, userID, scope)
+}
+
+func (s *tokenStore) DeleteToken(ctx context.Context, hash []byte) (err error) {
+	defer s.observe("DeleteToken", time.Now(), &err)
+	return s.next.DeleteToken(ctx, hash)
+}
+
+func (s *tokenStore) DeleteAllTokensForUser(ctx context.Context, userID int, scope string) (err error) {
+	defer s.observe("DeleteAllTokensForUser", time.Now(), &err)
+	return s.next.DeleteAllTokensForUser(ctx, userID, scope)
+}
+
+func (s *tokenStore) observe(method string, start time.Time, err *error) {
+	s.metrics.ObserveQuery("token", method, start, *err)
+}
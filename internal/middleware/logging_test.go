@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dapoadedire/fem_project/internal/logging"
+	"github.com/dapoadedire/fem_project/internal/store"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestIDAndAccessLog(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := logging.New(&buf, logging.FormatJSON, "info")
+	require.NoError(t, err)
+
+	r := chi.NewRouter()
+	r.Use(RequestID)
+	r.Use(AccessLog(logger))
+	r.Get("/workouts/{id}", func(w http.ResponseWriter, r *http.Request) {
+		r = SetUser(r, &store.User{ID: 42})
+		logger.InfoContext(r.Context(), "handled")
+		w.WriteHeader(http.StatusTeapot)
+		w.Write([]byte("short and stout"))
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/workouts/7", nil)
+	req.Header.Set(RequestIDHeader, "abc-123")
+	res := httptest.NewRecorder()
+	r.ServeHTTP(res, req)
+	assert.Equal(t, "abc-123", res.Header().Get(RequestIDHeader))
+
+	decoder := json.NewDecoder(&buf)
+	var handled, access map[string]interface{}
+	require.NoError(t, decoder.Decode(&handled))
+	require.NoError(t, decoder.Decode(&access))
+
+	assert.Equal(t, "abc-123", handled["request_id"])
+	assert.Equal(t, "request", access["msg"])
+	assert.Equal(t, "abc-123", access["request_id"])
+	assert.Equal(t, "GET", access["method"])
+	assert.Equal(t, "/workouts/{id}", access["route"])
+	assert.Equal(t, float64(http.StatusTeapot), access["status"])
+	assert.Equal(t, float64(len("short and stout")), access["bytes"])
+	assert.Equal(t, float64(42), access["user_id"])
+}
+
+func TestRequestIDGenerated(t *testing.T) {
+	handler := RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, w.Header().Get(RequestIDHeader), logging.RequestID(r.Context()))
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(RequestIDHeader, "has spaces")
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	assert.Len(t, res.Header().Get(RequestIDHeader), 32)
+}
@@ -2,7 +2,9 @@ package middleware
 
 import (
 	"context"
+	"fmt"
 	"net/http"
+	"slices"
 	"strings"
 
 	"github.com/dapoadedire/fem_project/internal/store"
@@ -13,14 +15,22 @@ import (
 
 
 type UserMiddleware struct {
-	UserStore store.UserStore
+	UserStore   store.UserStore
+	APIKeyStore store.APIKeyStore
 }
 
 type contextKey string
 
 const UserContextKey = contextKey("user")
 
+const tokenHashContextKey = contextKey("token_hash")
+
+const apiScopesContextKey = contextKey("api_scopes")
+
 func SetUser(r *http.Request, user *store.User) *http.Request {
+	if !user.IsAnonymous() {
+		recordUser(r, user.ID)
+	}
 	ctx := context.WithValue(r.Context(), UserContextKey, user)
 	return r.WithContext(ctx)
 }
@@ -33,6 +43,13 @@ func GetUser(r *http.Request) *store.User {
 	return user
 }
 
+// GetTokenHash returns the hash of the bearer token the request was
+// authenticated with, or nil for anonymous requests.
+func GetTokenHash(r *http.Request) []byte {
+	hash, _ := r.Context().Value(tokenHashContextKey).([]byte)
+	return hash
+}
+
 func (um *UserMiddleware) Authenticate(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// within this anonymouse function
@@ -54,7 +71,12 @@ func (um *UserMiddleware) Authenticate(next http.Handler) http.Handler {
 		}
 
 		token := headerParts[1]
-		user, err := um.UserStore.GetUserToken(tokens.ScopeAuth, token)
+		if tokens.IsAPIKey(token) {
+			um.authenticateAPIKey(w, r, next, token)
+			return
+		}
+
+		user, err := um.UserStore.GetUserToken(r.Context(), tokens.ScopeAuth, token)
 		if err != nil {
 			utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "invalid token"})
 			return
@@ -66,12 +88,40 @@ func (um *UserMiddleware) Authenticate(next http.Handler) http.Handler {
 		}
 
 		r = SetUser(r, user)
+		r = r.WithContext(context.WithValue(r.Context(), tokenHashContextKey, tokens.Hash(token)))
 		next.ServeHTTP(w, r)
 		return
 	})
 }
 
 
+// authenticateAPIKey is Authenticate for requests made with an API key. The
+// key's scopes go along with the user for RequireScope to check.
+func (um *UserMiddleware) authenticateAPIKey(w http.ResponseWriter, r *http.Request, next http.Handler, key string) {
+	user, scopes, err := um.APIKeyStore.GetUserForAPIKey(r.Context(), key)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "invalid token"})
+		return
+	}
+	if user == nil {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "token expired or invalid"})
+		return
+	}
+
+	r = SetUser(r, user)
+	r = r.WithContext(context.WithValue(r.Context(), apiScopesContextKey, scopes))
+	next.ServeHTTP(w, r)
+}
+
+// getAPIScopes returns the scopes of the API key the request was made with,
+// and false if it was not made with one.
+func getAPIScopes(r *http.Request) ([]string, bool) {
+	scopes, ok := r.Context().Value(apiScopesContextKey).([]string)
+	return scopes, ok
+}
+
+// RequireUser lets through logged in users. API keys are refused, since only
+// routes that name the scope they need with RequireScope accept them.
 func (um *UserMiddleware) RequireUser(next http.HandlerFunc) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		user := GetUser(r)
@@ -79,6 +129,49 @@ func (um *UserMiddleware) RequireUser(next http.HandlerFunc) http.HandlerFunc {
 			utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "you must be logged in to access this route"})
 			return
 		}
+		if _, ok := getAPIScopes(r); ok {
+			utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "API keys cannot access this route"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequireScope is RequireUser for routes that API keys with the given scope
+// may use as well.
+func (um *UserMiddleware) RequireScope(scope string, next http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := GetUser(r)
+		if user.IsAnonymous() {
+			utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "you must be logged in to access this route"})
+			return
+		}
+		if scopes, ok := getAPIScopes(r); ok && !slices.Contains(scopes, scope) {
+			utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": fmt.Sprintf("API key lacks the %s scope", scope)})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequireActivatedUser is RequireUser for routes that also need the user to
+// have confirmed their email address.
+func (um *UserMiddleware) RequireActivatedUser(next http.HandlerFunc) http.HandlerFunc {
+	return um.RequireUser(requireActivated(next))
+}
+
+// RequireActivatedScope is RequireScope for routes that also need the user to
+// have confirmed their email address.
+func (um *UserMiddleware) RequireActivatedScope(scope string, next http.HandlerFunc) http.HandlerFunc {
+	return um.RequireScope(scope, requireActivated(next))
+}
+
+func requireActivated(next http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !GetUser(r).Activated {
+			utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "your account must be activated to access this route"})
+			return
+		}
 		next.ServeHTTP(w, r)
 	})
 }
\ No newline at end of file
@@ -0,0 +1,94 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dapoadedire/fem_project/internal/store"
+	"github.com/dapoadedire/fem_project/internal/tokens"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeUserStore struct {
+	store.UserStore
+}
+
+func (s *fakeUserStore) GetUserToken(ctx context.Context, scope, tokenPlainText string) (*store.User, error) {
+	switch tokenPlainText {
+	case "session":
+		return &store.User{ID: 1, Activated: true}, nil
+	case "inactive":
+		return &store.User{ID: 2}, nil
+	}
+	return nil, nil
+}
+
+type fakeAPIKeyStore struct {
+	store.APIKeyStore
+}
+
+func (s *fakeAPIKeyStore) GetUserForAPIKey(ctx context.Context, plainText string) (*store.User, []string, error) {
+	if plainText != tokens.APIKeyPrefix+"reader" {
+		return nil, nil, nil
+	}
+	return &store.User{ID: 1, Activated: true}, []string{tokens.APIScopeWorkoutsRead}, nil
+}
+
+func TestAPIKeyScopes(t *testing.T) {
+	um := &UserMiddleware{UserStore: &fakeUserStore{}, APIKeyStore: &fakeAPIKeyStore{}}
+	ok := func(w http.ResponseWriter, r *http.Request) {}
+
+	call := func(handler http.HandlerFunc, token string) int {
+		req := httptest.NewRequest(http.MethodGet, "/workouts", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		res := httptest.NewRecorder()
+		um.Authenticate(handler).ServeHTTP(res, req)
+		return res.Code
+	}
+
+	read := um.RequireScope(tokens.APIScopeWorkoutsRead, ok)
+	write := um.RequireScope(tokens.APIScopeWorkoutsWrite, ok)
+	sessionOnly := um.RequireUser(ok)
+
+	key := tokens.APIKeyPrefix + "reader"
+	assert.Equal(t, http.StatusOK, call(read, key))
+	assert.Equal(t, http.StatusForbidden, call(write, key))
+	assert.Equal(t, http.StatusForbidden, call(sessionOnly, key))
+	assert.Equal(t, http.StatusUnauthorized, call(read, tokens.APIKeyPrefix+"unknown"))
+
+	// session tokens are not limited by scopes
+	assert.Equal(t, http.StatusOK, call(write, "session"))
+	assert.Equal(t, http.StatusOK, call(sessionOnly, "session"))
+	assert.Equal(t, http.StatusUnauthorized, call(read, ""))
+}
+
+func TestRequireActivated(t *testing.T) {
+	um := &UserMiddleware{UserStore: &fakeUserStore{}, APIKeyStore: &fakeAPIKeyStore{}}
+	ok := func(w http.ResponseWriter, r *http.Request) {}
+
+	call := func(handler http.HandlerFunc, token string) int {
+		req := httptest.NewRequest(http.MethodPost, "/workouts", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		res := httptest.NewRecorder()
+		um.Authenticate(handler).ServeHTTP(res, req)
+		return res.Code
+	}
+
+	write := um.RequireActivatedUser(ok)
+	read := um.RequireActivatedScope(tokens.APIScopeWorkoutsRead, ok)
+
+	assert.Equal(t, http.StatusOK, call(write, "session"))
+	assert.Equal(t, http.StatusForbidden, call(write, "inactive"))
+	assert.Equal(t, http.StatusUnauthorized, call(write, ""))
+	assert.Equal(t, http.StatusOK, call(read, tokens.APIKeyPrefix+"reader"))
+	assert.Equal(t, http.StatusForbidden, call(read, "inactive"))
+
+	// inactive users can still use routes that do not ask for activation
+	assert.Equal(t, http.StatusOK, call(um.RequireUser(ok), "inactive"))
+}
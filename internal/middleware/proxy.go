@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// TrustProxies makes requests that come through the reverse proxies in
+// trusted look like they came straight from the client, by setting their
+// RemoteAddr to the address the proxies forwarded in X-Forwarded-For. The
+// header is read from the right, since only the addresses appended by
+// trusted proxies can be believed; the first one not trusted is the client.
+// With no trusted proxies, requests are left alone and every client behind
+// a proxy shares its address.
+func TrustProxies(trusted []netip.Prefix) func(http.Handler) http.Handler {
+	isTrusted := func(addr netip.Addr) bool {
+		for _, prefix := range trusted {
+			if prefix.Contains(addr.Unmap()) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return func(next http.Handler) http.Handler {
+		if len(trusted) == 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			peer, err := netip.ParseAddr(RemoteIP(r))
+			if err != nil || !isTrusted(peer) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			var forwarded []string
+			for _, value := range r.Header.Values("X-Forwarded-For") {
+				forwarded = append(forwarded, strings.Split(value, ",")...)
+			}
+			client := peer
+			for i := len(forwarded) - 1; i >= 0; i-- {
+				addr, err := netip.ParseAddr(strings.TrimSpace(forwarded[i]))
+				if err != nil {
+					break
+				}
+				client = addr
+				if !isTrusted(addr) {
+					break
+				}
+			}
+
+			if client != peer {
+				r = r.WithContext(r.Context())
+				r.RemoteAddr = net.JoinHostPort(client.Unmap().String(), "0")
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrustProxies(t *testing.T) {
+	trusted := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}
+	tests := []struct {
+		name      string
+		trusted   []netip.Prefix
+		peer      string
+		forwarded []string
+		want      string
+	}{
+		{"no trusted proxies", nil, "10.0.0.1:4000", []string{"203.0.113.7"}, "ip:10.0.0.1"},
+		{"untrusted peer", trusted, "198.51.100.1:4000", []string{"203.0.113.7"}, "ip:198.51.100.1"},
+		{"trusted proxy", trusted, "10.0.0.1:4000", []string{"203.0.113.7"}, "ip:203.0.113.7"},
+		{"chain of proxies", trusted, "10.0.0.1:4000", []string{"203.0.113.7, 10.0.0.2"}, "ip:203.0.113.7"},
+		{"spoofed entries are ignored", trusted, "10.0.0.1:4000", []string{"192.0.2.1, 203.0.113.7"}, "ip:203.0.113.7"},
+		{"repeated headers", trusted, "10.0.0.1:4000", []string{"192.0.2.1", "203.0.113.7"}, "ip:203.0.113.7"},
+		{"garbage stops the walk", trusted, "10.0.0.1:4000", []string{"203.0.113.7, unknown, 10.0.0.2"}, "ip:10.0.0.2"},
+		{"no header", trusted, "10.0.0.1:4000", nil, "ip:10.0.0.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			handler := TrustProxies(tt.trusted)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = ClientIP(r)
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.peer
+			for _, value := range tt.forwarded {
+				req.Header.Add("X-Forwarded-For", value)
+			}
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dapoadedire/fem_project/internal/ratelimit"
+	"github.com/dapoadedire/fem_project/internal/utils"
+)
+
+// maxLoginBody is how large a login body may be. LoginUsername caps the body
+// at it, so that one too large to find the username in also fails to decode
+// in the handler instead of slipping past the limit.
+const maxLoginBody = 4096
+
+// RateLimit answers 429 Too Many Requests with a Retry-After header once the
+// bucket that key maps the request to is empty. Requests key maps to "" are
+// not limited. If the store fails the request is let through, so an outage
+// of the limiter does not lock everyone out.
+func RateLimit(store ratelimit.Store, limit ratelimit.Limit, key func(*http.Request) string, logger *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			k := key(r)
+			if k == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			result, err := store.Take(r.Context(), k, limit)
+			if err != nil {
+				logger.ErrorContext(r.Context(), "rateLimit", "error", err)
+				next.ServeHTTP(w, r)
+				return
+			}
+			if !result.Allowed {
+				SetRetryAfter(w, result.RetryAfter)
+				utils.WriteJSON(w, http.StatusTooManyRequests, utils.Envelope{"error": "too many requests, try again later"})
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// SetRetryAfter sets the Retry-After header to d rounded up to whole seconds.
+func SetRetryAfter(w http.ResponseWriter, d time.Duration) {
+	seconds := int(math.Ceil(d.Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(max(seconds, 1)))
+}
+
+// ClientIP keys requests by the address of the connection they came from,
+// or of the client behind a proxy trusted with TrustProxies.
+func ClientIP(r *http.Request) string {
+	return "ip:" + RemoteIP(r)
+}
+
+// RemoteIP returns the IP address of the connection the request came from.
+func RemoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// LoginUsername keys requests by the case-insensitive username of a JSON
+// login body, leaving the body intact for the handler. Bodies larger than
+// maxLoginBody are cut off with an error for the handler to reject.
+func LoginUsername(r *http.Request) string {
+	body := http.MaxBytesReader(nil, r.Body, maxLoginBody)
+	// on an error the handler reads the same bytes and then fails the same way
+	peek, _ := io.ReadAll(body)
+	r.Body = readCloser{io.MultiReader(bytes.NewReader(peek), body), body}
+
+	// decoded the way the handler does, so that both see the same username,
+	// even with trailing data or padding after the object
+	var login struct {
+		Username string `json:"username"`
+	}
+	if json.NewDecoder(bytes.NewReader(peek)).Decode(&login) != nil || login.Username == "" {
+		return ""
+	}
+	return "username:" + strings.ToLower(login.Username)
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
@@ -0,0 +1,86 @@
+package middleware
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dapoadedire/fem_project/internal/ratelimit"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimitByUsername(t *testing.T) {
+	limit := ratelimit.Limit{Burst: 2, Interval: time.Minute}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	handler := RateLimit(ratelimit.NewMemoryStore(), limit, LoginUsername, logger)(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			w.Write(body)
+		}))
+
+	login := func(body string) *httptest.ResponseRecorder {
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, httptest.NewRequest(http.MethodPost, "/tokens/authenticate", strings.NewReader(body)))
+		return res
+	}
+
+	body := `{"username": "Alice", "password": "wrong"}`
+	res := login(body)
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, body, res.Body.String())
+	login(`{"username": "alice", "password": "wrong"}`)
+
+	res = login(body)
+	assert.Equal(t, http.StatusTooManyRequests, res.Code)
+	assert.Equal(t, "60", res.Header().Get("Retry-After"))
+
+	assert.Equal(t, http.StatusOK, login(`{"username": "bob"}`).Code)
+	// bodies without a username are left to the handler to reject
+	assert.Equal(t, http.StatusOK, login(`not json`).Code)
+	assert.Equal(t, http.StatusOK, login(`not json`).Code)
+	assert.Equal(t, http.StatusOK, login(`not json`).Code)
+}
+
+func TestLoginUsernamePaddedBody(t *testing.T) {
+	padding := strings.Repeat(" ", maxLoginBody)
+	tests := []struct {
+		name string
+		body string
+		key  string
+	}{
+		{"padded after the object", `{"username": "Alice", "password": "wrong"}` + padding, "username:alice"},
+		{"trailing data", `{"username": "Alice", "password": "wrong"} {"username": "bob"}`, "username:alice"},
+		{"padded inside the object", `{"password": "wrong",` + padding + `"username": "Alice"}`, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/tokens/authenticate", strings.NewReader(tt.body))
+			assert.Equal(t, tt.key, LoginUsername(req))
+
+			// the handler decodes what the limiter saw, or nothing at all
+			var login struct {
+				Username string `json:"username"`
+			}
+			err := json.NewDecoder(req.Body).Decode(&login)
+			if tt.key == "" {
+				var tooLarge *http.MaxBytesError
+				assert.ErrorAs(t, err, &tooLarge)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, "Alice", login.Username)
+			}
+		})
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "203.0.113.7:51234"
+	assert.Equal(t, "ip:203.0.113.7", ClientIP(req))
+}
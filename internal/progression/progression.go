@@ -0,0 +1,251 @@
+package progression
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+const (
+	RuleLinear = "linear"
+	RuleDouble = "double"
+	RuleRPE    = "rpe"
+)
+
+// Session is the top set of an exercise logged in one workout.
+type Session struct {
+	WorkoutID       int       `json:"workout_id"`
+	Date            time.Time `json:"date"`
+	Sets            int       `json:"sets"`
+	Reps            int       `json:"reps"`
+	Weight          float64   `json:"weight"`
+	RPE             *float64  `json:"rpe"`
+	DurationSeconds int       `json:"duration_seconds"`
+}
+
+// Config tunes a rule. Not every field applies to every rule: TargetReps is
+// used by linear and rpe, MinReps/MaxReps by double and TargetRPE by rpe.
+// A deload of DeloadPercent is suggested after DeloadAfter failed sessions in
+// a row; DeloadAfter 0 disables deloads.
+type Config struct {
+	Rule          string  `json:"rule"`
+	Increment     float64 `json:"increment"`
+	TargetReps    int     `json:"target_reps"`
+	MinReps       int     `json:"min_reps"`
+	MaxReps       int     `json:"max_reps"`
+	TargetRPE     float64 `json:"target_rpe"`
+	DeloadAfter   int     `json:"deload_after"`
+	DeloadPercent float64 `json:"deload_percent"`
+}
+
+type Suggestion struct {
+	Sets            int     `json:"sets"`
+	Reps            *int    `json:"reps"`
+	Weight          float64 `json:"weight"`
+	DurationSeconds *int    `json:"duration_seconds"`
+	Deload          bool    `json:"deload"`
+	Reason          string  `json:"reason"`
+}
+
+// ProgressionRule suggests the next session of an exercise. history is
+// ordered oldest first and always holds at least one rep-based session.
+type ProgressionRule interface {
+	Name() string
+	Suggest(history []Session, cfg Config) Suggestion
+}
+
+var rules = map[string]ProgressionRule{}
+
+// Register makes a rule available to Lookup and Config.Validate under its name.
+func Register(rule ProgressionRule) {
+	rules[rule.Name()] = rule
+}
+
+func Lookup(name string) (ProgressionRule, bool) {
+	rule, ok := rules[name]
+	return rule, ok
+}
+
+// RuleNames lists the registered rules in alphabetical order.
+func RuleNames() []string {
+	names := make([]string, 0, len(rules))
+	for name := range rules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func init() {
+	Register(LinearRule{})
+	Register(DoubleProgressionRule{})
+	Register(RPERule{})
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Rule:          RuleLinear,
+		Increment:     2.5,
+		TargetReps:    5,
+		MinReps:       8,
+		MaxReps:       12,
+		TargetRPE:     8,
+		DeloadAfter:   3,
+		DeloadPercent: 0.1,
+	}
+}
+
+func (c *Config) Validate() error {
+	if _, ok := Lookup(c.Rule); !ok {
+		return fmt.Errorf("rule must be one of %v", RuleNames())
+	}
+	switch {
+	case c.Increment < 0:
+		return errors.New("increment must not be negative")
+	case c.TargetReps < 1:
+		return errors.New("target_reps must be at least 1")
+	case c.MinReps < 1 || c.MaxReps < c.MinReps:
+		return errors.New("min_reps must be at least 1 and no greater than max_reps")
+	case c.TargetRPE < 1 || c.TargetRPE > 10:
+		return errors.New("target_rpe must be between 1 and 10")
+	case c.DeloadAfter < 0:
+		return errors.New("deload_after must not be negative")
+	case c.DeloadPercent < 0 || c.DeloadPercent >= 1:
+		return errors.New("deload_percent must be between 0 and 1")
+	}
+	return nil
+}
+
+// Suggest applies rule to history (oldest first). Sessions timed rather than
+// counted in reps are repeated as-is since the rules only progress load.
+func Suggest(rule ProgressionRule, history []Session, cfg Config) Suggestion {
+	if len(history) == 0 {
+		return Suggestion{Reason: "no previous sessions of this exercise"}
+	}
+
+	last := history[len(history)-1]
+	if last.Reps == 0 && last.DurationSeconds > 0 {
+		duration := last.DurationSeconds
+		return Suggestion{
+			Sets:            last.Sets,
+			Weight:          last.Weight,
+			DurationSeconds: &duration,
+			Reason:          "timed exercise: repeat the last session",
+		}
+	}
+
+	return rule.Suggest(history, cfg)
+}
+
+// trailingFailures counts how many sessions in a row, ending with the latest,
+// failed according to failed.
+func trailingFailures(history []Session, failed func(Session) bool) int {
+	count := 0
+	for i := len(history) - 1; i >= 0 && failed(history[i]); i-- {
+		count++
+	}
+	return count
+}
+
+// deload returns a deload suggestion if the last cfg.DeloadAfter sessions failed.
+func deload(history []Session, cfg Config, reps int, failed func(Session) bool) (Suggestion, bool) {
+	if cfg.DeloadAfter == 0 {
+		return Suggestion{}, false
+	}
+	failures := trailingFailures(history, failed)
+	if failures < cfg.DeloadAfter {
+		return Suggestion{}, false
+	}
+	last := history[len(history)-1]
+	return Suggestion{
+		Sets:   last.Sets,
+		Reps:   &reps,
+		Weight: roundWeight(last.Weight * (1 - cfg.DeloadPercent)),
+		Deload: true,
+		Reason: fmt.Sprintf("%d failed sessions in a row: deload by %.0f%%", failures, cfg.DeloadPercent*100),
+	}, true
+}
+
+func roundWeight(weight float64) float64 {
+	return math.Round(weight*100) / 100
+}
+
+// LinearRule adds Increment whenever every set of the last session reached
+// TargetReps, and repeats the weight otherwise.
+type LinearRule struct{}
+
+func (LinearRule) Name() string { return RuleLinear }
+
+func (LinearRule) Suggest(history []Session, cfg Config) Suggestion {
+	reps := cfg.TargetReps
+	failed := func(s Session) bool { return s.Reps < cfg.TargetReps }
+	if suggestion, ok := deload(history, cfg, reps, failed); ok {
+		return suggestion
+	}
+
+	last := history[len(history)-1]
+	if failed(last) {
+		return Suggestion{Sets: last.Sets, Reps: &reps, Weight: last.Weight, Reason: "target reps missed: repeat the weight"}
+	}
+	return Suggestion{Sets: last.Sets, Reps: &reps, Weight: roundWeight(last.Weight + cfg.Increment), Reason: "target reps hit: add weight"}
+}
+
+// DoubleProgressionRule adds a rep each session until MaxReps is reached, then
+// adds Increment and drops back to MinReps.
+type DoubleProgressionRule struct{}
+
+func (DoubleProgressionRule) Name() string { return RuleDouble }
+
+func (DoubleProgressionRule) Suggest(history []Session, cfg Config) Suggestion {
+	failed := func(s Session) bool { return s.Reps < cfg.MinReps }
+	if suggestion, ok := deload(history, cfg, cfg.MinReps, failed); ok {
+		return suggestion
+	}
+
+	last := history[len(history)-1]
+	switch {
+	case last.Reps >= cfg.MaxReps:
+		reps := cfg.MinReps
+		return Suggestion{Sets: last.Sets, Reps: &reps, Weight: roundWeight(last.Weight + cfg.Increment), Reason: "top of the rep range reached: add weight"}
+	case failed(last):
+		reps := cfg.MinReps
+		return Suggestion{Sets: last.Sets, Reps: &reps, Weight: last.Weight, Reason: "below the rep range: repeat the weight"}
+	default:
+		reps := last.Reps + 1
+		return Suggestion{Sets: last.Sets, Reps: &reps, Weight: last.Weight, Reason: "within the rep range: add a rep"}
+	}
+}
+
+// RPERule moves the weight by Increment for every full point the last
+// session's RPE was away from TargetRPE. A session rated more than one point
+// above the target counts as failed.
+type RPERule struct{}
+
+func (RPERule) Name() string { return RuleRPE }
+
+func (RPERule) Suggest(history []Session, cfg Config) Suggestion {
+	reps := cfg.TargetReps
+	failed := func(s Session) bool { return s.RPE != nil && *s.RPE > cfg.TargetRPE+1 }
+	if suggestion, ok := deload(history, cfg, reps, failed); ok {
+		return suggestion
+	}
+
+	last := history[len(history)-1]
+	if last.RPE == nil {
+		return Suggestion{Sets: last.Sets, Reps: &reps, Weight: last.Weight, Reason: "no RPE logged: repeat the weight"}
+	}
+
+	steps := math.Trunc(cfg.TargetRPE - *last.RPE)
+	suggestion := Suggestion{Sets: last.Sets, Reps: &reps, Weight: roundWeight(math.Max(0, last.Weight+steps*cfg.Increment))}
+	switch {
+	case steps > 0:
+		suggestion.Reason = "last session felt easier than the target RPE: add weight"
+	case steps < 0:
+		suggestion.Reason = "last session felt harder than the target RPE: reduce weight"
+	default:
+		suggestion.Reason = "last session was on target RPE: repeat the weight"
+	}
+	return suggestion
+}
@@ -0,0 +1,81 @@
+package progression
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func rpe(v float64) *float64 {
+	return &v
+}
+
+func TestLinearRule(t *testing.T) {
+	cfg := DefaultConfig()
+	rule, ok := Lookup(RuleLinear)
+	require.True(t, ok)
+
+	suggestion := Suggest(rule, []Session{{Sets: 3, Reps: 5, Weight: 100}}, cfg)
+	assert.Equal(t, 102.5, suggestion.Weight)
+	assert.Equal(t, 5, *suggestion.Reps)
+	assert.False(t, suggestion.Deload)
+
+	suggestion = Suggest(rule, []Session{{Sets: 3, Reps: 5, Weight: 100}, {Sets: 3, Reps: 4, Weight: 102.5}}, cfg)
+	assert.Equal(t, 102.5, suggestion.Weight)
+
+	failures := []Session{
+		{Sets: 3, Reps: 3, Weight: 100},
+		{Sets: 3, Reps: 4, Weight: 100},
+		{Sets: 3, Reps: 3, Weight: 100},
+	}
+	suggestion = Suggest(rule, failures, cfg)
+	assert.True(t, suggestion.Deload)
+	assert.Equal(t, 90.0, suggestion.Weight)
+}
+
+func TestDoubleProgressionRule(t *testing.T) {
+	cfg := DefaultConfig()
+	rule, _ := Lookup(RuleDouble)
+
+	suggestion := Suggest(rule, []Session{{Sets: 3, Reps: 9, Weight: 20}}, cfg)
+	assert.Equal(t, 10, *suggestion.Reps)
+	assert.Equal(t, 20.0, suggestion.Weight)
+
+	suggestion = Suggest(rule, []Session{{Sets: 3, Reps: 12, Weight: 20}}, cfg)
+	assert.Equal(t, 8, *suggestion.Reps)
+	assert.Equal(t, 22.5, suggestion.Weight)
+}
+
+func TestRPERule(t *testing.T) {
+	cfg := DefaultConfig()
+	rule, _ := Lookup(RuleRPE)
+
+	assert.Equal(t, 105.0, Suggest(rule, []Session{{Sets: 3, Reps: 5, Weight: 100, RPE: rpe(6)}}, cfg).Weight)
+	assert.Equal(t, 100.0, Suggest(rule, []Session{{Sets: 3, Reps: 5, Weight: 100, RPE: rpe(8.5)}}, cfg).Weight)
+	assert.Equal(t, 97.5, Suggest(rule, []Session{{Sets: 3, Reps: 5, Weight: 100, RPE: rpe(9.5)}}, cfg).Weight)
+	assert.Equal(t, 100.0, Suggest(rule, []Session{{Sets: 3, Reps: 5, Weight: 100}}, cfg).Weight)
+}
+
+func TestSuggestWithoutRepHistory(t *testing.T) {
+	rule, _ := Lookup(RuleLinear)
+
+	suggestion := Suggest(rule, nil, DefaultConfig())
+	assert.Nil(t, suggestion.Reps)
+
+	suggestion = Suggest(rule, []Session{{Sets: 2, DurationSeconds: 60}}, DefaultConfig())
+	require.NotNil(t, suggestion.DurationSeconds)
+	assert.Equal(t, 60, *suggestion.DurationSeconds)
+}
+
+func TestConfigValidate(t *testing.T) {
+	cfg := DefaultConfig()
+	assert.NoError(t, cfg.Validate())
+
+	cfg.Rule = "wave"
+	assert.Error(t, cfg.Validate())
+
+	cfg = DefaultConfig()
+	cfg.MaxReps = cfg.MinReps - 1
+	assert.Error(t, cfg.Validate())
+}
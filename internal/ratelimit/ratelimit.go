@@ -0,0 +1,99 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Limit lets Burst events through at once and refills the bucket at one
+// event per Interval.
+type Limit struct {
+	Burst    int
+	Interval time.Duration
+}
+
+type Result struct {
+	Allowed bool
+	// RetryAfter is how long until the next event would be allowed when
+	// this one was not.
+	RetryAfter time.Duration
+}
+
+// Store keeps one token bucket per key. MemoryStore suits a single instance;
+// replicas that must share limits need a Store backed by shared storage.
+type Store interface {
+	// Take removes a token from the bucket of key, which starts out full.
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	// full is when the bucket will have refilled completely.
+	full time.Time
+}
+
+// MemoryStore keeps the buckets in memory. Buckets that have refilled are
+// dropped by Sweep, since a full bucket is the same as no bucket.
+type MemoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	now     func() time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: map[string]*bucket{}, now: time.Now}
+}
+
+func (s *MemoryStore) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Burst), last: now}
+		s.buckets[key] = b
+	}
+
+	refilled := float64(now.Sub(b.last)) / float64(limit.Interval)
+	b.tokens = min(float64(limit.Burst), b.tokens+refilled)
+	b.last = now
+
+	result := Result{Allowed: b.tokens >= 1}
+	if result.Allowed {
+		b.tokens--
+	} else {
+		result.RetryAfter = time.Duration((1 - b.tokens) * float64(limit.Interval))
+	}
+	b.full = now.Add(time.Duration((float64(limit.Burst) - b.tokens) * float64(limit.Interval)))
+	return result, nil
+}
+
+// Sweep forgets the buckets that have refilled completely.
+func (s *MemoryStore) Sweep() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	for key, b := range s.buckets {
+		if !now.Before(b.full) {
+			delete(s.buckets, key)
+		}
+	}
+}
+
+// Run calls Sweep every interval until ctx is cancelled.
+func (s *MemoryStore) Run(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			s.Sweep()
+		}
+	}
+}
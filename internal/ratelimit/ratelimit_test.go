@@ -0,0 +1,61 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryStore(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	s := NewMemoryStore()
+	s.now = func() time.Time { return now }
+	limit := Limit{Burst: 2, Interval: 10 * time.Second}
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		result, err := s.Take(ctx, "ip:10.0.0.1", limit)
+		require.NoError(t, err)
+		assert.True(t, result.Allowed)
+	}
+	result, err := s.Take(ctx, "ip:10.0.0.1", limit)
+	require.NoError(t, err)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, 10*time.Second, result.RetryAfter)
+
+	// other keys have their own bucket
+	result, _ = s.Take(ctx, "ip:10.0.0.2", limit)
+	assert.True(t, result.Allowed)
+
+	now = now.Add(4 * time.Second)
+	result, _ = s.Take(ctx, "ip:10.0.0.1", limit)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, 6*time.Second, result.RetryAfter)
+
+	now = now.Add(6 * time.Second)
+	result, _ = s.Take(ctx, "ip:10.0.0.1", limit)
+	assert.True(t, result.Allowed)
+}
+
+func TestMemoryStoreSweep(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	s := NewMemoryStore()
+	s.now = func() time.Time { return now }
+	limit := Limit{Burst: 3, Interval: time.Minute}
+
+	s.Take(context.Background(), "a", limit)
+	s.Take(context.Background(), "b", limit)
+	s.Take(context.Background(), "b", limit)
+
+	now = now.Add(time.Minute)
+	s.Sweep()
+	assert.NotContains(t, s.buckets, "a")
+	assert.Contains(t, s.buckets, "b")
+
+	now = now.Add(time.Minute)
+	s.Sweep()
+	assert.Empty(t, s.buckets)
+}
@@ -2,25 +2,106 @@ package routes
 
 import (
 	"github.com/dapoadedire/fem_project/internal/app"
+	"github.com/dapoadedire/fem_project/internal/middleware"
+	"github.com/dapoadedire/fem_project/internal/ratelimit"
+	"github.com/dapoadedire/fem_project/internal/tokens"
 	"github.com/go-chi/chi/v5"
 )
 
 func SetupRoutes(app *app.Application) *chi.Mux {
 	r := chi.NewRouter()
+	// before anything that looks at the client's address
+	r.Use(middleware.TrustProxies(app.TrustedProxies))
+	r.Use(middleware.RequestID)
+	r.Use(middleware.Tracing)
+	r.Use(middleware.AccessLog(app.Logger))
+	r.Use(middleware.Metrics(app.Metrics))
 
 	r.Group(func(r chi.Router) {
 		r.Use(app.Middleware.Authenticate)
-		r.Get("/workouts/{id}", app.Middleware.RequireUser(app.WorkoutHandler.HandleGetWorkoutByID))
-		r.Post("/workouts", app.Middleware.RequireUser(app.WorkoutHandler.HandleCreateWorkout))
-		r.Put("/workouts/{id}", app.Middleware.RequireUser(app.WorkoutHandler.HandleUpdateWorkoutByID))
-		r.Delete("/workouts/{id}", app.Middleware.RequireUser(app.WorkoutHandler.HandleDeleteWorkout))
+		r.Get("/workouts", app.Middleware.RequireScope(tokens.APIScopeWorkoutsRead, app.WorkoutHandler.HandleListWorkouts))
+		r.Get("/workouts/{id}", app.Middleware.RequireScope(tokens.APIScopeWorkoutsRead, app.WorkoutHandler.HandleGetWorkoutByID))
+		r.Post("/workouts", app.Middleware.RequireActivatedScope(tokens.APIScopeWorkoutsWrite, app.WorkoutHandler.HandleCreateWorkout))
+		r.Put("/workouts/{id}", app.Middleware.RequireActivatedScope(tokens.APIScopeWorkoutsWrite, app.WorkoutHandler.HandleUpdateWorkoutByID))
+		r.Delete("/workouts/{id}", app.Middleware.RequireActivatedScope(tokens.APIScopeWorkoutsWrite, app.WorkoutHandler.HandleDeleteWorkout))
+
+		r.Get("/exercises", app.Middleware.RequireUser(app.ExerciseHandler.HandleListExercises))
+		r.Get("/exercises/{id}", app.Middleware.RequireUser(app.ExerciseHandler.HandleGetExerciseByID))
+		r.Post("/exercises", app.Middleware.RequireActivatedUser(app.ExerciseHandler.HandleCreateExercise))
+		r.Put("/exercises/{id}", app.Middleware.RequireActivatedUser(app.ExerciseHandler.HandleUpdateExerciseByID))
+		r.Delete("/exercises/{id}", app.Middleware.RequireActivatedUser(app.ExerciseHandler.HandleDeleteExercise))
+		r.Get("/exercises/{name}/next", app.Middleware.RequireUser(app.ProgressionHandler.HandleGetNextSession))
+		r.Get("/users/me/progression", app.Middleware.RequireUser(app.ProgressionHandler.HandleListSettings))
+		r.Put("/users/me/progression", app.Middleware.RequireActivatedUser(app.ProgressionHandler.HandleUpsertSetting))
+
+		r.Get("/users/me", app.Middleware.RequireUser(app.UserHandler.HandleGetCurrentUser))
+		r.Patch("/users/me", app.Middleware.RequireUser(app.UserHandler.HandleUpdateCurrentUser))
+		r.Delete("/users/me", app.Middleware.RequireUser(app.UserHandler.HandleDeleteCurrentUser))
+		r.Put("/users/me/password", app.Middleware.RequireUser(app.UserHandler.HandleChangePassword))
+		r.Post("/users/me/avatar", app.Middleware.RequireUser(app.AvatarHandler.HandleUploadAvatar))
+
+		r.Get("/users/me/export", app.Middleware.RequireScope(tokens.APIScopeWorkoutsRead, app.ExportHandler.HandleExport))
+		r.Post("/users/me/import", app.Middleware.RequireActivatedScope(tokens.APIScopeWorkoutsWrite, app.ImportHandler.HandleImport))
+		r.Get("/users/me/records", app.Middleware.RequireScope(tokens.APIScopeStatsRead, app.RecordHandler.HandleListMyRecords))
+		r.Get("/stats", app.Middleware.RequireScope(tokens.APIScopeStatsRead, app.StatsHandler.HandleGetStats))
+
+		r.Get("/tokens", app.Middleware.RequireUser(app.TokenHandler.HandleListTokens))
+		r.Delete("/tokens", app.Middleware.RequireUser(app.TokenHandler.HandleRevokeAllTokens))
+		r.Delete("/tokens/current", app.Middleware.RequireUser(app.TokenHandler.HandleRevokeCurrentToken))
+
+		r.Get("/api-keys", app.Middleware.RequireUser(app.APIKeyHandler.HandleListAPIKeys))
+		r.Post("/api-keys", app.Middleware.RequireActivatedUser(app.APIKeyHandler.HandleCreateAPIKey))
+		r.Delete("/api-keys/{id}", app.Middleware.RequireUser(app.APIKeyHandler.HandleDeleteAPIKey))
+
+		r.Post("/users/me/2fa", app.Middleware.RequireUser(app.TwoFactorHandler.HandleEnroll))
+		r.Post("/users/me/2fa/confirm", app.Middleware.RequireUser(app.TwoFactorHandler.HandleConfirm))
+		r.Delete("/users/me/2fa", app.Middleware.RequireUser(app.TwoFactorHandler.HandleDisable))
+
+		r.Get("/templates", app.Middleware.RequireUser(app.TemplateHandler.HandleListTemplates))
+		r.Get("/templates/{id}", app.Middleware.RequireUser(app.TemplateHandler.HandleGetTemplateByID))
+		r.Post("/templates", app.Middleware.RequireActivatedUser(app.TemplateHandler.HandleCreateTemplate))
+		r.Put("/templates/{id}", app.Middleware.RequireActivatedUser(app.TemplateHandler.HandleUpdateTemplateByID))
+		r.Delete("/templates/{id}", app.Middleware.RequireActivatedUser(app.TemplateHandler.HandleDeleteTemplate))
+		r.Post("/templates/{id}/start", app.Middleware.RequireActivatedUser(app.TemplateHandler.HandleStartTemplate))
+
+		r.Get("/programs", app.Middleware.RequireUser(app.ProgramHandler.HandleListPrograms))
+		r.Get("/programs/{id}", app.Middleware.RequireUser(app.ProgramHandler.HandleGetProgramByID))
+		r.Post("/programs", app.Middleware.RequireActivatedUser(app.ProgramHandler.HandleCreateProgram))
+		r.Delete("/programs/{id}", app.Middleware.RequireActivatedUser(app.ProgramHandler.HandleDeleteProgram))
+		r.Post("/programs/{id}/enroll", app.Middleware.RequireActivatedUser(app.ProgramHandler.HandleEnroll))
+		r.Get("/programs/{id}/schedule", app.Middleware.RequireUser(app.ProgramHandler.HandleGetSchedule))
+		r.Get("/users/me/today", app.Middleware.RequireUser(app.ProgramHandler.HandleGetToday))
 
 	})
 
 	r.Get("/health", app.HealthCheck)
+	r.Get("/health/live", app.HealthHandler.HandleLive)
+	r.Get("/health/ready", app.HealthHandler.HandleReady)
+	r.Method("GET", "/metrics", app.Metrics.Handler())
+
+	r.Get("/avatars/*", app.AvatarHandler.HandleGetAvatar)
 
 	r.Post("/users", app.UserHandler.HandleRegisterUser)
-	r.Post("/tokens/authenticate", app.TokenHandler.HandleCreateToken)
+	r.Put("/users/activated", app.UserHandler.HandleActivateUser)
+
+	auth := app.Config.Auth
+	r.With(
+		middleware.RateLimit(app.RateLimits, ratelimit.Limit{Burst: auth.LoginIPBurst, Interval: auth.LoginIPInterval}, middleware.ClientIP, app.Logger),
+		middleware.RateLimit(app.RateLimits, ratelimit.Limit{Burst: auth.LoginUsernameBurst, Interval: auth.LoginUsernameInterval}, middleware.LoginUsername, app.Logger),
+	).Post("/tokens/authenticate", app.TokenHandler.HandleCreateToken)
+	r.With(
+		middleware.RateLimit(app.RateLimits, ratelimit.Limit{Burst: auth.LoginIPBurst, Interval: auth.LoginIPInterval}, middleware.ClientIP, app.Logger),
+	).Post("/tokens/2fa", app.TokenHandler.HandleTwoFactorLogin)
+	r.Post("/tokens/refresh", app.TokenHandler.HandleRefreshToken)
+
+	r.With(
+		middleware.RateLimit(app.RateLimits, ratelimit.Limit{Burst: auth.LoginIPBurst, Interval: auth.LoginIPInterval}, middleware.ClientIP, app.Logger),
+	).Post("/password-reset", app.PasswordResetHandler.HandleRequestPasswordReset)
+	r.Put("/password-reset", app.PasswordResetHandler.HandleResetPassword)
+
+	r.With(
+		middleware.RateLimit(app.RateLimits, ratelimit.Limit{Burst: auth.LoginIPBurst, Interval: auth.LoginIPInterval}, middleware.ClientIP, app.Logger),
+	).Post("/users/activation", app.UserHandler.HandleResendActivation)
 
 	return r
 }
@@ -0,0 +1,236 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	BucketDay   = "day"
+	BucketWeek  = "week"
+	BucketMonth = "month"
+
+	GroupByExercise    = "exercise"
+	GroupByMuscleGroup = "muscle_group"
+)
+
+var ErrInvalidStatsQuery = errors.New("invalid stats query")
+
+// StatsQuery selects the user's workouts created in [From, To) and buckets
+// them by day, week or month in the Location time zone. GroupBy optionally
+// adds a per-exercise or per-muscle-group breakdown to every bucket.
+type StatsQuery struct {
+	UserID   int
+	From     time.Time
+	To       time.Time
+	Bucket   string
+	Location *time.Location
+	GroupBy  string
+}
+
+type StatsTotals struct {
+	Sessions        int     `json:"sessions"`
+	DurationMinutes int     `json:"duration_minutes"`
+	CaloriesBurned  int     `json:"calories_burned"`
+	Volume          float64 `json:"volume"`
+}
+
+type StatsBreakdown struct {
+	Key             string  `json:"key"`
+	Volume          float64 `json:"volume"`
+	Sets            int     `json:"sets"`
+	Reps            int     `json:"reps"`
+	DurationSeconds int     `json:"duration_seconds"`
+}
+
+type StatsBucket struct {
+	// Start is the local date the bucket begins on, formatted as YYYY-MM-DD.
+	Start string `json:"start"`
+	StatsTotals
+	Breakdown []StatsBreakdown `json:"breakdown,omitempty"`
+}
+
+type StatsReport struct {
+	Bucket   string        `json:"bucket"`
+	TimeZone string        `json:"time_zone"`
+	From     time.Time     `json:"from"`
+	To       time.Time     `json:"to"`
+	GroupBy  string        `json:"group_by,omitempty"`
+	Totals   StatsTotals   `json:"totals"`
+	Buckets  []StatsBucket `json:"buckets"`
+}
+
+type PostgresAnalyticsStore struct {
+	db       *sql.DB
+	timeouts QueryTimeouts
+}
+
+func NewPostgresAnalyticsStore(db *sql.DB, timeouts QueryTimeouts) *PostgresAnalyticsStore {
+	return &PostgresAnalyticsStore{db: db, timeouts: timeouts}
+}
+
+type AnalyticsStore interface {
+	GetStats(ctx context.Context, query StatsQuery) (*StatsReport, error)
+}
+
+// bucketExpr is the SQL expression for the local start date of a workout's bucket.
+// The bucket size ($2) and time zone ($3) are bound as parameters.
+const bucketExpr = `to_char(date_trunc($2, w.created_at AT TIME ZONE $3), 'YYYY-MM-DD')`
+
+// GetStats aggregates the user's training in SQL. Volume is sets × reps × weight
+// summed over entries. In a muscle group breakdown an entry counts in full towards
+// every muscle group its exercise works, and unlinked entries are "uncategorized".
+func (s *PostgresAnalyticsStore) GetStats(ctx context.Context, q StatsQuery) (*StatsReport, error) {
+	ctx, cancel := s.timeouts.withTimeout(ctx, "AnalyticsStore.GetStats")
+	defer cancel()
+
+	switch q.Bucket {
+	case BucketDay, BucketWeek, BucketMonth:
+	default:
+		return nil, fmt.Errorf("%w: bucket must be day, week or month", ErrInvalidStatsQuery)
+	}
+	switch q.GroupBy {
+	case "", GroupByExercise, GroupByMuscleGroup:
+	default:
+		return nil, fmt.Errorf("%w: group_by must be exercise or muscle_group", ErrInvalidStatsQuery)
+	}
+	if !q.From.Before(q.To) {
+		return nil, fmt.Errorf("%w: from must be before to", ErrInvalidStatsQuery)
+	}
+	if q.Location == nil {
+		q.Location = time.UTC
+	}
+
+	args := []interface{}{q.UserID, q.Bucket, q.Location.String(), q.From, q.To}
+	report := &StatsReport{
+		Bucket:   q.Bucket,
+		TimeZone: q.Location.String(),
+		From:     q.From,
+		To:       q.To,
+		GroupBy:  q.GroupBy,
+		Buckets:  []StatsBucket{},
+	}
+	buckets := map[string]*StatsBucket{}
+
+	sessionQuery := `
+  SELECT ` + bucketExpr + ` AS bucket,
+    count(*),
+    COALESCE(sum(w.duration_minutes), 0),
+    COALESCE(sum(w.calories_burned), 0)
+  FROM workouts w
+  WHERE w.user_id = $1 AND w.created_at >= $4 AND w.created_at < $5
+  GROUP BY bucket
+  ORDER BY bucket
+  `
+	rows, err := s.db.QueryContext(ctx, sessionQuery, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var bucket StatsBucket
+		err = rows.Scan(&bucket.Start, &bucket.Sessions, &bucket.DurationMinutes, &bucket.CaloriesBurned)
+		if err != nil {
+			return nil, err
+		}
+		report.Buckets = append(report.Buckets, bucket)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	for i := range report.Buckets {
+		buckets[report.Buckets[i].Start] = &report.Buckets[i]
+	}
+
+	volumeQuery := `
+  SELECT ` + bucketExpr + ` AS bucket,
+    COALESCE(sum(we.sets * COALESCE(we.reps, 0) * COALESCE(we.weight, 0)), 0)
+  FROM workouts w
+  INNER JOIN workout_entries we ON we.workout_id = w.id
+  WHERE w.user_id = $1 AND w.created_at >= $4 AND w.created_at < $5
+  GROUP BY bucket
+  `
+	rows, err = s.db.QueryContext(ctx, volumeQuery, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var start string
+		var volume float64
+		err = rows.Scan(&start, &volume)
+		if err != nil {
+			return nil, err
+		}
+		if bucket, ok := buckets[start]; ok {
+			bucket.Volume = volume
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if q.GroupBy != "" {
+		err = s.loadBreakdown(ctx, q.GroupBy, args, buckets)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, bucket := range report.Buckets {
+		report.Totals.Sessions += bucket.Sessions
+		report.Totals.DurationMinutes += bucket.DurationMinutes
+		report.Totals.CaloriesBurned += bucket.CaloriesBurned
+		report.Totals.Volume += bucket.Volume
+	}
+
+	return report, nil
+}
+
+func (s *PostgresAnalyticsStore) loadBreakdown(ctx context.Context, groupBy string, args []interface{}, buckets map[string]*StatsBucket) error {
+	keyExpr := `COALESCE(e.name, we.exercise_name)`
+	join := `LEFT JOIN exercises e ON e.id = we.exercise_id`
+	if groupBy == GroupByMuscleGroup {
+		keyExpr = `COALESCE(mg.name, 'uncategorized')`
+		join += `
+  LEFT JOIN LATERAL unnest(e.muscle_groups) AS mg(name) ON true`
+	}
+
+	query := `
+  SELECT ` + bucketExpr + ` AS bucket,
+    ` + keyExpr + ` AS key,
+    COALESCE(sum(we.sets * COALESCE(we.reps, 0) * COALESCE(we.weight, 0)), 0),
+    COALESCE(sum(we.sets), 0),
+    COALESCE(sum(we.sets * COALESCE(we.reps, 0)), 0),
+    COALESCE(sum(we.sets * COALESCE(we.duration_seconds, 0)), 0)
+  FROM workouts w
+  INNER JOIN workout_entries we ON we.workout_id = w.id
+  ` + join + `
+  WHERE w.user_id = $1 AND w.created_at >= $4 AND w.created_at < $5
+  GROUP BY bucket, key
+  ORDER BY bucket, key
+  `
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var start string
+		var breakdown StatsBreakdown
+		err = rows.Scan(&start, &breakdown.Key, &breakdown.Volume, &breakdown.Sets, &breakdown.Reps, &breakdown.DurationSeconds)
+		if err != nil {
+			return err
+		}
+		if bucket, ok := buckets[start]; ok {
+			bucket.Breakdown = append(bucket.Breakdown, breakdown)
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,57 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetStats(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	workouts := NewPostgresWorkoutStore(db, QueryTimeouts{})
+	analytics := NewPostgresAnalyticsStore(db, QueryTimeouts{})
+	user := createTestUser(t, db, "stats_user")
+
+	for i := 0; i < 2; i++ {
+		_, err := workouts.CreateWorkout(context.Background(), &Workout{
+			UserID:          user.ID,
+			Title:           "Squat session",
+			DurationMinutes: 40,
+			CaloriesBurned:  300,
+			Entries: []WorkoutEntry{
+				{ExerciseName: "Squat", Sets: 3, Reps: IntPtr(5), Weight: FloatPtr(100), OrderIndex: 1},
+				{ExerciseName: "Plank", Sets: 2, DurationSeconds: IntPtr(60), OrderIndex: 2},
+			},
+		})
+		require.NoError(t, err)
+	}
+
+	report, err := analytics.GetStats(context.Background(), StatsQuery{
+		UserID:  user.ID,
+		From:    time.Now().Add(-time.Hour),
+		To:      time.Now().Add(time.Hour),
+		Bucket:  BucketDay,
+		GroupBy: GroupByMuscleGroup,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, report.Totals.Sessions)
+	assert.Equal(t, 80, report.Totals.DurationMinutes)
+	assert.Equal(t, 600, report.Totals.CaloriesBurned)
+	assert.InDelta(t, 3000.0, report.Totals.Volume, 0.01)
+	require.NotEmpty(t, report.Buckets)
+
+	keys := []string{}
+	for _, breakdown := range report.Buckets[0].Breakdown {
+		keys = append(keys, breakdown.Key)
+	}
+	assert.Contains(t, keys, "quadriceps")
+	assert.Contains(t, keys, "core")
+
+	_, err = analytics.GetStats(context.Background(), StatsQuery{UserID: user.ID, From: time.Now(), To: time.Now().Add(time.Hour), Bucket: "year"})
+	assert.ErrorIs(t, err, ErrInvalidStatsQuery)
+}
@@ -0,0 +1,163 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/dapoadedire/fem_project/internal/tokens"
+	"github.com/jackc/pgtype"
+)
+
+var ErrDuplicateAPIKey = errors.New("an API key with this name already exists")
+
+// APIKey is a long-lived credential for scripts and devices. Only its hash is
+// stored; Key holds the plain text right after creation and is empty on every
+// later read, where KeyID is what identifies it to its owner.
+type APIKey struct {
+	ID         int64      `json:"id"`
+	UserID     int        `json:"-"`
+	Name       string     `json:"name"`
+	Key        string     `json:"key,omitempty"`
+	KeyID      string     `json:"key_id"`
+	Scopes     []string   `json:"scopes"`
+	Expiry     *time.Time `json:"expiry"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+}
+
+type PostgresAPIKeyStore struct {
+	db       *sql.DB
+	timeouts QueryTimeouts
+}
+
+func NewPostgresAPIKeyStore(db *sql.DB, timeouts QueryTimeouts) *PostgresAPIKeyStore {
+	return &PostgresAPIKeyStore{db: db, timeouts: timeouts}
+}
+
+type APIKeyStore interface {
+	CreateAPIKey(ctx context.Context, key *APIKey, hash []byte) error
+	ListAPIKeys(ctx context.Context, userID int) ([]APIKey, error)
+	DeleteAPIKey(ctx context.Context, id int64, userID int) error
+	GetUserForAPIKey(ctx context.Context, plainText string) (*User, []string, error)
+}
+
+// CreateAPIKey stores key under hash, the hash of its plain text.
+func (s *PostgresAPIKeyStore) CreateAPIKey(ctx context.Context, key *APIKey, hash []byte) error {
+	ctx, cancel := s.timeouts.withTimeout(ctx, "APIKeyStore.CreateAPIKey")
+	defer cancel()
+
+	query := `
+  INSERT INTO api_keys (user_id, name, key_id, hash, scopes, expiry)
+  VALUES ($1, $2, $3, $4, $5, $6)
+  RETURNING id, created_at
+  `
+	err := s.db.QueryRowContext(ctx, query, key.UserID, key.Name, key.KeyID, hash, key.Scopes, key.Expiry).
+		Scan(&key.ID, &key.CreatedAt)
+	if isUniqueViolation(err) {
+		return ErrDuplicateAPIKey
+	}
+	return err
+}
+
+// ListAPIKeys returns the user's API keys, expired ones included, newest
+// first.
+func (s *PostgresAPIKeyStore) ListAPIKeys(ctx context.Context, userID int) ([]APIKey, error) {
+	ctx, cancel := s.timeouts.withTimeout(ctx, "APIKeyStore.ListAPIKeys")
+	defer cancel()
+
+	query := `
+  SELECT id, user_id, name, key_id, scopes, expiry, created_at, last_used_at
+  FROM api_keys
+  WHERE user_id = $1
+  ORDER BY created_at DESC, id DESC
+  `
+	rows, err := s.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []APIKey{}
+	for rows.Next() {
+		var (
+			key    APIKey
+			scopes pgtype.TextArray
+		)
+		err = rows.Scan(&key.ID, &key.UserID, &key.Name, &key.KeyID, &scopes, &key.Expiry, &key.CreatedAt, &key.LastUsedAt)
+		if err != nil {
+			return nil, err
+		}
+		key.Scopes = []string{}
+		err = scopes.AssignTo(&key.Scopes)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// DeleteAPIKey revokes one of the user's API keys. It returns sql.ErrNoRows
+// if the user has no such key.
+func (s *PostgresAPIKeyStore) DeleteAPIKey(ctx context.Context, id int64, userID int) error {
+	ctx, cancel := s.timeouts.withTimeout(ctx, "APIKeyStore.DeleteAPIKey")
+	defer cancel()
+
+	result, err := s.db.ExecContext(ctx, `DELETE FROM api_keys WHERE id = $1 AND user_id = $2`, id, userID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// GetUserForAPIKey returns the owner of an unexpired API key along with the
+// key's scopes, or a nil user if there is no such key. Like GetUserToken it
+// records the use at most once a minute.
+func (s *PostgresAPIKeyStore) GetUserForAPIKey(ctx context.Context, plainText string) (*User, []string, error) {
+	ctx, cancel := s.timeouts.withTimeout(ctx, "APIKeyStore.GetUserForAPIKey")
+	defer cancel()
+
+	query := `WITH key AS (
+		SELECT id, user_id, scopes FROM api_keys
+		WHERE hash = $1 AND (expiry IS NULL OR expiry > CURRENT_TIMESTAMP)
+	), touched AS (
+		UPDATE api_keys k SET last_used_at = CURRENT_TIMESTAMP
+		FROM key
+		WHERE k.id = key.id AND (k.last_used_at IS NULL OR k.last_used_at < CURRENT_TIMESTAMP - INTERVAL '1 minute')
+	)
+	SELECT u.id, u.username, u.email, u.password_hash, u.bio, u.first_name, u.last_name, u.profile_picture, u.last_login, u.created_at, u.updated_at, u.activated,
+		key.scopes
+	FROM users u
+	INNER JOIN key ON key.user_id = u.id
+	`
+
+	user := &User{
+		PasswordHash: password{},
+	}
+	var scopes pgtype.TextArray
+	err := s.db.QueryRowContext(ctx, query, tokens.Hash(plainText)).Scan(&user.ID, &user.Username, &user.Email, &user.PasswordHash.hash,
+		&user.Bio, &user.FirstName, &user.LastName, &user.ProfilePicture,
+		&user.LastLogin, &user.CreatedAt, &user.UpdatedAt, &user.Activated, &scopes)
+	if err == sql.ErrNoRows {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	list := []string{}
+	err = scopes.AssignTo(&list)
+	if err != nil {
+		return nil, nil, err
+	}
+	return user, list, nil
+}
@@ -2,19 +2,26 @@ package store
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"io/fs"
 
+	"github.com/dapoadedire/fem_project/internal/config"
+	"github.com/jackc/pgconn"
 	_ "github.com/jackc/pgx/v4/stdlib"
 	"github.com/pressly/goose/v3"
 )
 
-func Open() (*sql.DB, error) {
-	db, err := sql.Open("pgx", "host=localhost user=postgres password=postgres dbname=postgres port=5432 sslmode=disable")
+func Open(cfg config.DBConfig) (*sql.DB, error) {
+	db, err := sql.Open("pgx", cfg.DSN)
 
 	if err != nil {
 		return nil, fmt.Errorf("db: open %w", err)
 	}
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
 	fmt.Println("Connected to database...")
 	return db, nil
 }
@@ -40,3 +47,9 @@ func Migrate(db *sql.DB, dir string) error {
 	}
 	return nil
 }
+
+// isUniqueViolation reports whether err was caused by a UNIQUE constraint.
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
@@ -0,0 +1,248 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgtype"
+)
+
+const (
+	MeasurementReps     = "reps"
+	MeasurementDuration = "duration"
+)
+
+var (
+	ErrExerciseNotFound    = errors.New("exercise not found")
+	ErrDuplicateExercise   = errors.New("an exercise with this name already exists")
+	ErrMeasurementMismatch = errors.New("entry does not match the exercise measurement type")
+)
+
+type Exercise struct {
+	ID              int       `json:"id"`
+	UserID          *int      `json:"user_id"`
+	Name            string    `json:"name"`
+	MuscleGroups    []string  `json:"muscle_groups"`
+	Equipment       string    `json:"equipment"`
+	MeasurementType string    `json:"measurement_type"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// IsBuiltIn reports whether the exercise is part of the shared catalog rather
+// than a custom exercise added by a user.
+func (e *Exercise) IsBuiltIn() bool {
+	return e.UserID == nil
+}
+
+// ExerciseFilter narrows down ListExercises. Results always include the
+// built-in catalog plus the custom exercises of UserID.
+type ExerciseFilter struct {
+	UserID      int
+	Search      string
+	MuscleGroup string
+	Equipment   string
+}
+
+type PostgresExerciseStore struct {
+	db       *sql.DB
+	timeouts QueryTimeouts
+}
+
+func NewPostgresExerciseStore(db *sql.DB, timeouts QueryTimeouts) *PostgresExerciseStore {
+	return &PostgresExerciseStore{db: db, timeouts: timeouts}
+}
+
+type ExerciseStore interface {
+	CreateExercise(ctx context.Context, exercise *Exercise) error
+	GetExerciseByID(ctx context.Context, id int64) (*Exercise, error)
+	ListExercises(ctx context.Context, filter ExerciseFilter) ([]Exercise, error)
+	UpdateExercise(ctx context.Context, exercise *Exercise) error
+	DeleteExercise(ctx context.Context, id int64) error
+}
+
+const exerciseColumns = `id, user_id, name, muscle_groups, equipment, measurement_type, created_at, updated_at`
+
+func scanExercise(row interface{ Scan(...interface{}) error }, exercise *Exercise) error {
+	var muscleGroups pgtype.TextArray
+	err := row.Scan(
+		&exercise.ID,
+		&exercise.UserID,
+		&exercise.Name,
+		&muscleGroups,
+		&exercise.Equipment,
+		&exercise.MeasurementType,
+		&exercise.CreatedAt,
+		&exercise.UpdatedAt,
+	)
+	if err != nil {
+		return err
+	}
+	exercise.MuscleGroups = []string{}
+	return muscleGroups.AssignTo(&exercise.MuscleGroups)
+}
+
+func (s *PostgresExerciseStore) CreateExercise(ctx context.Context, exercise *Exercise) error {
+	ctx, cancel := s.timeouts.withTimeout(ctx, "ExerciseStore.CreateExercise")
+	defer cancel()
+
+	if exercise.MuscleGroups == nil {
+		exercise.MuscleGroups = []string{}
+	}
+	query := `
+  INSERT INTO exercises (user_id, name, muscle_groups, equipment, measurement_type)
+  VALUES ($1, $2, $3, $4, $5)
+  RETURNING id, created_at, updated_at
+  `
+	err := s.db.QueryRowContext(ctx, query, exercise.UserID, exercise.Name, exercise.MuscleGroups, exercise.Equipment, exercise.MeasurementType).
+		Scan(&exercise.ID, &exercise.CreatedAt, &exercise.UpdatedAt)
+	if isUniqueViolation(err) {
+		return ErrDuplicateExercise
+	}
+	return err
+}
+
+func (s *PostgresExerciseStore) GetExerciseByID(ctx context.Context, id int64) (*Exercise, error) {
+	ctx, cancel := s.timeouts.withTimeout(ctx, "ExerciseStore.GetExerciseByID")
+	defer cancel()
+
+	exercise := &Exercise{}
+	query := `SELECT ` + exerciseColumns + ` FROM exercises WHERE id = $1`
+	err := scanExercise(s.db.QueryRowContext(ctx, query, id), exercise)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return exercise, nil
+}
+
+func (s *PostgresExerciseStore) ListExercises(ctx context.Context, filter ExerciseFilter) ([]Exercise, error) {
+	ctx, cancel := s.timeouts.withTimeout(ctx, "ExerciseStore.ListExercises")
+	defer cancel()
+
+	args := []interface{}{filter.UserID}
+	conditions := []string{"(user_id IS NULL OR user_id = $1)"}
+	if filter.Search != "" {
+		args = append(args, likePattern(filter.Search))
+		conditions = append(conditions, fmt.Sprintf("name ILIKE $%d", len(args)))
+	}
+	if filter.MuscleGroup != "" {
+		args = append(args, strings.ToLower(filter.MuscleGroup))
+		conditions = append(conditions, fmt.Sprintf("$%d = ANY(muscle_groups)", len(args)))
+	}
+	if filter.Equipment != "" {
+		args = append(args, filter.Equipment)
+		conditions = append(conditions, fmt.Sprintf("lower(equipment) = lower($%d)", len(args)))
+	}
+
+	query := `SELECT ` + exerciseColumns + ` FROM exercises WHERE ` + strings.Join(conditions, " AND ") + ` ORDER BY name, id`
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	exercises := []Exercise{}
+	for rows.Next() {
+		var exercise Exercise
+		err = scanExercise(rows, &exercise)
+		if err != nil {
+			return nil, err
+		}
+		exercises = append(exercises, exercise)
+	}
+	return exercises, rows.Err()
+}
+
+func (s *PostgresExerciseStore) UpdateExercise(ctx context.Context, exercise *Exercise) error {
+	ctx, cancel := s.timeouts.withTimeout(ctx, "ExerciseStore.UpdateExercise")
+	defer cancel()
+
+	if exercise.MuscleGroups == nil {
+		exercise.MuscleGroups = []string{}
+	}
+	query := `
+  UPDATE exercises
+  SET name = $1, muscle_groups = $2, equipment = $3, measurement_type = $4, updated_at = CURRENT_TIMESTAMP
+  WHERE id = $5
+  RETURNING updated_at
+  `
+	err := s.db.QueryRowContext(ctx, query, exercise.Name, exercise.MuscleGroups, exercise.Equipment, exercise.MeasurementType, exercise.ID).
+		Scan(&exercise.UpdatedAt)
+	if isUniqueViolation(err) {
+		return ErrDuplicateExercise
+	}
+	return err
+}
+
+func (s *PostgresExerciseStore) DeleteExercise(ctx context.Context, id int64) error {
+	ctx, cancel := s.timeouts.withTimeout(ctx, "ExerciseStore.DeleteExercise")
+	defer cancel()
+
+	result, err := s.db.ExecContext(ctx, `DELETE FROM exercises WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// resolveEntryExercise links entry to the catalog visible to userID. An entry
+// with an exercise ID must reference an existing exercise; an entry with only a
+// name is matched case-insensitively and left as free text when nothing matches.
+// Linked entries take the catalog name and must match its measurement type.
+func resolveEntryExercise(ctx context.Context, tx *sql.Tx, userID int, entry *WorkoutEntry) error {
+	var (
+		id              int
+		name            string
+		measurementType string
+		err             error
+	)
+	if entry.ExerciseID != nil {
+		query := `
+    SELECT id, name, measurement_type FROM exercises
+    WHERE id = $1 AND (user_id IS NULL OR user_id = $2)
+    `
+		err = tx.QueryRowContext(ctx, query, *entry.ExerciseID, userID).Scan(&id, &name, &measurementType)
+		if err == sql.ErrNoRows {
+			return ErrExerciseNotFound
+		}
+	} else {
+		// a user's own exercise wins over a built-in one with the same name
+		query := `
+    SELECT id, name, measurement_type FROM exercises
+    WHERE lower(name) = lower($1) AND (user_id IS NULL OR user_id = $2)
+    ORDER BY user_id NULLS LAST
+    LIMIT 1
+    `
+		err = tx.QueryRowContext(ctx, query, strings.TrimSpace(entry.ExerciseName), userID).Scan(&id, &name, &measurementType)
+		if err == sql.ErrNoRows {
+			return nil
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case measurementType == MeasurementReps && entry.Reps == nil,
+		measurementType == MeasurementDuration && entry.DurationSeconds == nil:
+		return fmt.Errorf("%s: %w", name, ErrMeasurementMismatch)
+	}
+
+	entry.ExerciseID = &id
+	entry.ExerciseName = name
+	return nil
+}
@@ -0,0 +1,116 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// LockoutPolicy locks an account out after Threshold failed logins in a row,
+// for Base at first and twice as long with every further failure, up to Max.
+// Failures are forgotten on a successful login or once the last one is older
+// than Window.
+type LockoutPolicy struct {
+	Threshold int
+	Base      time.Duration
+	Max       time.Duration
+	Window    time.Duration
+}
+
+// LockDuration is how long failures failed logins in a row lock an account out for.
+func (p LockoutPolicy) LockDuration(failures int) time.Duration {
+	if failures < p.Threshold {
+		return 0
+	}
+	d := p.Base
+	for i := p.Threshold; i < failures && d < p.Max; i++ {
+		d *= 2
+	}
+	return min(d, p.Max)
+}
+
+type PostgresLoginAttemptStore struct {
+	db       *sql.DB
+	timeouts QueryTimeouts
+	policy   LockoutPolicy
+}
+
+func NewPostgresLoginAttemptStore(db *sql.DB, timeouts QueryTimeouts, policy LockoutPolicy) *PostgresLoginAttemptStore {
+	return &PostgresLoginAttemptStore{db: db, timeouts: timeouts, policy: policy}
+}
+
+type LoginAttemptStore interface {
+	// GetLockout returns when the user's lockout ends, or nil when they are not locked out.
+	GetLockout(ctx context.Context, userID int) (*time.Time, error)
+	// RecordFailedLogin counts a failed login and returns the lockout it
+	// started, if any.
+	RecordFailedLogin(ctx context.Context, userID int) (*time.Time, error)
+	ResetFailedLogins(ctx context.Context, userID int) error
+}
+
+func (s *PostgresLoginAttemptStore) GetLockout(ctx context.Context, userID int) (*time.Time, error) {
+	ctx, cancel := s.timeouts.withTimeout(ctx, "LoginAttemptStore.GetLockout")
+	defer cancel()
+
+	var lockedUntil time.Time
+	query := `
+  SELECT locked_until FROM login_attempts
+  WHERE user_id = $1 AND locked_until > CURRENT_TIMESTAMP
+  `
+	err := s.db.QueryRowContext(ctx, query, userID).Scan(&lockedUntil)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &lockedUntil, nil
+}
+
+func (s *PostgresLoginAttemptStore) RecordFailedLogin(ctx context.Context, userID int) (*time.Time, error) {
+	ctx, cancel := s.timeouts.withTimeout(ctx, "LoginAttemptStore.RecordFailedLogin")
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var failures int
+	query := `
+  INSERT INTO login_attempts AS a (user_id, failed_count, last_failed_at)
+  VALUES ($1, 1, CURRENT_TIMESTAMP)
+  ON CONFLICT (user_id) DO UPDATE SET
+    failed_count = CASE
+      WHEN a.last_failed_at < CURRENT_TIMESTAMP - make_interval(secs => $2) THEN 1
+      ELSE a.failed_count + 1
+    END,
+    last_failed_at = CURRENT_TIMESTAMP
+  RETURNING failed_count
+  `
+	err = tx.QueryRowContext(ctx, query, userID, s.policy.Window.Seconds()).Scan(&failures)
+	if err != nil {
+		return nil, err
+	}
+
+	var lockedUntil *time.Time
+	if d := s.policy.LockDuration(failures); d > 0 {
+		until := time.Now().Add(d)
+		lockedUntil = &until
+	}
+	_, err = tx.ExecContext(ctx, `UPDATE login_attempts SET locked_until = $2 WHERE user_id = $1`, userID, lockedUntil)
+	if err != nil {
+		return nil, err
+	}
+
+	return lockedUntil, tx.Commit()
+}
+
+func (s *PostgresLoginAttemptStore) ResetFailedLogins(ctx context.Context, userID int) error {
+	ctx, cancel := s.timeouts.withTimeout(ctx, "LoginAttemptStore.ResetFailedLogins")
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, `DELETE FROM login_attempts WHERE user_id = $1`, userID)
+	return err
+}
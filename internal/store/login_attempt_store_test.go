@@ -0,0 +1,20 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLockDuration(t *testing.T) {
+	policy := LockoutPolicy{Threshold: 5, Base: time.Minute, Max: 10 * time.Minute}
+
+	assert.Zero(t, policy.LockDuration(1))
+	assert.Zero(t, policy.LockDuration(4))
+	assert.Equal(t, time.Minute, policy.LockDuration(5))
+	assert.Equal(t, 2*time.Minute, policy.LockDuration(6))
+	assert.Equal(t, 8*time.Minute, policy.LockDuration(8))
+	assert.Equal(t, 10*time.Minute, policy.LockDuration(9))
+	assert.Equal(t, 10*time.Minute, policy.LockDuration(1000))
+}
@@ -0,0 +1,347 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"math"
+	"strings"
+	"time"
+)
+
+const (
+	RecordMaxWeight           = "max_weight"
+	RecordMaxReps             = "max_reps"
+	RecordEstimated1RMEpley   = "estimated_1rm_epley"
+	RecordEstimated1RMBrzycki = "estimated_1rm_brzycki"
+	RecordLongestDuration     = "longest_duration"
+)
+
+// maxRepsFor1RM is the highest rep count an estimated one-rep max is computed
+// from; both formulas lose accuracy quickly past it.
+const maxRepsFor1RM = 12
+
+type PersonalRecord struct {
+	ID             int       `json:"id"`
+	ExerciseID     *int      `json:"exercise_id"`
+	ExerciseName   string    `json:"exercise_name"`
+	RecordType     string    `json:"record_type"`
+	Weight         *float64  `json:"weight"`
+	Value          float64   `json:"value"`
+	WorkoutID      *int      `json:"workout_id"`
+	WorkoutEntryID *int      `json:"workout_entry_id"`
+	AchievedAt     time.Time `json:"achieved_at"`
+}
+
+type PostgresPersonalRecordStore struct {
+	db       *sql.DB
+	timeouts QueryTimeouts
+}
+
+func NewPostgresPersonalRecordStore(db *sql.DB, timeouts QueryTimeouts) *PostgresPersonalRecordStore {
+	return &PostgresPersonalRecordStore{db: db, timeouts: timeouts}
+}
+
+type PersonalRecordStore interface {
+	ListPersonalRecords(ctx context.Context, userID int, exercise string) ([]PersonalRecord, error)
+}
+
+// EstimateOneRepMaxEpley estimates a one-rep max as weight * (1 + reps/30).
+func EstimateOneRepMaxEpley(weight float64, reps int) float64 {
+	if reps == 1 {
+		return weight
+	}
+	return weight * (1 + float64(reps)/30)
+}
+
+// EstimateOneRepMaxBrzycki estimates a one-rep max as weight * 36 / (37 - reps).
+func EstimateOneRepMaxBrzycki(weight float64, reps int) float64 {
+	return weight * 36 / (37 - float64(reps))
+}
+
+// recordKey identifies a record the way the personal_records unique index
+// does: by exercise name, case-insensitively, record type and weight.
+type recordKey struct {
+	exercise   string
+	recordType string
+	weight     float64
+}
+
+func keyOf(record *PersonalRecord) recordKey {
+	k := recordKey{exercise: strings.ToLower(record.ExerciseName), recordType: record.RecordType}
+	if record.Weight != nil {
+		k.weight = *record.Weight
+	}
+	return k
+}
+
+// recordCandidates lists every record the entries of workout could set,
+// keeping only the best candidate for each record.
+func recordCandidates(workout *Workout) []PersonalRecord {
+	best := map[recordKey]int{}
+	candidates := []PersonalRecord{}
+
+	add := func(entry *WorkoutEntry, recordType string, weight *float64, value float64) {
+		k := recordKey{exercise: strings.ToLower(entry.ExerciseName), recordType: recordType}
+		if weight != nil {
+			k.weight = *weight
+		}
+		value = math.Round(value*100) / 100
+
+		workoutID := workout.ID
+		entryID := entry.ID
+		record := PersonalRecord{
+			ExerciseID:     entry.ExerciseID,
+			ExerciseName:   entry.ExerciseName,
+			RecordType:     recordType,
+			Weight:         weight,
+			Value:          value,
+			WorkoutID:      &workoutID,
+			WorkoutEntryID: &entryID,
+		}
+
+		if i, ok := best[k]; ok {
+			if candidates[i].Value < value {
+				candidates[i] = record
+			}
+			return
+		}
+		best[k] = len(candidates)
+		candidates = append(candidates, record)
+	}
+
+	for i := range workout.Entries {
+		entry := &workout.Entries[i]
+		if entry.DurationSeconds != nil && *entry.DurationSeconds > 0 {
+			add(entry, RecordLongestDuration, nil, float64(*entry.DurationSeconds))
+		}
+		if entry.Reps == nil || *entry.Reps <= 0 {
+			continue
+		}
+
+		reps := *entry.Reps
+		weight := 0.0
+		if entry.Weight != nil {
+			weight = *entry.Weight
+		}
+		add(entry, RecordMaxReps, &weight, float64(reps))
+
+		if weight <= 0 {
+			continue
+		}
+		add(entry, RecordMaxWeight, nil, weight)
+		if reps <= maxRepsFor1RM {
+			add(entry, RecordEstimated1RMEpley, nil, EstimateOneRepMaxEpley(weight, reps))
+			add(entry, RecordEstimated1RMBrzycki, nil, EstimateOneRepMaxBrzycki(weight, reps))
+		}
+	}
+
+	return candidates
+}
+
+// updatePersonalRecords stores every record set by the entries of workout and
+// returns the ones that beat (or are the first for) the user's previous best.
+// It runs inside the transaction that persisted the entries. Records are dated
+// by their workout so that imported history keeps its original dates.
+func updatePersonalRecords(ctx context.Context, tx *sql.Tx, workout *Workout) ([]PersonalRecord, error) {
+	query := `
+  INSERT INTO personal_records (user_id, exercise_id, exercise_name, record_type, weight, value, workout_id, workout_entry_id, achieved_at)
+  VALUES ($1, $2, $3, $4, $5, $6, $7, $8, (SELECT created_at FROM workouts WHERE id = $7))
+  ON CONFLICT (user_id, lower(exercise_name), record_type, weight)
+  DO UPDATE SET
+    exercise_id = EXCLUDED.exercise_id,
+    exercise_name = EXCLUDED.exercise_name,
+    value = EXCLUDED.value,
+    workout_id = EXCLUDED.workout_id,
+    workout_entry_id = EXCLUDED.workout_entry_id,
+    achieved_at = EXCLUDED.achieved_at
+  WHERE personal_records.value < EXCLUDED.value
+  RETURNING id, achieved_at
+  `
+
+	newRecords := []PersonalRecord{}
+	for _, record := range recordCandidates(workout) {
+		weight := 0.0
+		if record.Weight != nil {
+			weight = *record.Weight
+		}
+
+		err := tx.QueryRowContext(ctx, query,
+			workout.UserID,
+			record.ExerciseID,
+			record.ExerciseName,
+			record.RecordType,
+			weight,
+			record.Value,
+			record.WorkoutID,
+			record.WorkoutEntryID,
+		).Scan(&record.ID, &record.AchievedAt)
+		if err == sql.ErrNoRows {
+			// the existing record is at least as good
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		newRecords = append(newRecords, record)
+	}
+
+	return newRecords, nil
+}
+
+// recordExercises returns the lowercased names of the exercises a workout
+// holds records for. Their records have to be recomputed when the workout's
+// entries change or go away, since the next best entry may be anywhere.
+func recordExercises(ctx context.Context, tx *sql.Tx, workoutID int) ([]string, error) {
+	query := `SELECT DISTINCT lower(exercise_name) FROM personal_records WHERE workout_id = $1`
+	rows, err := tx.QueryContext(ctx, query, workoutID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	exercises := []string{}
+	for rows.Next() {
+		var exercise string
+		err = rows.Scan(&exercise)
+		if err != nil {
+			return nil, err
+		}
+		exercises = append(exercises, exercise)
+	}
+	return exercises, rows.Err()
+}
+
+// heldRecords returns the value of each record workout workoutID holds.
+func heldRecords(ctx context.Context, tx *sql.Tx, workoutID int) (map[recordKey]float64, error) {
+	query := `SELECT lower(exercise_name), record_type, weight, value FROM personal_records WHERE workout_id = $1`
+	rows, err := tx.QueryContext(ctx, query, workoutID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	held := map[recordKey]float64{}
+	for rows.Next() {
+		var k recordKey
+		var value float64
+		err = rows.Scan(&k.exercise, &k.recordType, &k.weight, &value)
+		if err != nil {
+			return nil, err
+		}
+		held[k] = value
+	}
+	return held, rows.Err()
+}
+
+// changedRecords leaves out of records those a workout already held with the
+// same value, as returned by heldRecords before its entries were replaced.
+func changedRecords(records []PersonalRecord, held map[recordKey]float64) []PersonalRecord {
+	changed := []PersonalRecord{}
+	for _, record := range records {
+		if value, ok := held[keyOf(&record)]; ok && value == record.Value {
+			continue
+		}
+		changed = append(changed, record)
+	}
+	return changed
+}
+
+// recomputePersonalRecords rebuilds the user's records for exercises, as
+// returned by recordExercises, from scratch out of their entries, leaving out
+// those of workout skipWorkoutID. Workouts are replayed oldest first so that
+// a tied record stays with the workout that set it first.
+func recomputePersonalRecords(ctx context.Context, tx *sql.Tx, userID int, exercises []string, skipWorkoutID int) error {
+	if len(exercises) == 0 {
+		return nil
+	}
+
+	_, err := tx.ExecContext(ctx, `DELETE FROM personal_records WHERE user_id = $1 AND lower(exercise_name) = ANY($2)`, userID, exercises)
+	if err != nil {
+		return err
+	}
+
+	query := `
+  SELECT w.id, e.id, e.exercise_id, e.exercise_name, e.reps, e.duration_seconds, e.weight
+  FROM workout_entries e
+  INNER JOIN workouts w ON w.id = e.workout_id
+  WHERE w.user_id = $1 AND w.id <> $2 AND lower(e.exercise_name) = ANY($3)
+  ORDER BY w.created_at, w.id, e.order_index, e.id
+  `
+	rows, err := tx.QueryContext(ctx, query, userID, skipWorkoutID, exercises)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	workouts := []*Workout{}
+	for rows.Next() {
+		var workoutID int
+		var entry WorkoutEntry
+		err = rows.Scan(&workoutID, &entry.ID, &entry.ExerciseID, &entry.ExerciseName, &entry.Reps, &entry.DurationSeconds, &entry.Weight)
+		if err != nil {
+			return err
+		}
+		if len(workouts) == 0 || workouts[len(workouts)-1].ID != workoutID {
+			workouts = append(workouts, &Workout{ID: workoutID, UserID: userID})
+		}
+		last := workouts[len(workouts)-1]
+		last.Entries = append(last.Entries, entry)
+	}
+	err = rows.Err()
+	if err != nil {
+		return err
+	}
+	rows.Close()
+
+	for _, workout := range workouts {
+		_, err = updatePersonalRecords(ctx, tx, workout)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListPersonalRecords returns the user's current records, optionally limited
+// to a single exercise matched case-insensitively by name.
+func (s *PostgresPersonalRecordStore) ListPersonalRecords(ctx context.Context, userID int, exercise string) ([]PersonalRecord, error) {
+	ctx, cancel := s.timeouts.withTimeout(ctx, "PersonalRecordStore.ListPersonalRecords")
+	defer cancel()
+
+	query := `
+  SELECT id, exercise_id, exercise_name, record_type, weight, value, workout_id, workout_entry_id, achieved_at
+  FROM personal_records
+  WHERE user_id = $1 AND ($2 = '' OR lower(exercise_name) = lower($2))
+  ORDER BY lower(exercise_name), record_type, weight
+  `
+	rows, err := s.db.QueryContext(ctx, query, userID, exercise)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	records := []PersonalRecord{}
+	for rows.Next() {
+		var record PersonalRecord
+		var weight float64
+		err = rows.Scan(
+			&record.ID,
+			&record.ExerciseID,
+			&record.ExerciseName,
+			&record.RecordType,
+			&weight,
+			&record.Value,
+			&record.WorkoutID,
+			&record.WorkoutEntryID,
+			&record.AchievedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if record.RecordType == RecordMaxReps {
+			record.Weight = &weight
+		}
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
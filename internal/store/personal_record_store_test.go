@@ -0,0 +1,74 @@
+package store
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEstimateOneRepMax(t *testing.T) {
+	assert.Equal(t, 100.0, EstimateOneRepMaxEpley(100, 1))
+	assert.InDelta(t, 116.67, EstimateOneRepMaxEpley(100, 5), 0.01)
+	assert.InDelta(t, 100.0, EstimateOneRepMaxBrzycki(100, 1), 0.01)
+	assert.InDelta(t, 112.5, EstimateOneRepMaxBrzycki(100, 5), 0.01)
+}
+
+func TestRecordCandidates(t *testing.T) {
+	workout := &Workout{
+		ID: 7,
+		Entries: []WorkoutEntry{
+			{ID: 1, ExerciseName: "Squat", Sets: 3, Reps: IntPtr(5), Weight: FloatPtr(100)},
+			{ID: 2, ExerciseName: "squat", Sets: 1, Reps: IntPtr(3), Weight: FloatPtr(110)},
+			{ID: 3, ExerciseName: "Push Up", Sets: 3, Reps: IntPtr(20)},
+			{ID: 4, ExerciseName: "Plank", Sets: 1, DurationSeconds: IntPtr(90)},
+		},
+	}
+
+	byKey := map[string]PersonalRecord{}
+	for _, record := range recordCandidates(workout) {
+		key := record.ExerciseName + "/" + record.RecordType
+		if record.Weight != nil {
+			key += "@" + fmt.Sprint(*record.Weight)
+		}
+		byKey[key] = record
+	}
+
+	require.Contains(t, byKey, "squat/max_weight")
+	assert.Equal(t, 110.0, byKey["squat/max_weight"].Value)
+	assert.Equal(t, 2, *byKey["squat/max_weight"].WorkoutEntryID)
+
+	// 110x3 beats 100x5 on Epley (121 vs 116.67)
+	require.Contains(t, byKey, "squat/estimated_1rm_epley")
+	assert.Equal(t, 121.0, byKey["squat/estimated_1rm_epley"].Value)
+
+	assert.Contains(t, byKey, "Squat/max_reps@100")
+	assert.Contains(t, byKey, "squat/max_reps@110")
+	assert.Equal(t, 20.0, byKey["Push Up/max_reps@0"].Value)
+	assert.NotContains(t, byKey, "Push Up/max_weight")
+	assert.Equal(t, 90.0, byKey["Plank/longest_duration"].Value)
+}
+
+func TestChangedRecords(t *testing.T) {
+	held := map[recordKey]float64{
+		{exercise: "squat", recordType: RecordMaxWeight}:            100,
+		{exercise: "squat", recordType: RecordMaxReps, weight: 100}: 5,
+		{exercise: "squat", recordType: RecordEstimated1RMEpley}:    116.67,
+		{exercise: "plank", recordType: RecordLongestDuration}:      60,
+	}
+	records := []PersonalRecord{
+		{ExerciseName: "Squat", RecordType: RecordMaxWeight, Value: 100},
+		{ExerciseName: "Squat", RecordType: RecordMaxReps, Weight: FloatPtr(100), Value: 6},
+		{ExerciseName: "Squat", RecordType: RecordMaxReps, Weight: FloatPtr(90), Value: 8},
+		{ExerciseName: "Squat", RecordType: RecordEstimated1RMEpley, Value: 116.67},
+	}
+
+	changed := changedRecords(records, held)
+	require.Len(t, changed, 2)
+	assert.Equal(t, 6.0, changed[0].Value)
+	assert.Equal(t, 90.0, *changed[1].Weight)
+
+	assert.Empty(t, changedRecords(records[:1], held))
+	assert.NotNil(t, changedRecords(nil, held))
+}
@@ -0,0 +1,482 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+const (
+	SessionCompleted = "completed"
+	SessionMissed    = "missed"
+	SessionDue       = "due"
+	SessionUpcoming  = "upcoming"
+)
+
+var ErrProgramDayNotFound = errors.New("program day is not part of an active enrollment")
+
+type Program struct {
+	ID          int          `json:"id"`
+	UserID      int          `json:"user_id"`
+	Name        string       `json:"name"`
+	Description string       `json:"description"`
+	Weeks       int          `json:"weeks"`
+	CreatedAt   time.Time    `json:"created_at"`
+	UpdatedAt   time.Time    `json:"updated_at"`
+	Days        []ProgramDay `json:"days"`
+}
+
+type ProgramDay struct {
+	ID         int    `json:"id"`
+	WeekNumber int    `json:"week_number"`
+	DayNumber  int    `json:"day_number"`
+	TemplateID *int   `json:"template_id"`
+	Title      string `json:"title"`
+}
+
+// Enrollment starts a user on a program. Week 1 day 1 falls on StartDate
+// (YYYY-MM-DD) and every following calendar day is the next program day.
+type Enrollment struct {
+	ID        int       `json:"id"`
+	UserID    int       `json:"user_id"`
+	ProgramID int       `json:"program_id"`
+	StartDate string    `json:"start_date"`
+	Active    bool      `json:"active"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type ScheduledSession struct {
+	ProgramDay
+	Date      string `json:"date,omitempty"`
+	Status    string `json:"status,omitempty"`
+	WorkoutID *int   `json:"workout_id,omitempty"`
+}
+
+type Adherence struct {
+	Scheduled int     `json:"scheduled"`
+	Completed int     `json:"completed"`
+	Rate      float64 `json:"rate"`
+}
+
+type Schedule struct {
+	ProgramID  int                `json:"program_id"`
+	Enrollment *Enrollment        `json:"enrollment"`
+	Sessions   []ScheduledSession `json:"sessions"`
+	Adherence  *Adherence         `json:"adherence,omitempty"`
+}
+
+type PostgresProgramStore struct {
+	db       *sql.DB
+	timeouts QueryTimeouts
+}
+
+func NewPostgresProgramStore(db *sql.DB, timeouts QueryTimeouts) *PostgresProgramStore {
+	return &PostgresProgramStore{db: db, timeouts: timeouts}
+}
+
+type ProgramStore interface {
+	CreateProgram(ctx context.Context, program *Program) (*Program, error)
+	GetProgramByID(ctx context.Context, id int64) (*Program, error)
+	ListPrograms(ctx context.Context, userID int) ([]Program, error)
+	DeleteProgram(ctx context.Context, id int64) error
+	Enroll(ctx context.Context, enrollment *Enrollment) error
+	GetActiveEnrollment(ctx context.Context, userID int) (*Enrollment, error)
+	GetLatestEnrollment(ctx context.Context, userID, programID int) (*Enrollment, error)
+	GetCompletedDays(ctx context.Context, enrollmentID int) (map[int]int, error)
+}
+
+func (pg *PostgresProgramStore) CreateProgram(ctx context.Context, program *Program) (*Program, error) {
+	ctx, cancel := pg.timeouts.withTimeout(ctx, "ProgramStore.CreateProgram")
+	defer cancel()
+
+	tx, err := pg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+  INSERT INTO programs (user_id, name, description, weeks)
+  VALUES ($1, $2, $3, $4)
+  RETURNING id, created_at, updated_at
+  `
+	err = tx.QueryRowContext(ctx, query, program.UserID, program.Name, program.Description, program.Weeks).
+		Scan(&program.ID, &program.CreatedAt, &program.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	dayQuery := `
+  INSERT INTO program_days (program_id, week_number, day_number, template_id, title)
+  VALUES ($1, $2, $3, $4, $5)
+  RETURNING id
+  `
+	for i := range program.Days {
+		day := &program.Days[i]
+		err = tx.QueryRowContext(ctx, dayQuery, program.ID, day.WeekNumber, day.DayNumber, day.TemplateID, day.Title).Scan(&day.ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return program, nil
+}
+
+func (pg *PostgresProgramStore) GetProgramByID(ctx context.Context, id int64) (*Program, error) {
+	ctx, cancel := pg.timeouts.withTimeout(ctx, "ProgramStore.GetProgramByID")
+	defer cancel()
+
+	program := &Program{}
+	query := `
+  SELECT id, user_id, name, description, weeks, created_at, updated_at
+  FROM programs
+  WHERE id = $1
+  `
+	err := pg.db.QueryRowContext(ctx, query, id).Scan(
+		&program.ID,
+		&program.UserID,
+		&program.Name,
+		&program.Description,
+		&program.Weeks,
+		&program.CreatedAt,
+		&program.UpdatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	programs := []Program{*program}
+	err = pg.loadProgramDays(ctx, programs)
+	if err != nil {
+		return nil, err
+	}
+	return &programs[0], nil
+}
+
+func (pg *PostgresProgramStore) ListPrograms(ctx context.Context, userID int) ([]Program, error) {
+	ctx, cancel := pg.timeouts.withTimeout(ctx, "ProgramStore.ListPrograms")
+	defer cancel()
+
+	query := `
+  SELECT id, user_id, name, description, weeks, created_at, updated_at
+  FROM programs
+  WHERE user_id = $1
+  ORDER BY name, id
+  `
+	rows, err := pg.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	programs := []Program{}
+	for rows.Next() {
+		var program Program
+		err = rows.Scan(
+			&program.ID,
+			&program.UserID,
+			&program.Name,
+			&program.Description,
+			&program.Weeks,
+			&program.CreatedAt,
+			&program.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		programs = append(programs, program)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	err = pg.loadProgramDays(ctx, programs)
+	if err != nil {
+		return nil, err
+	}
+	return programs, nil
+}
+
+func (pg *PostgresProgramStore) DeleteProgram(ctx context.Context, id int64) error {
+	ctx, cancel := pg.timeouts.withTimeout(ctx, "ProgramStore.DeleteProgram")
+	defer cancel()
+
+	result, err := pg.db.ExecContext(ctx, `DELETE FROM programs WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// Enroll makes enrollment the user's active enrollment, ending any other one.
+func (pg *PostgresProgramStore) Enroll(ctx context.Context, enrollment *Enrollment) error {
+	ctx, cancel := pg.timeouts.withTimeout(ctx, "ProgramStore.Enroll")
+	defer cancel()
+
+	tx, err := pg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `UPDATE program_enrollments SET active = FALSE WHERE user_id = $1 AND active`, enrollment.UserID)
+	if err != nil {
+		return err
+	}
+
+	query := `
+  INSERT INTO program_enrollments (user_id, program_id, start_date)
+  VALUES ($1, $2, $3::date)
+  RETURNING id, to_char(start_date, 'YYYY-MM-DD'), active, created_at
+  `
+	err = tx.QueryRowContext(ctx, query, enrollment.UserID, enrollment.ProgramID, enrollment.StartDate).
+		Scan(&enrollment.ID, &enrollment.StartDate, &enrollment.Active, &enrollment.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (pg *PostgresProgramStore) GetActiveEnrollment(ctx context.Context, userID int) (*Enrollment, error) {
+	ctx, cancel := pg.timeouts.withTimeout(ctx, "ProgramStore.GetActiveEnrollment")
+	defer cancel()
+
+	query := `
+  SELECT id, user_id, program_id, to_char(start_date, 'YYYY-MM-DD'), active, created_at
+  FROM program_enrollments
+  WHERE user_id = $1 AND active
+  `
+	return pg.scanEnrollment(pg.db.QueryRowContext(ctx, query, userID))
+}
+
+func (pg *PostgresProgramStore) GetLatestEnrollment(ctx context.Context, userID, programID int) (*Enrollment, error) {
+	ctx, cancel := pg.timeouts.withTimeout(ctx, "ProgramStore.GetLatestEnrollment")
+	defer cancel()
+
+	query := `
+  SELECT id, user_id, program_id, to_char(start_date, 'YYYY-MM-DD'), active, created_at
+  FROM program_enrollments
+  WHERE user_id = $1 AND program_id = $2
+  ORDER BY active DESC, created_at DESC
+  LIMIT 1
+  `
+	return pg.scanEnrollment(pg.db.QueryRowContext(ctx, query, userID, programID))
+}
+
+func (pg *PostgresProgramStore) scanEnrollment(row *sql.Row) (*Enrollment, error) {
+	enrollment := &Enrollment{}
+	err := row.Scan(
+		&enrollment.ID,
+		&enrollment.UserID,
+		&enrollment.ProgramID,
+		&enrollment.StartDate,
+		&enrollment.Active,
+		&enrollment.CreatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return enrollment, nil
+}
+
+// GetCompletedDays maps each program day completed during the enrollment to
+// the ID of the earliest workout logged against it.
+func (pg *PostgresProgramStore) GetCompletedDays(ctx context.Context, enrollmentID int) (map[int]int, error) {
+	ctx, cancel := pg.timeouts.withTimeout(ctx, "ProgramStore.GetCompletedDays")
+	defer cancel()
+
+	query := `
+  SELECT DISTINCT ON (program_day_id) program_day_id, id
+  FROM workouts
+  WHERE enrollment_id = $1 AND program_day_id IS NOT NULL
+  ORDER BY program_day_id, created_at
+  `
+	rows, err := pg.db.QueryContext(ctx, query, enrollmentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	completed := map[int]int{}
+	for rows.Next() {
+		var dayID, workoutID int
+		err = rows.Scan(&dayID, &workoutID)
+		if err != nil {
+			return nil, err
+		}
+		completed[dayID] = workoutID
+	}
+	return completed, rows.Err()
+}
+
+func (pg *PostgresProgramStore) loadProgramDays(ctx context.Context, programs []Program) error {
+	if len(programs) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, len(programs))
+	byID := make(map[int]*Program, len(programs))
+	for i := range programs {
+		ids[i] = int64(programs[i].ID)
+		byID[programs[i].ID] = &programs[i]
+		programs[i].Days = []ProgramDay{}
+	}
+
+	query := `
+  SELECT program_id, id, week_number, day_number, template_id, title
+  FROM program_days
+  WHERE program_id = ANY($1)
+  ORDER BY program_id, week_number, day_number
+  `
+	rows, err := pg.db.QueryContext(ctx, query, ids)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var programID int
+		var day ProgramDay
+		err = rows.Scan(&programID, &day.ID, &day.WeekNumber, &day.DayNumber, &day.TemplateID, &day.Title)
+		if err != nil {
+			return err
+		}
+		program := byID[programID]
+		program.Days = append(program.Days, day)
+	}
+	return rows.Err()
+}
+
+// resolveProgramDay checks that the workout's program day belongs to the
+// user's active enrollment and links the workout to that enrollment.
+func resolveProgramDay(ctx context.Context, tx *sql.Tx, workout *Workout) error {
+	workout.EnrollmentID = nil
+	if workout.ProgramDayID == nil {
+		return nil
+	}
+
+	query := `
+  SELECT pe.id
+  FROM program_days pd
+  INNER JOIN program_enrollments pe ON pe.program_id = pd.program_id
+  WHERE pd.id = $1 AND pe.user_id = $2 AND pe.active
+  `
+	var enrollmentID int
+	err := tx.QueryRowContext(ctx, query, *workout.ProgramDayID, workout.UserID).Scan(&enrollmentID)
+	if err == sql.ErrNoRows {
+		return ErrProgramDayNotFound
+	}
+	if err != nil {
+		return err
+	}
+	workout.EnrollmentID = &enrollmentID
+	return nil
+}
+
+// DayIndex returns how many days today (YYYY-MM-DD) is after the enrollment
+// start date; it is negative before the program starts.
+func (e *Enrollment) DayIndex(today string) (int, error) {
+	start, err := time.Parse(time.DateOnly, e.StartDate)
+	if err != nil {
+		return 0, err
+	}
+	day, err := time.Parse(time.DateOnly, today)
+	if err != nil {
+		return 0, err
+	}
+	return int(day.Sub(start).Hours() / 24), nil
+}
+
+// FindDay returns the program day scheduled for the given zero-based day index,
+// or nil for a rest day or an index outside the program.
+func (p *Program) FindDay(index int) *ProgramDay {
+	if index < 0 || index >= p.Weeks*7 {
+		return nil
+	}
+	week, day := index/7+1, index%7+1
+	for i := range p.Days {
+		if p.Days[i].WeekNumber == week && p.Days[i].DayNumber == day {
+			return &p.Days[i]
+		}
+	}
+	return nil
+}
+
+// BuildSchedule lays the program's days out on the calendar of enrollment and
+// reports adherence as of today (YYYY-MM-DD). completed maps program day IDs to
+// workout IDs as returned by GetCompletedDays. Without an enrollment the
+// sessions are returned undated.
+func BuildSchedule(program *Program, enrollment *Enrollment, completed map[int]int, today string) (*Schedule, error) {
+	schedule := &Schedule{
+		ProgramID:  program.ID,
+		Enrollment: enrollment,
+		Sessions:   make([]ScheduledSession, 0, len(program.Days)),
+	}
+	if enrollment == nil {
+		for _, day := range program.Days {
+			schedule.Sessions = append(schedule.Sessions, ScheduledSession{ProgramDay: day})
+		}
+		return schedule, nil
+	}
+
+	start, err := time.Parse(time.DateOnly, enrollment.StartDate)
+	if err != nil {
+		return nil, err
+	}
+	todayIndex, err := enrollment.DayIndex(today)
+	if err != nil {
+		return nil, err
+	}
+
+	adherence := &Adherence{}
+	for _, day := range program.Days {
+		index := (day.WeekNumber-1)*7 + day.DayNumber - 1
+		session := ScheduledSession{
+			ProgramDay: day,
+			Date:       start.AddDate(0, 0, index).Format(time.DateOnly),
+		}
+		if workoutID, ok := completed[day.ID]; ok {
+			session.WorkoutID = &workoutID
+		}
+
+		switch {
+		case session.WorkoutID != nil:
+			session.Status = SessionCompleted
+			adherence.Scheduled++
+			adherence.Completed++
+		case index < todayIndex:
+			session.Status = SessionMissed
+			adherence.Scheduled++
+		case index == todayIndex:
+			session.Status = SessionDue
+		default:
+			session.Status = SessionUpcoming
+		}
+		schedule.Sessions = append(schedule.Sessions, session)
+	}
+
+	if adherence.Scheduled > 0 {
+		adherence.Rate = float64(adherence.Completed) / float64(adherence.Scheduled)
+	}
+	schedule.Adherence = adherence
+	return schedule, nil
+}
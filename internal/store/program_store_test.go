@@ -0,0 +1,53 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildSchedule(t *testing.T) {
+	program := &Program{
+		ID:    1,
+		Weeks: 2,
+		Days: []ProgramDay{
+			{ID: 10, WeekNumber: 1, DayNumber: 1, Title: "Squat"},
+			{ID: 11, WeekNumber: 1, DayNumber: 3, Title: "Bench"},
+			{ID: 12, WeekNumber: 1, DayNumber: 5, Title: "Deadlift"},
+			{ID: 13, WeekNumber: 2, DayNumber: 1, Title: "Squat"},
+		},
+	}
+	enrollment := &Enrollment{ID: 3, ProgramID: 1, StartDate: "2025-03-03"}
+
+	schedule, err := BuildSchedule(program, enrollment, map[int]int{10: 42}, "2025-03-07")
+	require.NoError(t, err)
+	require.Len(t, schedule.Sessions, 4)
+
+	assert.Equal(t, "2025-03-03", schedule.Sessions[0].Date)
+	assert.Equal(t, SessionCompleted, schedule.Sessions[0].Status)
+	assert.Equal(t, 42, *schedule.Sessions[0].WorkoutID)
+	assert.Equal(t, SessionMissed, schedule.Sessions[1].Status)
+	assert.Equal(t, SessionDue, schedule.Sessions[2].Status)
+	assert.Equal(t, "2025-03-10", schedule.Sessions[3].Date)
+	assert.Equal(t, SessionUpcoming, schedule.Sessions[3].Status)
+
+	assert.Equal(t, 2, schedule.Adherence.Scheduled)
+	assert.Equal(t, 1, schedule.Adherence.Completed)
+	assert.InDelta(t, 0.5, schedule.Adherence.Rate, 0.001)
+}
+
+func TestProgramFindDay(t *testing.T) {
+	program := &Program{
+		Weeks: 1,
+		Days:  []ProgramDay{{ID: 1, WeekNumber: 1, DayNumber: 2}},
+	}
+	enrollment := &Enrollment{StartDate: "2025-03-03"}
+
+	index, err := enrollment.DayIndex("2025-03-04")
+	require.NoError(t, err)
+	assert.Equal(t, 1, program.FindDay(index).ID)
+	assert.Nil(t, program.FindDay(0))
+	assert.Nil(t, program.FindDay(-1))
+	assert.Nil(t, program.FindDay(8))
+}
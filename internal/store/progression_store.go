@@ -0,0 +1,199 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/dapoadedire/fem_project/internal/progression"
+)
+
+// ProgressionSetting is a user's progression config for one exercise, or their
+// default for every exercise when Exercise is empty.
+type ProgressionSetting struct {
+	Exercise string `json:"exercise"`
+	progression.Config
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type PostgresProgressionStore struct {
+	db       *sql.DB
+	timeouts QueryTimeouts
+}
+
+func NewPostgresProgressionStore(db *sql.DB, timeouts QueryTimeouts) *PostgresProgressionStore {
+	return &PostgresProgressionStore{db: db, timeouts: timeouts}
+}
+
+type ProgressionStore interface {
+	GetExerciseHistory(ctx context.Context, userID int, exercise string, limit int) ([]progression.Session, error)
+	GetProgressionConfig(ctx context.Context, userID int, exercise string) (progression.Config, error)
+	ListProgressionSettings(ctx context.Context, userID int) ([]ProgressionSetting, error)
+	UpsertProgressionSetting(ctx context.Context, userID int, setting *ProgressionSetting) error
+}
+
+func normalizeExerciseKey(exercise string) string {
+	return strings.ToLower(strings.TrimSpace(exercise))
+}
+
+// GetExerciseHistory returns the heaviest entry of the exercise from each of the
+// user's last limit workouts that included it, oldest first.
+func (s *PostgresProgressionStore) GetExerciseHistory(ctx context.Context, userID int, exercise string, limit int) ([]progression.Session, error) {
+	ctx, cancel := s.timeouts.withTimeout(ctx, "ProgressionStore.GetExerciseHistory")
+	defer cancel()
+
+	query := `
+  SELECT workout_id, created_at, sets, reps, weight, rpe, duration_seconds
+  FROM (
+    SELECT DISTINCT ON (w.id)
+      w.id AS workout_id, w.created_at, we.sets,
+      COALESCE(we.reps, 0) AS reps, COALESCE(we.weight, 0) AS weight, we.rpe,
+      COALESCE(we.duration_seconds, 0) AS duration_seconds
+    FROM workout_entries we
+    INNER JOIN workouts w ON w.id = we.workout_id
+    WHERE w.user_id = $1 AND lower(we.exercise_name) = $2
+    ORDER BY w.id, we.weight DESC NULLS LAST, we.reps DESC NULLS LAST
+  ) sessions
+  ORDER BY created_at DESC
+  LIMIT $3
+  `
+	rows, err := s.db.QueryContext(ctx, query, userID, normalizeExerciseKey(exercise), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	history := []progression.Session{}
+	for rows.Next() {
+		var session progression.Session
+		err = rows.Scan(
+			&session.WorkoutID,
+			&session.Date,
+			&session.Sets,
+			&session.Reps,
+			&session.Weight,
+			&session.RPE,
+			&session.DurationSeconds,
+		)
+		if err != nil {
+			return nil, err
+		}
+		history = append(history, session)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i, j := 0, len(history)-1; i < j; i, j = i+1, j-1 {
+		history[i], history[j] = history[j], history[i]
+	}
+	return history, nil
+}
+
+// GetProgressionConfig returns the user's config for the exercise, falling back
+// to their default config and then to progression.DefaultConfig.
+func (s *PostgresProgressionStore) GetProgressionConfig(ctx context.Context, userID int, exercise string) (progression.Config, error) {
+	ctx, cancel := s.timeouts.withTimeout(ctx, "ProgressionStore.GetProgressionConfig")
+	defer cancel()
+
+	query := `
+  SELECT rule, increment, target_reps, min_reps, max_reps, target_rpe, deload_after, deload_percent
+  FROM progression_settings
+  WHERE user_id = $1 AND exercise IN ($2, '')
+  ORDER BY exercise DESC
+  LIMIT 1
+  `
+	var cfg progression.Config
+	err := s.db.QueryRowContext(ctx, query, userID, normalizeExerciseKey(exercise)).Scan(
+		&cfg.Rule,
+		&cfg.Increment,
+		&cfg.TargetReps,
+		&cfg.MinReps,
+		&cfg.MaxReps,
+		&cfg.TargetRPE,
+		&cfg.DeloadAfter,
+		&cfg.DeloadPercent,
+	)
+	if err == sql.ErrNoRows {
+		return progression.DefaultConfig(), nil
+	}
+	if err != nil {
+		return progression.Config{}, err
+	}
+	return cfg, nil
+}
+
+func (s *PostgresProgressionStore) ListProgressionSettings(ctx context.Context, userID int) ([]ProgressionSetting, error) {
+	ctx, cancel := s.timeouts.withTimeout(ctx, "ProgressionStore.ListProgressionSettings")
+	defer cancel()
+
+	query := `
+  SELECT exercise, rule, increment, target_reps, min_reps, max_reps, target_rpe, deload_after, deload_percent, updated_at
+  FROM progression_settings
+  WHERE user_id = $1
+  ORDER BY exercise
+  `
+	rows, err := s.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	settings := []ProgressionSetting{}
+	for rows.Next() {
+		var setting ProgressionSetting
+		err = rows.Scan(
+			&setting.Exercise,
+			&setting.Rule,
+			&setting.Increment,
+			&setting.TargetReps,
+			&setting.MinReps,
+			&setting.MaxReps,
+			&setting.TargetRPE,
+			&setting.DeloadAfter,
+			&setting.DeloadPercent,
+			&setting.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		settings = append(settings, setting)
+	}
+	return settings, rows.Err()
+}
+
+func (s *PostgresProgressionStore) UpsertProgressionSetting(ctx context.Context, userID int, setting *ProgressionSetting) error {
+	ctx, cancel := s.timeouts.withTimeout(ctx, "ProgressionStore.UpsertProgressionSetting")
+	defer cancel()
+
+	setting.Exercise = normalizeExerciseKey(setting.Exercise)
+	query := `
+  INSERT INTO progression_settings (user_id, exercise, rule, increment, target_reps, min_reps, max_reps, target_rpe, deload_after, deload_percent)
+  VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+  ON CONFLICT (user_id, exercise)
+  DO UPDATE SET
+    rule = EXCLUDED.rule,
+    increment = EXCLUDED.increment,
+    target_reps = EXCLUDED.target_reps,
+    min_reps = EXCLUDED.min_reps,
+    max_reps = EXCLUDED.max_reps,
+    target_rpe = EXCLUDED.target_rpe,
+    deload_after = EXCLUDED.deload_after,
+    deload_percent = EXCLUDED.deload_percent,
+    updated_at = CURRENT_TIMESTAMP
+  RETURNING updated_at
+  `
+	return s.db.QueryRowContext(ctx, query,
+		userID,
+		setting.Exercise,
+		setting.Rule,
+		setting.Increment,
+		setting.TargetReps,
+		setting.MinReps,
+		setting.MaxReps,
+		setting.TargetRPE,
+		setting.DeloadAfter,
+		setting.DeloadPercent,
+	).Scan(&setting.UpdatedAt)
+}
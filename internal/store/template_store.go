@@ -0,0 +1,312 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+type WorkoutTemplate struct {
+	ID              int             `json:"id"`
+	UserID          int             `json:"user_id"`
+	Title           string          `json:"title"`
+	Description     string          `json:"description"`
+	DurationMinutes int             `json:"duration_minutes"`
+	CaloriesBurned  int             `json:"calories_burned"`
+	CreatedAt       time.Time       `json:"created_at"`
+	UpdatedAt       time.Time       `json:"updated_at"`
+	Entries         []TemplateEntry `json:"entries"`
+}
+
+// TemplateEntry is a planned WorkoutEntry; the two convert freely.
+type TemplateEntry WorkoutEntry
+
+// NewWorkout instantiates the template as a workout owned by userID, ready to
+// be passed to WorkoutStore.CreateWorkout. A template's rpe is the effort
+// planned, not the one felt, so it is left out for the user to log.
+func (t *WorkoutTemplate) NewWorkout(userID int) *Workout {
+	workout := &Workout{
+		UserID:          userID,
+		Title:           t.Title,
+		Description:     t.Description,
+		DurationMinutes: t.DurationMinutes,
+		CaloriesBurned:  t.CaloriesBurned,
+		Entries:         make([]WorkoutEntry, len(t.Entries)),
+	}
+	for i, entry := range t.Entries {
+		workout.Entries[i] = WorkoutEntry(entry)
+		workout.Entries[i].ID = 0
+		workout.Entries[i].RPE = nil
+	}
+	return workout
+}
+
+type PostgresTemplateStore struct {
+	db       *sql.DB
+	timeouts QueryTimeouts
+}
+
+func NewPostgresTemplateStore(db *sql.DB, timeouts QueryTimeouts) *PostgresTemplateStore {
+	return &PostgresTemplateStore{db: db, timeouts: timeouts}
+}
+
+type TemplateStore interface {
+	CreateTemplate(ctx context.Context, template *WorkoutTemplate) (*WorkoutTemplate, error)
+	GetTemplateByID(ctx context.Context, id int64) (*WorkoutTemplate, error)
+	ListTemplates(ctx context.Context, userID int) ([]WorkoutTemplate, error)
+	UpdateTemplate(ctx context.Context, template *WorkoutTemplate) error
+	DeleteTemplate(ctx context.Context, id int64) error
+}
+
+func (pg *PostgresTemplateStore) CreateTemplate(ctx context.Context, template *WorkoutTemplate) (*WorkoutTemplate, error) {
+	ctx, cancel := pg.timeouts.withTimeout(ctx, "TemplateStore.CreateTemplate")
+	defer cancel()
+
+	tx, err := pg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+  INSERT INTO workout_templates (user_id, title, description, duration_minutes, calories_burned)
+  VALUES ($1, $2, $3, $4, $5)
+  RETURNING id, created_at, updated_at
+  `
+	err = tx.QueryRowContext(ctx, query, template.UserID, template.Title, template.Description, template.DurationMinutes, template.CaloriesBurned).
+		Scan(&template.ID, &template.CreatedAt, &template.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	err = insertTemplateEntries(ctx, tx, template)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return template, nil
+}
+
+func (pg *PostgresTemplateStore) GetTemplateByID(ctx context.Context, id int64) (*WorkoutTemplate, error) {
+	ctx, cancel := pg.timeouts.withTimeout(ctx, "TemplateStore.GetTemplateByID")
+	defer cancel()
+
+	template := &WorkoutTemplate{}
+	query := `
+  SELECT id, user_id, title, description, duration_minutes, calories_burned, created_at, updated_at
+  FROM workout_templates
+  WHERE id = $1
+  `
+	err := pg.db.QueryRowContext(ctx, query, id).Scan(
+		&template.ID,
+		&template.UserID,
+		&template.Title,
+		&template.Description,
+		&template.DurationMinutes,
+		&template.CaloriesBurned,
+		&template.CreatedAt,
+		&template.UpdatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	templates := []WorkoutTemplate{*template}
+	err = pg.loadTemplateEntries(ctx, templates)
+	if err != nil {
+		return nil, err
+	}
+	return &templates[0], nil
+}
+
+func (pg *PostgresTemplateStore) ListTemplates(ctx context.Context, userID int) ([]WorkoutTemplate, error) {
+	ctx, cancel := pg.timeouts.withTimeout(ctx, "TemplateStore.ListTemplates")
+	defer cancel()
+
+	query := `
+  SELECT id, user_id, title, description, duration_minutes, calories_burned, created_at, updated_at
+  FROM workout_templates
+  WHERE user_id = $1
+  ORDER BY title, id
+  `
+	rows, err := pg.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	templates := []WorkoutTemplate{}
+	for rows.Next() {
+		var template WorkoutTemplate
+		err = rows.Scan(
+			&template.ID,
+			&template.UserID,
+			&template.Title,
+			&template.Description,
+			&template.DurationMinutes,
+			&template.CaloriesBurned,
+			&template.CreatedAt,
+			&template.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		templates = append(templates, template)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	err = pg.loadTemplateEntries(ctx, templates)
+	if err != nil {
+		return nil, err
+	}
+	return templates, nil
+}
+
+func (pg *PostgresTemplateStore) UpdateTemplate(ctx context.Context, template *WorkoutTemplate) error {
+	ctx, cancel := pg.timeouts.withTimeout(ctx, "TemplateStore.UpdateTemplate")
+	defer cancel()
+
+	tx, err := pg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+  UPDATE workout_templates
+  SET title = $1, description = $2, duration_minutes = $3, calories_burned = $4, updated_at = CURRENT_TIMESTAMP
+  WHERE id = $5
+  RETURNING updated_at
+  `
+	err = tx.QueryRowContext(ctx, query, template.Title, template.Description, template.DurationMinutes, template.CaloriesBurned, template.ID).
+		Scan(&template.UpdatedAt)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM workout_template_entries WHERE template_id = $1`, template.ID)
+	if err != nil {
+		return err
+	}
+
+	err = insertTemplateEntries(ctx, tx, template)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (pg *PostgresTemplateStore) DeleteTemplate(ctx context.Context, id int64) error {
+	ctx, cancel := pg.timeouts.withTimeout(ctx, "TemplateStore.DeleteTemplate")
+	defer cancel()
+
+	result, err := pg.db.ExecContext(ctx, `DELETE FROM workout_templates WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// insertTemplateEntries links each entry to the exercise catalog the same way
+// workout entries are and inserts it, filling in the generated IDs.
+func insertTemplateEntries(ctx context.Context, tx *sql.Tx, template *WorkoutTemplate) error {
+	query := `
+  INSERT INTO workout_template_entries (template_id, exercise_id, exercise_name, sets, reps, duration_seconds, weight, rpe, notes, order_index)
+  VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+  RETURNING id
+  `
+	for i := range template.Entries {
+		entry := &template.Entries[i]
+		err := resolveEntryExercise(ctx, tx, template.UserID, (*WorkoutEntry)(entry))
+		if err != nil {
+			return fmt.Errorf("entry %d: %w", i, err)
+		}
+
+		err = tx.QueryRowContext(ctx, query,
+			template.ID,
+			entry.ExerciseID,
+			entry.ExerciseName,
+			entry.Sets,
+			entry.Reps,
+			entry.DurationSeconds,
+			entry.Weight,
+			entry.RPE,
+			entry.Notes,
+			entry.OrderIndex,
+		).Scan(&entry.ID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadTemplateEntries fetches the entries of all the given templates in a single query.
+func (pg *PostgresTemplateStore) loadTemplateEntries(ctx context.Context, templates []WorkoutTemplate) error {
+	if len(templates) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, len(templates))
+	byID := make(map[int]*WorkoutTemplate, len(templates))
+	for i := range templates {
+		ids[i] = int64(templates[i].ID)
+		byID[templates[i].ID] = &templates[i]
+		templates[i].Entries = []TemplateEntry{}
+	}
+
+	query := `
+  SELECT template_id, id, exercise_id, exercise_name, sets, reps, duration_seconds, weight, rpe, notes, order_index
+  FROM workout_template_entries
+  WHERE template_id = ANY($1)
+  ORDER BY template_id, order_index
+  `
+	rows, err := pg.db.QueryContext(ctx, query, ids)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var templateID int
+		var entry TemplateEntry
+		err = rows.Scan(
+			&templateID,
+			&entry.ID,
+			&entry.ExerciseID,
+			&entry.ExerciseName,
+			&entry.Sets,
+			&entry.Reps,
+			&entry.DurationSeconds,
+			&entry.Weight,
+			&entry.RPE,
+			&entry.Notes,
+			&entry.OrderIndex,
+		)
+		if err != nil {
+			return err
+		}
+		template := byID[templateID]
+		template.Entries = append(template.Entries, entry)
+	}
+	return rows.Err()
+}
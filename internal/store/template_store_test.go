@@ -0,0 +1,48 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTemplateNewWorkout(t *testing.T) {
+	template := &WorkoutTemplate{
+		ID:              7,
+		UserID:          1,
+		Title:           "Leg Day",
+		Description:     "Heavy",
+		DurationMinutes: 60,
+		CaloriesBurned:  400,
+		Entries: []TemplateEntry{
+			{ID: 11, ExerciseName: "Squat", Sets: 5, Reps: IntPtr(5), Weight: FloatPtr(100), RPE: FloatPtr(8), OrderIndex: 1},
+			{ID: 12, ExerciseName: "Plank", Sets: 3, DurationSeconds: IntPtr(60), OrderIndex: 2},
+		},
+	}
+
+	workout := template.NewWorkout(2)
+	assert.Equal(t, 2, workout.UserID)
+	assert.Zero(t, workout.ID)
+	assert.Equal(t, "Leg Day", workout.Title)
+	assert.Equal(t, "Heavy", workout.Description)
+	assert.Equal(t, 60, workout.DurationMinutes)
+	assert.Equal(t, 400, workout.CaloriesBurned)
+	require.Len(t, workout.Entries, 2)
+	for i, entry := range workout.Entries {
+		// entries are inserted anew, so they must not keep the template's IDs
+		assert.Zero(t, entry.ID)
+		assert.Equal(t, template.Entries[i].ExerciseName, entry.ExerciseName)
+		assert.Equal(t, template.Entries[i].OrderIndex, entry.OrderIndex)
+	}
+	assert.Equal(t, 5, *workout.Entries[0].Reps)
+	assert.Nil(t, workout.Entries[1].Reps)
+	// the planned rpe is not what the user felt
+	assert.Nil(t, workout.Entries[0].RPE)
+	assert.Equal(t, 8.0, *template.Entries[0].RPE)
+
+	// the template itself is left alone
+	workout.Entries[0].Sets = 1
+	assert.Equal(t, 5, template.Entries[0].Sets)
+	assert.Equal(t, 11, template.Entries[0].ID)
+}
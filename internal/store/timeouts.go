@@ -0,0 +1,27 @@
+package store
+
+import (
+	"context"
+	"time"
+)
+
+// QueryTimeouts bounds how long a store operation may spend on its queries.
+// Operations overrides Default for the operations it names, such as
+// "WorkoutStore.ImportWorkouts". Zero means no timeout.
+type QueryTimeouts struct {
+	Default    time.Duration
+	Operations map[string]time.Duration
+}
+
+// withTimeout returns the context the queries of op run under. The timeout
+// only ever shortens the deadline ctx already has.
+func (t QueryTimeouts) withTimeout(ctx context.Context, op string) (context.Context, context.CancelFunc) {
+	timeout, ok := t.Operations[op]
+	if !ok {
+		timeout = t.Default
+	}
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
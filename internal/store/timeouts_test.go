@@ -0,0 +1,41 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueryTimeouts(t *testing.T) {
+	timeouts := QueryTimeouts{
+		Default:    time.Second,
+		Operations: map[string]time.Duration{"WorkoutStore.StreamWorkouts": 0, "WorkoutStore.ImportWorkouts": time.Minute},
+	}
+
+	ctx, cancel := timeouts.withTimeout(context.Background(), "WorkoutStore.CreateWorkout")
+	defer cancel()
+	deadline, ok := ctx.Deadline()
+	assert.True(t, ok)
+	assert.WithinDuration(t, time.Now().Add(time.Second), deadline, 100*time.Millisecond)
+
+	ctx, cancel = timeouts.withTimeout(context.Background(), "WorkoutStore.ImportWorkouts")
+	defer cancel()
+	deadline, ok = ctx.Deadline()
+	assert.True(t, ok)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), deadline, 100*time.Millisecond)
+
+	ctx, cancel = timeouts.withTimeout(context.Background(), "WorkoutStore.StreamWorkouts")
+	defer cancel()
+	_, ok = ctx.Deadline()
+	assert.False(t, ok)
+
+	parent, cancelParent := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancelParent()
+	ctx, cancel = timeouts.withTimeout(parent, "WorkoutStore.CreateWorkout")
+	defer cancel()
+	deadline, _ = ctx.Deadline()
+	parentDeadline, _ := parent.Deadline()
+	assert.Equal(t, parentDeadline, deadline)
+}
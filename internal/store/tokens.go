@@ -1,49 +1,270 @@
 package store
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"time"
 
 	"github.com/dapoadedire/fem_project/internal/tokens"
 )
 
+// ErrRefreshTokenReused is returned for a refresh token that was already
+// exchanged. Its whole family has been revoked by then, since either the
+// legitimate client or whoever stole the token is now holding a stale copy.
+var ErrRefreshTokenReused = errors.New("refresh token reused")
+
 type PostgresTokenStore struct {
-	db *sql.DB
+	db       *sql.DB
+	timeouts QueryTimeouts
 }
 
-func NewPostgresTokenStore(db *sql.DB) *PostgresTokenStore {
-	return &PostgresTokenStore{db: db}
+func NewPostgresTokenStore(db *sql.DB, timeouts QueryTimeouts) *PostgresTokenStore {
+	return &PostgresTokenStore{db: db, timeouts: timeouts}
 }
 
 type TokenStore interface {
-	Insert(token *tokens.Token) error
-	CreateNewToken(userID int, ttl time.Duration, scope string) (*tokens.Token, error)
-	DeleteAllTokensForUser(userID int, scope string) error
+	Insert(ctx context.Context, token *tokens.Token) error
+	InsertFamily(ctx context.Context, access, refresh *tokens.Token) error
+	RotateRefreshToken(ctx context.Context, hash []byte, access, refresh *tokens.Token) error
+	CreateNewToken(ctx context.Context, userID int, ttl time.Duration, scope string) (*tokens.Token, error)
+	ListTokensForUser(ctx context.Context, userID int, scope string) ([]*tokens.Token, error)
+	DeleteToken(ctx context.Context, hash []byte) error
+	DeleteAllTokensForUser(ctx context.Context, userID int, scope string) error
 }
 
-func (t *PostgresTokenStore) CreateNewToken(userID int, ttl time.Duration, scope string) (*tokens.Token, error) {
+func (t *PostgresTokenStore) CreateNewToken(ctx context.Context, userID int, ttl time.Duration, scope string) (*tokens.Token, error) {
+	ctx, cancel := t.timeouts.withTimeout(ctx, "TokenStore.CreateNewToken")
+	defer cancel()
+
 	token, err := tokens.GenerateToken(userID, ttl, scope)
 	if err != nil {
 		return nil, err
 	}
-	err = t.Insert(token)
+	err = t.Insert(ctx, token)
 	return token, err
 }
 
-func (t *PostgresTokenStore) Insert(token *tokens.Token) error {
+func (t *PostgresTokenStore) Insert(ctx context.Context, token *tokens.Token) error {
+	ctx, cancel := t.timeouts.withTimeout(ctx, "TokenStore.Insert")
+	defer cancel()
+
 	query := `
-		INSERT INTO tokens(hash, user_id, expiry, scope)
-		VALUES ($1, $2, $3, $4)
+		INSERT INTO tokens(hash, user_id, expiry, scope, user_agent, ip, family_id)
+		VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7::BIGINT, 0))
+		RETURNING id, created_at
 	`
-	_, err := t.db.Exec(query, token.Hash, token.UserID, token.Expiry, token.Scope)
+	_, span := startSpan(ctx, "INSERT tokens", query)
+	err := t.db.QueryRowContext(ctx, query, token.Hash, token.UserID, token.Expiry, token.Scope, token.UserAgent, token.IP, token.FamilyID).
+		Scan(&token.ID, &token.CreatedAt)
+	endSpan(span, err)
 	return err
 }
 
-func (t *PostgresTokenStore) DeleteAllTokensForUser(userID int, scope string) error {
+// InsertFamily stores an access and a refresh token issued at login as the
+// first pair of a new token family.
+func (t *PostgresTokenStore) InsertFamily(ctx context.Context, access, refresh *tokens.Token) error {
+	ctx, cancel := t.timeouts.withTimeout(ctx, "TokenStore.InsertFamily")
+	defer cancel()
+
+	tx, err := t.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var familyID int64
+	query := `SELECT nextval('token_families_seq')`
+	_, span := startSpan(ctx, "SELECT token_families_seq", query)
+	err = tx.QueryRowContext(ctx, query).Scan(&familyID)
+	endSpan(span, err)
+	if err != nil {
+		return err
+	}
+
+	for _, token := range []*tokens.Token{access, refresh} {
+		token.FamilyID = familyID
+		err = insertToken(ctx, tx, token)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// RotateRefreshToken exchanges the unexpired refresh token with the given
+// hash for access and refresh, which join its family and are filled in with
+// its owner. The old refresh token is kept, marked used, until it expires so
+// that a second exchange can be told apart from an unknown token: that
+// revokes the whole family and returns ErrRefreshTokenReused. An unknown or
+// expired token gives sql.ErrNoRows.
+func (t *PostgresTokenStore) RotateRefreshToken(ctx context.Context, hash []byte, access, refresh *tokens.Token) error {
+	ctx, cancel := t.timeouts.withTimeout(ctx, "TokenStore.RotateRefreshToken")
+	defer cancel()
+
+	tx, err := t.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var (
+		userID   int
+		familyID int64
+		usedAt   *time.Time
+	)
+	// the row lock makes concurrent exchanges of the same token queue up, so
+	// only the first one wins and the rest count as reuse
+	query := `
+		SELECT user_id, family_id, used_at
+		FROM tokens
+		WHERE hash = $1 AND scope = $2 AND expiry > CURRENT_TIMESTAMP
+		FOR UPDATE
+	`
+	_, span := startSpan(ctx, "SELECT tokens", query)
+	err = tx.QueryRowContext(ctx, query, hash, tokens.ScopeRefresh).Scan(&userID, &familyID, &usedAt)
+	endSpan(span, err)
+	if err != nil {
+		return err
+	}
+
+	if usedAt != nil {
+		query = `DELETE FROM tokens WHERE family_id = $1`
+		_, span = startSpan(ctx, "DELETE tokens", query)
+		_, err = tx.ExecContext(ctx, query, familyID)
+		endSpan(span, err)
+		if err != nil {
+			return err
+		}
+		err = tx.Commit()
+		if err != nil {
+			return err
+		}
+		return ErrRefreshTokenReused
+	}
+
+	query = `UPDATE tokens SET used_at = CURRENT_TIMESTAMP, last_used_at = CURRENT_TIMESTAMP WHERE hash = $1`
+	_, span = startSpan(ctx, "UPDATE tokens", query)
+	_, err = tx.ExecContext(ctx, query, hash)
+	endSpan(span, err)
+	if err != nil {
+		return err
+	}
+
+	// the access token being replaced goes, so a family stays one session
+	query = `DELETE FROM tokens WHERE family_id = $1 AND scope = $2`
+	_, span = startSpan(ctx, "DELETE tokens", query)
+	_, err = tx.ExecContext(ctx, query, familyID, tokens.ScopeAuth)
+	endSpan(span, err)
+	if err != nil {
+		return err
+	}
+
+	for _, token := range []*tokens.Token{access, refresh} {
+		token.UserID = userID
+		token.FamilyID = familyID
+		err = insertToken(ctx, tx, token)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func insertToken(ctx context.Context, tx *sql.Tx, token *tokens.Token) error {
+	query := `
+		INSERT INTO tokens(hash, user_id, expiry, scope, user_agent, ip, family_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at
+	`
+	_, span := startSpan(ctx, "INSERT tokens", query)
+	err := tx.QueryRowContext(ctx, query, token.Hash, token.UserID, token.Expiry, token.Scope, token.UserAgent, token.IP, token.FamilyID).
+		Scan(&token.ID, &token.CreatedAt)
+	endSpan(span, err)
+	return err
+}
+
+// ListTokensForUser returns the user's unexpired tokens of scope, most
+// recently used first.
+func (t *PostgresTokenStore) ListTokensForUser(ctx context.Context, userID int, scope string) ([]*tokens.Token, error) {
+	ctx, cancel := t.timeouts.withTimeout(ctx, "TokenStore.ListTokensForUser")
+	defer cancel()
+
+	query := `
+		SELECT id, hash, user_id, expiry, scope, created_at, last_used_at, user_agent, ip
+		FROM tokens
+		WHERE user_id = $1 AND scope = $2 AND expiry > CURRENT_TIMESTAMP
+		ORDER BY COALESCE(last_used_at, created_at) DESC, id DESC
+	`
+	_, span := startSpan(ctx, "SELECT tokens", query)
+	rows, err := t.db.QueryContext(ctx, query, userID, scope)
+	endSpan(span, err)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []*tokens.Token{}
+	for rows.Next() {
+		var expiry time.Time
+		token := &tokens.Token{}
+		err = rows.Scan(
+			&token.ID,
+			&token.Hash,
+			&token.UserID,
+			&expiry,
+			&token.Scope,
+			&token.CreatedAt,
+			&token.LastUsedAt,
+			&token.UserAgent,
+			&token.IP,
+		)
+		if err != nil {
+			return nil, err
+		}
+		token.Expiry = expiry.Format(time.RFC3339)
+		list = append(list, token)
+	}
+	return list, rows.Err()
+}
+
+// DeleteToken revokes the token with the given hash along with the rest of
+// its family, so a logout cannot be undone with the refresh token. It
+// returns sql.ErrNoRows if there is no such token.
+func (t *PostgresTokenStore) DeleteToken(ctx context.Context, hash []byte) error {
+	ctx, cancel := t.timeouts.withTimeout(ctx, "TokenStore.DeleteToken")
+	defer cancel()
+
+	query := `
+		DELETE FROM tokens
+		WHERE hash = $1 OR family_id = (SELECT family_id FROM tokens WHERE hash = $1)
+	`
+	_, span := startSpan(ctx, "DELETE tokens", query)
+	result, err := t.db.ExecContext(ctx, query, hash)
+	endSpan(span, err)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (t *PostgresTokenStore) DeleteAllTokensForUser(ctx context.Context, userID int, scope string) error {
+	ctx, cancel := t.timeouts.withTimeout(ctx, "TokenStore.DeleteAllTokensForUser")
+	defer cancel()
+
 	query := `
 	DELETE FROM tokens 
 	where scope = $1 AND user_id =$2
 	`
-	_, err := t.db.Exec(query, scope, userID)
+	_, span := startSpan(ctx, "DELETE tokens", query)
+	_, err := t.db.ExecContext(ctx, query, scope, userID)
+	endSpan(span, err)
 	return err
 }
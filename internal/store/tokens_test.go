@@ -0,0 +1,112 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/dapoadedire/fem_project/internal/tokens"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTokenPair generates an access and a refresh token for userID.
+func newTokenPair(t *testing.T, userID int) (*tokens.Token, *tokens.Token) {
+	t.Helper()
+	access, err := tokens.GenerateToken(userID, time.Hour, tokens.ScopeAuth)
+	require.NoError(t, err)
+	refresh, err := tokens.GenerateToken(userID, 24*time.Hour, tokens.ScopeRefresh)
+	require.NoError(t, err)
+	return access, refresh
+}
+
+func TestRotateRefreshToken(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	store := NewPostgresTokenStore(db, QueryTimeouts{})
+	user := createTestUser(t, db, "refresh_token_user")
+	ctx := context.Background()
+
+	countScope := func(scope string) int {
+		t.Helper()
+		list, err := store.ListTokensForUser(ctx, user.ID, scope)
+		require.NoError(t, err)
+		return len(list)
+	}
+
+	access, refresh := newTokenPair(t, user.ID)
+	require.NoError(t, store.InsertFamily(ctx, access, refresh))
+	require.NotZero(t, access.FamilyID)
+	used := refresh
+	assert.Equal(t, access.FamilyID, refresh.FamilyID)
+
+	t.Run("rotation replaces the pair within the family", func(t *testing.T) {
+		newAccess, newRefresh := newTokenPair(t, 0)
+		require.NoError(t, store.RotateRefreshToken(ctx, refresh.Hash, newAccess, newRefresh))
+		assert.Equal(t, user.ID, newAccess.UserID)
+		assert.Equal(t, user.ID, newRefresh.UserID)
+		assert.Equal(t, refresh.FamilyID, newAccess.FamilyID)
+		assert.Equal(t, refresh.FamilyID, newRefresh.FamilyID)
+
+		// the old access token is gone, the used refresh token is kept
+		assert.Equal(t, 1, countScope(tokens.ScopeAuth))
+		assert.Equal(t, 2, countScope(tokens.ScopeRefresh))
+		refresh = newRefresh
+	})
+
+	t.Run("reuse revokes the whole family", func(t *testing.T) {
+		newAccess, newRefresh := newTokenPair(t, 0)
+		err := store.RotateRefreshToken(ctx, used.Hash, newAccess, newRefresh)
+		assert.ErrorIs(t, err, ErrRefreshTokenReused)
+		assert.Zero(t, countScope(tokens.ScopeAuth))
+		assert.Zero(t, countScope(tokens.ScopeRefresh))
+
+		// the latest refresh token went with its family
+		err = store.RotateRefreshToken(ctx, refresh.Hash, newAccess, newRefresh)
+		assert.ErrorIs(t, err, sql.ErrNoRows)
+	})
+
+	t.Run("an unknown token is not found", func(t *testing.T) {
+		unknown, _ := newTokenPair(t, user.ID)
+		newAccess, newRefresh := newTokenPair(t, 0)
+		err := store.RotateRefreshToken(ctx, unknown.Hash, newAccess, newRefresh)
+		assert.ErrorIs(t, err, sql.ErrNoRows)
+	})
+
+	t.Run("an access token cannot be exchanged", func(t *testing.T) {
+		access, refresh := newTokenPair(t, user.ID)
+		require.NoError(t, store.InsertFamily(ctx, access, refresh))
+		newAccess, newRefresh := newTokenPair(t, 0)
+		err := store.RotateRefreshToken(ctx, access.Hash, newAccess, newRefresh)
+		assert.ErrorIs(t, err, sql.ErrNoRows)
+	})
+}
+
+func TestDeleteTokenRevokesFamily(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	store := NewPostgresTokenStore(db, QueryTimeouts{})
+	user := createTestUser(t, db, "logout_user")
+	ctx := context.Background()
+
+	access, refresh := newTokenPair(t, user.ID)
+	require.NoError(t, store.InsertFamily(ctx, access, refresh))
+	otherAccess, otherRefresh := newTokenPair(t, user.ID)
+	require.NoError(t, store.InsertFamily(ctx, otherAccess, otherRefresh))
+
+	require.NoError(t, store.DeleteToken(ctx, access.Hash))
+
+	// logging out also spends the refresh token, other sessions stay
+	newAccess, newRefresh := newTokenPair(t, 0)
+	err := store.RotateRefreshToken(ctx, refresh.Hash, newAccess, newRefresh)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+	list, err := store.ListTokensForUser(ctx, user.ID, tokens.ScopeAuth)
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	assert.Equal(t, otherAccess.ID, list[0].ID)
+
+	assert.ErrorIs(t, store.DeleteToken(ctx, access.Hash), sql.ErrNoRows)
+}
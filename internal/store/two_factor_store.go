@@ -0,0 +1,186 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var ErrTwoFactorEnabled = errors.New("two-factor authentication is already enabled")
+
+// TOTP is a user's authenticator secret. Secret is encrypted; EnabledAt is nil
+// until enrollment has been confirmed with a first code. LastStep is the time
+// step of the last code accepted, which cannot be used again.
+type TOTP struct {
+	UserID    int
+	Secret    []byte
+	EnabledAt *time.Time
+	LastStep  int64
+}
+
+func (t *TOTP) Enabled() bool {
+	return t != nil && t.EnabledAt != nil
+}
+
+type PostgresTwoFactorStore struct {
+	db       *sql.DB
+	timeouts QueryTimeouts
+}
+
+func NewPostgresTwoFactorStore(db *sql.DB, timeouts QueryTimeouts) *PostgresTwoFactorStore {
+	return &PostgresTwoFactorStore{db: db, timeouts: timeouts}
+}
+
+type TwoFactorStore interface {
+	// GetTOTP returns the user's secret, or nil if they never enrolled.
+	GetTOTP(ctx context.Context, userID int) (*TOTP, error)
+	// SaveTOTPSecret starts an enrollment, replacing any unconfirmed one. It
+	// returns ErrTwoFactorEnabled if 2FA is already on.
+	SaveTOTPSecret(ctx context.Context, userID int, secret []byte) error
+	// EnableTOTP confirms the enrollment with the step of its first code and
+	// replaces the user's recovery codes.
+	EnableTOTP(ctx context.Context, userID int, step int64, recoveryCodeHashes [][]byte) error
+	// UseTOTPStep accepts a code of the given step, reporting false if that
+	// step or a later one was already used.
+	UseTOTPStep(ctx context.Context, userID int, step int64) (bool, error)
+	// UseRecoveryCode consumes a recovery code, reporting false if the user
+	// has no such code.
+	UseRecoveryCode(ctx context.Context, userID int, hash []byte) (bool, error)
+	DisableTOTP(ctx context.Context, userID int) error
+}
+
+func (s *PostgresTwoFactorStore) GetTOTP(ctx context.Context, userID int) (*TOTP, error) {
+	ctx, cancel := s.timeouts.withTimeout(ctx, "TwoFactorStore.GetTOTP")
+	defer cancel()
+
+	totp := &TOTP{}
+	query := `SELECT user_id, secret, enabled_at, last_step FROM user_totp WHERE user_id = $1`
+	err := s.db.QueryRowContext(ctx, query, userID).Scan(&totp.UserID, &totp.Secret, &totp.EnabledAt, &totp.LastStep)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return totp, nil
+}
+
+func (s *PostgresTwoFactorStore) SaveTOTPSecret(ctx context.Context, userID int, secret []byte) error {
+	ctx, cancel := s.timeouts.withTimeout(ctx, "TwoFactorStore.SaveTOTPSecret")
+	defer cancel()
+
+	query := `
+  INSERT INTO user_totp AS t (user_id, secret)
+  VALUES ($1, $2)
+  ON CONFLICT (user_id) DO UPDATE SET
+    secret = EXCLUDED.secret,
+    last_step = 0,
+    created_at = CURRENT_TIMESTAMP
+  WHERE t.enabled_at IS NULL
+  `
+	result, err := s.db.ExecContext(ctx, query, userID, secret)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrTwoFactorEnabled
+	}
+	return nil
+}
+
+func (s *PostgresTwoFactorStore) EnableTOTP(ctx context.Context, userID int, step int64, recoveryCodeHashes [][]byte) error {
+	ctx, cancel := s.timeouts.withTimeout(ctx, "TwoFactorStore.EnableTOTP")
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+  UPDATE user_totp SET enabled_at = CURRENT_TIMESTAMP, last_step = $2
+  WHERE user_id = $1 AND enabled_at IS NULL
+  `
+	result, err := tx.ExecContext(ctx, query, userID, step)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrTwoFactorEnabled
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM recovery_codes WHERE user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+	for _, hash := range recoveryCodeHashes {
+		_, err = tx.ExecContext(ctx, `INSERT INTO recovery_codes (user_id, hash) VALUES ($1, $2)`, userID, hash)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *PostgresTwoFactorStore) UseTOTPStep(ctx context.Context, userID int, step int64) (bool, error) {
+	ctx, cancel := s.timeouts.withTimeout(ctx, "TwoFactorStore.UseTOTPStep")
+	defer cancel()
+
+	query := `UPDATE user_totp SET last_step = $2 WHERE user_id = $1 AND last_step < $2`
+	result, err := s.db.ExecContext(ctx, query, userID, step)
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected == 1, nil
+}
+
+func (s *PostgresTwoFactorStore) UseRecoveryCode(ctx context.Context, userID int, hash []byte) (bool, error) {
+	ctx, cancel := s.timeouts.withTimeout(ctx, "TwoFactorStore.UseRecoveryCode")
+	defer cancel()
+
+	result, err := s.db.ExecContext(ctx, `DELETE FROM recovery_codes WHERE user_id = $1 AND hash = $2`, userID, hash)
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected == 1, nil
+}
+
+// DisableTOTP turns 2FA off, dropping the secret and the recovery codes.
+func (s *PostgresTwoFactorStore) DisableTOTP(ctx context.Context, userID int) error {
+	ctx, cancel := s.timeouts.withTimeout(ctx, "TwoFactorStore.DisableTOTP")
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM recovery_codes WHERE user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `DELETE FROM user_totp WHERE user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -1,21 +1,32 @@
 package store
 
 import (
-	"crypto/sha256"
+	"context"
 	"database/sql"
 	"errors"
 	"time"
 
+	"github.com/dapoadedire/fem_project/internal/tokens"
+	"github.com/jackc/pgconn"
 	"golang.org/x/crypto/bcrypt"
 )
 
+var (
+	ErrDuplicateUsername = errors.New("a user with this username already exists")
+	ErrDuplicateEmail    = errors.New("a user with this email already exists")
+)
+
 type password struct {
 	plainText *string
 	hash      []byte
 }
 
 func (password *password) SetPassword(plaintextPassword string) error {
-	hash, err := bcrypt.GenerateFromPassword([]byte(plaintextPassword), bcrypt.DefaultCost)
+	return password.SetPasswordWithCost(plaintextPassword, bcrypt.DefaultCost)
+}
+
+func (password *password) SetPasswordWithCost(plaintextPassword string, cost int) error {
+	hash, err := bcrypt.GenerateFromPassword([]byte(plaintextPassword), cost)
 	if err != nil {
 		return err
 	}
@@ -42,15 +53,16 @@ type User struct {
 	ID             int       `json:"id"`
 	Username       string    `json:"username"`
 	Email          string    `json:"email"`
-	PasswordHash   password  `json:"password_hash"`
+	PasswordHash   password  `json:"-"`
 	Bio            string    `json:"bio"`
 	FirstName      string    `json:"first_name"`
 	LastName       string    `json:"last_name"`
 	ProfilePicture string    `json:"profile_picture"`
+	Activated      bool      `json:"activated"`
 	LastLogin      *string    `json:"last_login"`
 	CreatedAt      string    `json:"created_at"`
 	UpdatedAt      string    `json:"updated_at"`
-	Workouts       []Workout `json:"workouts"`
+	Workouts       []Workout `json:"workouts,omitempty"`
 }
 
 var AnonymousUser = &User{} // EVERYONE WHOS NOT LOGGED IN
@@ -59,45 +71,82 @@ func (u *User) IsAnonymous() bool {
 }
 
 type PostgresUserStore struct {
-	db *sql.DB
+	db       *sql.DB
+	timeouts QueryTimeouts
 }
 
-func NewPostgresUserStore(db *sql.DB) *PostgresUserStore {
-	return &PostgresUserStore{db: db}
+func NewPostgresUserStore(db *sql.DB, timeouts QueryTimeouts) *PostgresUserStore {
+	return &PostgresUserStore{db: db, timeouts: timeouts}
 }
 
 type UserStore interface {
-	CreateUser(*User) ( error)
-	GetUserByUsername(username string) (*User, error)
-	UpdateUser(*User) error
-	GetUserToken(scope, tokenPlainText string) (*User, error)
-	// DeleteUser(id int64) error
-	// GetUserByEmail(email string) (*User, error)
+	CreateUser(ctx context.Context, user *User) ( error)
+	GetUserByUsername(ctx context.Context, username string) (*User, error)
+	UpdateUser(ctx context.Context, user *User) error
+	GetUserToken(ctx context.Context, scope, tokenPlainText string) (*User, error)
+	GetUserByEmail(ctx context.Context, email string) (*User, error)
+	DeleteUser(ctx context.Context, id int) error
 }
 
-func (s *PostgresUserStore) CreateUser(user *User) error {
+func (s *PostgresUserStore) CreateUser(ctx context.Context, user *User) error {
+	ctx, cancel := s.timeouts.withTimeout(ctx, "UserStore.CreateUser")
+	defer cancel()
+
 	query := `INSERT INTO users(username, email, password_hash, bio, first_name, last_name, profile_picture)
 	VALUES($1,$2,$3,$4,$5,$6,$7)
-	RETURNING id, created_at, updated_at
+	RETURNING id, created_at, updated_at, activated
 	`
-	err := s.db.QueryRow(query, user.Username, user.Email, user.PasswordHash.hash, user.Bio, user.FirstName, user.LastName, user.ProfilePicture).Scan(&user.ID, &user.CreatedAt, &user.UpdatedAt)
+	_, span := startSpan(ctx, "INSERT users", query)
+	err := s.db.QueryRowContext(ctx, query, user.Username, user.Email, user.PasswordHash.hash, user.Bio, user.FirstName, user.LastName, user.ProfilePicture).Scan(&user.ID, &user.CreatedAt, &user.UpdatedAt, &user.Activated)
+	endSpan(span, err)
 
 	if err != nil {
-		return err
+		return duplicateUserError(err)
 	}
 	return nil
 }
 
-func (s *PostgresUserStore) GetUserByUsername(username string) (*User, error) {
+func (s *PostgresUserStore) GetUserByUsername(ctx context.Context, username string) (*User, error) {
+	ctx, cancel := s.timeouts.withTimeout(ctx, "UserStore.GetUserByUsername")
+	defer cancel()
+
 	user := &User{
 		PasswordHash: password{},
 	}
-	query := `SELECT id, username, email, password_hash, bio, first_name, last_name, profile_picture, last_login, created_at, updated_at
+	query := `SELECT id, username, email, password_hash, bio, first_name, last_name, profile_picture, last_login, created_at, updated_at, activated
 	FROM users WHERE username = $1`
 
-	err := s.db.QueryRow(query, username).Scan(&user.ID, &user.Username, &user.Email, &user.PasswordHash.hash,
+	_, span := startSpan(ctx, "SELECT users", query)
+	err := s.db.QueryRowContext(ctx, query, username).Scan(&user.ID, &user.Username, &user.Email, &user.PasswordHash.hash,
+		&user.Bio, &user.FirstName, &user.LastName, &user.ProfilePicture,
+		&user.LastLogin, &user.CreatedAt, &user.UpdatedAt, &user.Activated)
+	endSpan(span, err)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// GetUserByEmail returns the user with the given email address, or nil if
+// there is none. Addresses are compared case-insensitively.
+func (s *PostgresUserStore) GetUserByEmail(ctx context.Context, email string) (*User, error) {
+	ctx, cancel := s.timeouts.withTimeout(ctx, "UserStore.GetUserByEmail")
+	defer cancel()
+
+	user := &User{
+		PasswordHash: password{},
+	}
+	query := `SELECT id, username, email, password_hash, bio, first_name, last_name, profile_picture, last_login, created_at, updated_at, activated
+	FROM users WHERE LOWER(email) = LOWER($1)`
+
+	_, span := startSpan(ctx, "SELECT users", query)
+	err := s.db.QueryRowContext(ctx, query, email).Scan(&user.ID, &user.Username, &user.Email, &user.PasswordHash.hash,
 		&user.Bio, &user.FirstName, &user.LastName, &user.ProfilePicture,
-		&user.LastLogin, &user.CreatedAt, &user.UpdatedAt)
+		&user.LastLogin, &user.CreatedAt, &user.UpdatedAt, &user.Activated)
+	endSpan(span, err)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -107,12 +156,42 @@ func (s *PostgresUserStore) GetUserByUsername(username string) (*User, error) {
 	return user, nil
 }
 
-func (s *PostgresUserStore) UpdateUser(user *User) error {
-	query := `UPDATE users SET username = $1, email = $2, password_hash = $3, bio = $4, first_name = $5, last_name = $6, profile_picture = $7, updated_at = CURRENT_TIMESTAMP
+func (s *PostgresUserStore) UpdateUser(ctx context.Context, user *User) error {
+	ctx, cancel := s.timeouts.withTimeout(ctx, "UserStore.UpdateUser")
+	defer cancel()
+
+	query := `UPDATE users SET username = $1, email = $2, password_hash = $3, bio = $4, first_name = $5, last_name = $6, profile_picture = $7, activated = $9, updated_at = CURRENT_TIMESTAMP
 	WHERE id = $8
 	RETURNING updated_at
 	`
-	result, err := s.db.Exec(query, user.Username, user.Email, user.PasswordHash.hash, user.Bio, user.FirstName, user.LastName, user.ProfilePicture, user.ID)
+	_, span := startSpan(ctx, "UPDATE users", query)
+	result, err := s.db.ExecContext(ctx, query, user.Username, user.Email, user.PasswordHash.hash, user.Bio, user.FirstName, user.LastName, user.ProfilePicture, user.ID, user.Activated)
+	endSpan(span, err)
+	if err != nil {
+		return duplicateUserError(err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+
+// DeleteUser removes a user along with everything they own: workouts,
+// exercises, templates, programs, tokens and API keys all go with them. It
+// returns sql.ErrNoRows if there is no such user.
+func (s *PostgresUserStore) DeleteUser(ctx context.Context, id int) error {
+	ctx, cancel := s.timeouts.withTimeout(ctx, "UserStore.DeleteUser")
+	defer cancel()
+
+	query := `DELETE FROM users WHERE id = $1`
+	_, span := startSpan(ctx, "DELETE users", query)
+	result, err := s.db.ExecContext(ctx, query, id)
+	endSpan(span, err)
 	if err != nil {
 		return err
 	}
@@ -126,24 +205,52 @@ func (s *PostgresUserStore) UpdateUser(user *User) error {
 	return nil
 }
 
+// duplicateUserError turns a violation of the unique username or email
+// constraints into ErrDuplicateUsername or ErrDuplicateEmail. Emails are
+// unique both as written and case-insensitively.
+func duplicateUserError(err error) error {
+	var pgErr *pgconn.PgError
+	if !isUniqueViolation(err) || !errors.As(err, &pgErr) {
+		return err
+	}
+	switch pgErr.ConstraintName {
+	case "users_username_key":
+		return ErrDuplicateUsername
+	case "users_email_key", "users_email_lower_key":
+		return ErrDuplicateEmail
+	}
+	return err
+}
 
+// GetUserToken returns the owner of an unexpired token, noting that the token
+// was used. Last use is recorded at most once a minute to spare writes.
+func (s *PostgresUserStore) GetUserToken(ctx context.Context, scope, plaintextPassword string) (*User, error) {
+	ctx, cancel := s.timeouts.withTimeout(ctx, "UserStore.GetUserToken")
+	defer cancel()
 
-func (s *PostgresUserStore) GetUserToken(scope, plaintextPassword string) (*User, error) {
-	rokenHash := sha256.Sum256([]byte(plaintextPassword))
-	
-	query := `SELECT id, username, email, password_hash, bio, first_name, last_name, profile_picture, last_login, created_at, updated_at
+	tokenHash := tokens.Hash(plaintextPassword)
+
+	query := `WITH token AS (
+		SELECT hash, user_id FROM tokens
+		WHERE hash = $1 AND scope = $2 AND expiry > $3
+	), touched AS (
+		UPDATE tokens t SET last_used_at = CURRENT_TIMESTAMP
+		FROM token
+		WHERE t.hash = token.hash AND (t.last_used_at IS NULL OR t.last_used_at < CURRENT_TIMESTAMP - INTERVAL '1 minute')
+	)
+	SELECT u.id, u.username, u.email, u.password_hash, u.bio, u.first_name, u.last_name, u.profile_picture, u.last_login, u.created_at, u.updated_at, u.activated
 	FROM users u
-	INNER JOIN tokens t ON t.user_id = u.id
-	WHERE t.hash = $1 AND t.scope = $2 and t.expiry > $3
-	
+	INNER JOIN token ON token.user_id = u.id
 	`
 
 	user := &User{
 		PasswordHash: password{},
 	}
-	err := s.db.QueryRow(query, rokenHash[:], scope, time.Now()).Scan(&user.ID, &user.Username, &user.Email, &user.PasswordHash.hash,
+	_, span := startSpan(ctx, "SELECT users", query)
+	err := s.db.QueryRowContext(ctx, query, tokenHash, scope, time.Now()).Scan(&user.ID, &user.Username, &user.Email, &user.PasswordHash.hash,
 		&user.Bio, &user.FirstName, &user.LastName, &user.ProfilePicture,
-		&user.LastLogin, &user.CreatedAt, &user.UpdatedAt)
+		&user.LastLogin, &user.CreatedAt, &user.UpdatedAt, &user.Activated)
+	endSpan(span, err)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
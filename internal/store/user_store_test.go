@@ -0,0 +1,35 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/jackc/pgconn"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDuplicateUserError(t *testing.T) {
+	other := errors.New("connection reset")
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{"username", &pgconn.PgError{Code: "23505", ConstraintName: "users_username_key"}, ErrDuplicateUsername},
+		{"email", &pgconn.PgError{Code: "23505", ConstraintName: "users_email_key"}, ErrDuplicateEmail},
+		{"email in another case", fmt.Errorf("insert: %w", &pgconn.PgError{Code: "23505", ConstraintName: "users_email_lower_key"}), ErrDuplicateEmail},
+		{"other constraint", &pgconn.PgError{Code: "23505", ConstraintName: "users_pkey"}, nil},
+		{"not a violation", other, other},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := duplicateUserError(tt.err)
+			if tt.want == nil {
+				assert.Equal(t, tt.err, got)
+				return
+			}
+			assert.ErrorIs(t, got, tt.want)
+		})
+	}
+}
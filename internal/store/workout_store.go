@@ -1,6 +1,15 @@
 package store
 
-import "database/sql"
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
 
 type Workout struct {
 	ID              int            `json:"id"`
@@ -9,66 +18,151 @@ type Workout struct {
 	Description     string         `json:"description"`
 	DurationMinutes int            `json:"duration_minutes"`
 	CaloriesBurned  int            `json:"calories_burned"`
+	ProgramDayID    *int           `json:"program_day_id"`
+	EnrollmentID    *int           `json:"enrollment_id"`
+	CreatedAt       time.Time      `json:"created_at"`
 	Entries         []WorkoutEntry `json:"entries"`
+	// NewRecords holds the personal records set by the entries the last time
+	// they were persisted by CreateWorkout or UpdateWorkout.
+	NewRecords []PersonalRecord `json:"-"`
 }
 
 type WorkoutEntry struct {
 	ID              int      `json:"id"`
+	ExerciseID      *int     `json:"exercise_id"`
 	ExerciseName    string   `json:"exercise_name"`
 	Sets            int      `json:"sets"`
 	Reps            *int     `json:"reps"`
 	DurationSeconds *int     `json:"duration_seconds"`
 	Weight          *float64 `json:"weight"`
+	RPE             *float64 `json:"rpe"`
 	Notes           string   `json:"notes"`
 	OrderIndex      int      `json:"order_index"`
 }
 
 type PostgresWorkoutStore struct {
-	db *sql.DB
+	db       *sql.DB
+	timeouts QueryTimeouts
 }
 
-func NewPostgresWorkoutStore(db *sql.DB) *PostgresWorkoutStore {
-	return &PostgresWorkoutStore{db: db}
+func NewPostgresWorkoutStore(db *sql.DB, timeouts QueryTimeouts) *PostgresWorkoutStore {
+	return &PostgresWorkoutStore{db: db, timeouts: timeouts}
 }
 
 type WorkoutStore interface {
-	CreateWorkout(*Workout) (*Workout, error)
-	GetWorkoutByID(id int64) (*Workout, error)
-	UpdateWorkout(*Workout) error
-	DeleteWorkout(id int64) error
-	GetWorkoutOwner(id int64) (int, error)
+	CreateWorkout(ctx context.Context, workout *Workout) (*Workout, error)
+	GetWorkoutByID(ctx context.Context, id int64) (*Workout, error)
+	UpdateWorkout(ctx context.Context, workout *Workout) error
+	DeleteWorkout(ctx context.Context, id int64) error
+	GetWorkoutOwner(ctx context.Context, id int64) (int, error)
+	ListWorkouts(ctx context.Context, filter WorkoutFilter) ([]Workout, string, error)
+	StreamWorkouts(ctx context.Context, filter WorkoutFilter, fn func(*Workout) error) error
+	ImportWorkouts(ctx context.Context, workouts []*Workout, chunkSize int) ([]error, error)
 }
 
-func (pg *PostgresWorkoutStore) CreateWorkout(workout *Workout) (*Workout, error) {
-	tx, err := pg.db.Begin()
+var (
+	ErrInvalidCursor = errors.New("invalid cursor")
+	ErrInvalidSort   = errors.New("invalid sort field")
+)
+
+const (
+	DefaultWorkoutPageSize = 20
+	MaxWorkoutPageSize     = 100
+)
+
+// WorkoutFilter narrows down and orders the workouts returned by ListWorkouts.
+// From is inclusive and To is exclusive, both compared against created_at.
+// Sort is one of the keys in workoutSortColumns, optionally prefixed with "-"
+// for descending order. Cursor is the opaque value returned by a previous call.
+type WorkoutFilter struct {
+	UserID      int
+	From        *time.Time
+	To          *time.Time
+	MinDuration *int
+	MaxDuration *int
+	Title       string
+	Exercise    string
+	ExerciseID  *int
+	Sort        string
+	Cursor      string
+	Limit       int
+}
+
+type workoutSortColumn struct {
+	expr    string
+	sqlType string
+	value   func(w *Workout) string
+}
+
+var workoutSortColumns = map[string]workoutSortColumn{
+	"created_at": {
+		expr:    "w.created_at",
+		sqlType: "timestamptz",
+		value:   func(w *Workout) string { return w.CreatedAt.Format(time.RFC3339Nano) },
+	},
+	"duration_minutes": {
+		expr:    "w.duration_minutes",
+		sqlType: "integer",
+		value:   func(w *Workout) string { return fmt.Sprint(w.DurationMinutes) },
+	},
+	"calories_burned": {
+		expr:    "COALESCE(w.calories_burned, 0)",
+		sqlType: "integer",
+		value:   func(w *Workout) string { return fmt.Sprint(w.CaloriesBurned) },
+	},
+	"title": {
+		expr:    "w.title",
+		sqlType: "text",
+		value:   func(w *Workout) string { return w.Title },
+	},
+}
+
+// workoutCursor is the keyset position after the last workout of a page.
+// The sort key is kept so a cursor can't be replayed against another ordering.
+type workoutCursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v"`
+	ID    int    `json:"id"`
+}
+
+func encodeWorkoutCursor(c workoutCursor) string {
+	js, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(js)
+}
+
+func decodeWorkoutCursor(raw string) (*workoutCursor, error) {
+	js, err := base64.RawURLEncoding.DecodeString(raw)
 	if err != nil {
-		return nil, err
+		return nil, ErrInvalidCursor
 	}
-	defer tx.Rollback()
+	var c workoutCursor
+	if err := json.Unmarshal(js, &c); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return &c, nil
+}
 
-	query :=
-		`
-  INSERT INTO workouts (user_id, title, description, duration_minutes, calories_burned)
-  VALUES ($1, $2, $3, $4, $5)
-  RETURNING id 
-  `
+// likePattern escapes the LIKE wildcards in s and wraps it for a substring match.
+func likePattern(s string) string {
+	return "%" + strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s) + "%"
+}
+
+func (pg *PostgresWorkoutStore) CreateWorkout(ctx context.Context, workout *Workout) (*Workout, error) {
+	ctx, cancel := pg.timeouts.withTimeout(ctx, "WorkoutStore.CreateWorkout")
+	defer cancel()
 
-	err = tx.QueryRow(query, workout.UserID, workout.Title, workout.Description, workout.DurationMinutes, workout.CaloriesBurned).Scan(&workout.ID)
+	ctx, span := startSpan(ctx, "WorkoutStore.CreateWorkout", "")
+	defer span.End()
+
+	tx, err := pg.db.BeginTx(ctx, nil)
 	if err != nil {
 		return nil, err
 	}
+	defer tx.Rollback()
 
-	// we also need to insert the entries
-	for _, entry := range workout.Entries {
-		query := `
-    INSERT INTO workout_entries (workout_id, exercise_name, sets, reps, duration_seconds, weight, notes, order_index)
-    VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
-    RETURNING id
-    `
-		err = tx.QueryRow(query, workout.ID, entry.ExerciseName, entry.Sets, entry.Reps, entry.DurationSeconds, entry.Weight, entry.Notes, entry.OrderIndex).Scan(&entry.ID)
-		if err != nil {
-			return nil, err
-		}
+	err = createWorkout(ctx, tx, workout, nil)
+	if err != nil {
+		return nil, err
 	}
 
 	err = tx.Commit()
@@ -79,14 +173,54 @@ func (pg *PostgresWorkoutStore) CreateWorkout(workout *Workout) (*Workout, error
 	return workout, nil
 }
 
-func (pg *PostgresWorkoutStore) GetWorkoutByID(id int64) (*Workout, error) {
+// createWorkout inserts the workout with its entries and updates the user's
+// personal records. createdAt backdates the workout; nil means now.
+func createWorkout(ctx context.Context, tx *sql.Tx, workout *Workout, createdAt *time.Time) error {
+	err := resolveProgramDay(ctx, tx, workout)
+	if err != nil {
+		return err
+	}
+
+	query :=
+		`
+  INSERT INTO workouts (user_id, title, description, duration_minutes, calories_burned, program_day_id, enrollment_id, created_at)
+  VALUES ($1, $2, $3, $4, $5, $6, $7, COALESCE($8, CURRENT_TIMESTAMP))
+  RETURNING id, created_at
+  `
+
+	_, span := startSpan(ctx, "INSERT workouts", query)
+	err = tx.QueryRowContext(ctx, query, workout.UserID, workout.Title, workout.Description, workout.DurationMinutes, workout.CaloriesBurned, workout.ProgramDayID, workout.EnrollmentID, createdAt).Scan(&workout.ID, &workout.CreatedAt)
+	endSpan(span, err)
+	if err != nil {
+		return err
+	}
+
+	// we also need to insert the entries
+	err = insertWorkoutEntries(ctx, tx, workout)
+	if err != nil {
+		return err
+	}
+
+	workout.NewRecords, err = updatePersonalRecords(ctx, tx, workout)
+	return err
+}
+
+func (pg *PostgresWorkoutStore) GetWorkoutByID(ctx context.Context, id int64) (*Workout, error) {
+	ctx, cancel := pg.timeouts.withTimeout(ctx, "WorkoutStore.GetWorkoutByID")
+	defer cancel()
+
+	ctx, span := startSpan(ctx, "WorkoutStore.GetWorkoutByID", "")
+	defer span.End()
+
 	workout := &Workout{}
 	query := `
-  SELECT id, title, description, duration_minutes, calories_burned
+  SELECT id, user_id, title, description, duration_minutes, calories_burned, program_day_id, enrollment_id, created_at
   FROM workouts
   WHERE id = $1
   `
-	err := pg.db.QueryRow(query, id).Scan(&workout.ID, &workout.Title, &workout.Description, &workout.DurationMinutes, &workout.CaloriesBurned)
+	_, querySpan := startSpan(ctx, "SELECT workouts", query)
+	err := pg.db.QueryRowContext(ctx, query, id).Scan(&workout.ID, &workout.UserID, &workout.Title, &workout.Description, &workout.DurationMinutes, &workout.CaloriesBurned, &workout.ProgramDayID, &workout.EnrollmentID, &workout.CreatedAt)
+	endSpan(querySpan, err)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -97,13 +231,15 @@ func (pg *PostgresWorkoutStore) GetWorkoutByID(id int64) (*Workout, error) {
 
 	// lets get the entries
 	entryQuery := `
-  SELECT id, exercise_name, sets, reps, duration_seconds, weight, notes, order_index
+  SELECT id, exercise_id, exercise_name, sets, reps, duration_seconds, weight, rpe, notes, order_index
   FROM workout_entries
   WHERE workout_id = $1
   ORDER BY order_index
   `
 
-	rows, err := pg.db.Query(entryQuery, id)
+	_, querySpan = startSpan(ctx, "SELECT workout_entries", entryQuery)
+	rows, err := pg.db.QueryContext(ctx, entryQuery, id)
+	endSpan(querySpan, err)
 	if err != nil {
 		return nil, err
 	}
@@ -113,11 +249,13 @@ func (pg *PostgresWorkoutStore) GetWorkoutByID(id int64) (*Workout, error) {
 		var entry WorkoutEntry
 		err = rows.Scan(
 			&entry.ID,
+			&entry.ExerciseID,
 			&entry.ExerciseName,
 			&entry.Sets,
 			&entry.Reps,
 			&entry.DurationSeconds,
 			&entry.Weight,
+			&entry.RPE,
 			&entry.Notes,
 			&entry.OrderIndex,
 		)
@@ -130,8 +268,14 @@ func (pg *PostgresWorkoutStore) GetWorkoutByID(id int64) (*Workout, error) {
 	return workout, nil
 }
 
-func (pg *PostgresWorkoutStore) UpdateWorkout(workout *Workout) error {
-	tx, err := pg.db.Begin()
+func (pg *PostgresWorkoutStore) UpdateWorkout(ctx context.Context, workout *Workout) error {
+	ctx, cancel := pg.timeouts.withTimeout(ctx, "WorkoutStore.UpdateWorkout")
+	defer cancel()
+
+	ctx, span := startSpan(ctx, "WorkoutStore.UpdateWorkout", "")
+	defer span.End()
+
+	tx, err := pg.db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
@@ -142,7 +286,9 @@ func (pg *PostgresWorkoutStore) UpdateWorkout(workout *Workout) error {
   SET title = $1, description = $2, duration_minutes = $3, calories_burned = $4
   WHERE id = $5
   `
-	result, err := tx.Exec(query, workout.Title, workout.Description, workout.DurationMinutes, workout.CaloriesBurned, workout.ID)
+	_, querySpan := startSpan(ctx, "UPDATE workouts", query)
+	result, err := tx.ExecContext(ctx, query, workout.Title, workout.Description, workout.DurationMinutes, workout.CaloriesBurned, workout.ID)
+	endSpan(querySpan, err)
 	if err != nil {
 		return err
 	}
@@ -156,59 +302,192 @@ func (pg *PostgresWorkoutStore) UpdateWorkout(workout *Workout) error {
 		return sql.ErrNoRows
 	}
 
-	_, err = tx.Exec(`DELETE FROM workout_entries WHERE workout_id = $1`, workout.ID)
+	// the old entries may hold records the new ones no longer reach
+	exercises, err := recordExercises(ctx, tx, workout.ID)
+	if err != nil {
+		return err
+	}
+	held, err := heldRecords(ctx, tx, workout.ID)
+	if err != nil {
+		return err
+	}
+
+	deleteQuery := `DELETE FROM workout_entries WHERE workout_id = $1`
+	_, querySpan = startSpan(ctx, "DELETE workout_entries", deleteQuery)
+	_, err = tx.ExecContext(ctx, deleteQuery, workout.ID)
+	endSpan(querySpan, err)
+	if err != nil {
+		return err
+	}
+
+	err = insertWorkoutEntries(ctx, tx, workout)
+	if err != nil {
+		return err
+	}
+
+	// the other workouts set the bar the new entries are compared against
+	err = recomputePersonalRecords(ctx, tx, workout.UserID, exercises, workout.ID)
+	if err != nil {
+		return err
+	}
+	newRecords, err := updatePersonalRecords(ctx, tx, workout)
+	if err != nil {
+		return err
+	}
+	// records the workout held before are only new if the edit changed them
+	workout.NewRecords = changedRecords(newRecords, held)
+
+	return tx.Commit()
+}
+
+// ImportWorkouts creates the workouts the same way CreateWorkout does, keeping
+// each one's CreatedAt. The returned slice holds the error each workout failed
+// with, or nil. With chunkSize 0 or less everything runs in one transaction
+// that is only committed if every workout succeeded; otherwise each chunk of
+// chunkSize workouts is committed on its own and failed workouts are skipped.
+func (pg *PostgresWorkoutStore) ImportWorkouts(ctx context.Context, workouts []*Workout, chunkSize int) ([]error, error) {
+	ctx, cancel := pg.timeouts.withTimeout(ctx, "WorkoutStore.ImportWorkouts")
+	defer cancel()
+
+	ctx, span := startSpan(ctx, "WorkoutStore.ImportWorkouts", "")
+	defer span.End()
+
+	failures := make([]error, len(workouts))
+	atomic := chunkSize <= 0
+	if atomic {
+		chunkSize = len(workouts)
+	}
+
+	for start := 0; start < len(workouts); start += chunkSize {
+		end := min(start+chunkSize, len(workouts))
+		err := pg.importChunk(ctx, workouts[start:end], failures[start:end], atomic)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return failures, nil
+}
+
+// importChunk creates each workout under its own savepoint so a bad one does
+// not hide errors in the rest, then commits unless atomic is set and one failed.
+func (pg *PostgresWorkoutStore) importChunk(ctx context.Context, workouts []*Workout, failures []error, atomic bool) error {
+	tx, err := pg.db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
+
+	failed := false
+	for i, workout := range workouts {
+		_, err = tx.ExecContext(ctx, `SAVEPOINT import_workout`)
+		if err != nil {
+			return err
+		}
+
+		createdAt := workout.CreatedAt
+		err = createWorkout(ctx, tx, workout, &createdAt)
+		if err != nil {
+			failures[i] = err
+			failed = true
+			workout.ID = 0
+			_, err = tx.ExecContext(ctx, `ROLLBACK TO SAVEPOINT import_workout`)
+		} else {
+			_, err = tx.ExecContext(ctx, `RELEASE SAVEPOINT import_workout`)
+		}
+		if err != nil {
+			return err
+		}
+	}
 
-	for _, entry := range workout.Entries {
-		query := `
-    INSERT INTO workout_entries (workout_id, exercise_name, sets, reps, duration_seconds, weight, notes, order_index)
-    VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
-    `
+	if atomic && failed {
+		for _, workout := range workouts {
+			workout.ID = 0
+		}
+		return nil
+	}
+	return tx.Commit()
+}
 
-		_, err := tx.Exec(query,
+// insertWorkoutEntries links each entry to the exercise catalog and inserts it,
+// filling in the generated IDs on workout.Entries.
+func insertWorkoutEntries(ctx context.Context, tx *sql.Tx, workout *Workout) error {
+	query := `
+  INSERT INTO workout_entries (workout_id, exercise_id, exercise_name, sets, reps, duration_seconds, weight, rpe, notes, order_index)
+  VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+  RETURNING id
+  `
+	for i := range workout.Entries {
+		entry := &workout.Entries[i]
+		err := resolveEntryExercise(ctx, tx, workout.UserID, entry)
+		if err != nil {
+			return fmt.Errorf("entry %d: %w", i, err)
+		}
+
+		_, span := startSpan(ctx, "INSERT workout_entries", query)
+		err = tx.QueryRowContext(ctx, query,
 			workout.ID,
+			entry.ExerciseID,
 			entry.ExerciseName,
 			entry.Sets,
 			entry.Reps,
 			entry.DurationSeconds,
 			entry.Weight,
+			entry.RPE,
 			entry.Notes,
 			entry.OrderIndex,
-		)
-
+		).Scan(&entry.ID)
+		endSpan(span, err)
 		if err != nil {
 			return err
 		}
 	}
-
-	return tx.Commit()
+	return nil
 }
 
-func (pg *PostgresWorkoutStore) DeleteWorkout(id int64) error {
+// DeleteWorkout deletes a workout with its entries. The records it held fall
+// back to the best remaining entries.
+func (pg *PostgresWorkoutStore) DeleteWorkout(ctx context.Context, id int64) error {
+	ctx, cancel := pg.timeouts.withTimeout(ctx, "WorkoutStore.DeleteWorkout")
+	defer cancel()
+
+	tx, err := pg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	exercises, err := recordExercises(ctx, tx, int(id))
+	if err != nil {
+		return err
+	}
+
 	query := `
   DELETE from workouts
   WHERE id = $1
+  RETURNING user_id
   `
 
-	result, err := pg.db.Exec(query, id)
+	var userID int
+	_, span := startSpan(ctx, "DELETE workouts", query)
+	err = tx.QueryRowContext(ctx, query, id).Scan(&userID)
+	endSpan(span, err)
 	if err != nil {
+		// sql.ErrNoRows when there is no such workout
 		return err
 	}
-	rowsAffected, err := result.RowsAffected()
+
+	err = recomputePersonalRecords(ctx, tx, userID, exercises, int(id))
 	if err != nil {
 		return err
 	}
 
-	if rowsAffected == 0 {
-		return sql.ErrNoRows
-	}
-
-	return nil
+	return tx.Commit()
 }
 
-func (pg *PostgresWorkoutStore) GetWorkoutOwner(workoutID int64) (int, error) {
+func (pg *PostgresWorkoutStore) GetWorkoutOwner(ctx context.Context, workoutID int64) (int, error) {
+	ctx, cancel := pg.timeouts.withTimeout(ctx, "WorkoutStore.GetWorkoutOwner")
+	defer cancel()
+
 	var userID int
 
 	query := `
@@ -217,10 +496,308 @@ func (pg *PostgresWorkoutStore) GetWorkoutOwner(workoutID int64) (int, error) {
   WHERE id = $1
   `
 
-	err := pg.db.QueryRow(query, workoutID).Scan(&userID)
+	_, span := startSpan(ctx, "SELECT workouts", query)
+	err := pg.db.QueryRowContext(ctx, query, workoutID).Scan(&userID)
+	endSpan(span, err)
 	if err != nil {
 		return 0, err
 	}
 
 	return userID, nil
 }
+
+// ListWorkouts returns a page of the user's workouts matching filter along with
+// the cursor for the next page, which is empty once there are no more results.
+func (pg *PostgresWorkoutStore) ListWorkouts(ctx context.Context, filter WorkoutFilter) ([]Workout, string, error) {
+	ctx, cancel := pg.timeouts.withTimeout(ctx, "WorkoutStore.ListWorkouts")
+	defer cancel()
+
+	ctx, span := startSpan(ctx, "WorkoutStore.ListWorkouts", "")
+	defer span.End()
+
+	sortKey := filter.Sort
+	if sortKey == "" {
+		sortKey = "-created_at"
+	}
+	desc := strings.HasPrefix(sortKey, "-")
+	column, ok := workoutSortColumns[strings.TrimPrefix(sortKey, "-")]
+	if !ok {
+		return nil, "", ErrInvalidSort
+	}
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = DefaultWorkoutPageSize
+	}
+	if limit > MaxWorkoutPageSize {
+		limit = MaxWorkoutPageSize
+	}
+
+	var args []interface{}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	conditions := workoutConditions(&filter, arg)
+
+	if filter.Cursor != "" {
+		cursor, err := decodeWorkoutCursor(filter.Cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		if cursor.Sort != sortKey {
+			return nil, "", ErrInvalidCursor
+		}
+		op := ">"
+		if desc {
+			op = "<"
+		}
+		conditions = append(conditions, fmt.Sprintf("(%s, w.id) %s (%s::%s, %s)",
+			column.expr, op, arg(cursor.Value), column.sqlType, arg(cursor.ID)))
+	}
+
+	direction := "ASC"
+	if desc {
+		direction = "DESC"
+	}
+
+	query := fmt.Sprintf(`
+  SELECT w.id, w.user_id, w.title, w.description, w.duration_minutes, COALESCE(w.calories_burned, 0), w.program_day_id, w.enrollment_id, w.created_at
+  FROM workouts w
+  WHERE %s
+  ORDER BY %s %s, w.id %s
+  LIMIT %s
+  `, strings.Join(conditions, " AND "), column.expr, direction, direction, arg(limit+1))
+
+	_, querySpan := startSpan(ctx, "SELECT workouts", query)
+	rows, err := pg.db.QueryContext(ctx, query, args...)
+	endSpan(querySpan, err)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	workouts := []Workout{}
+	for rows.Next() {
+		var workout Workout
+		err = rows.Scan(
+			&workout.ID,
+			&workout.UserID,
+			&workout.Title,
+			&workout.Description,
+			&workout.DurationMinutes,
+			&workout.CaloriesBurned,
+			&workout.ProgramDayID,
+			&workout.EnrollmentID,
+			&workout.CreatedAt,
+		)
+		if err != nil {
+			return nil, "", err
+		}
+		workouts = append(workouts, workout)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, "", err
+	}
+
+	nextCursor := ""
+	if len(workouts) > limit {
+		workouts = workouts[:limit]
+		last := &workouts[limit-1]
+		nextCursor = encodeWorkoutCursor(workoutCursor{Sort: sortKey, Value: column.value(last), ID: last.ID})
+	}
+
+	err = pg.loadEntries(ctx, workouts)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return workouts, nextCursor, nil
+}
+
+// workoutConditions builds the WHERE conditions shared by ListWorkouts and
+// StreamWorkouts for everything in filter except the cursor, binding values
+// through arg.
+func workoutConditions(filter *WorkoutFilter, arg func(interface{}) string) []string {
+	conditions := []string{"w.user_id = " + arg(filter.UserID)}
+	if filter.From != nil {
+		conditions = append(conditions, "w.created_at >= "+arg(*filter.From))
+	}
+	if filter.To != nil {
+		conditions = append(conditions, "w.created_at < "+arg(*filter.To))
+	}
+	if filter.MinDuration != nil {
+		conditions = append(conditions, "w.duration_minutes >= "+arg(*filter.MinDuration))
+	}
+	if filter.MaxDuration != nil {
+		conditions = append(conditions, "w.duration_minutes <= "+arg(*filter.MaxDuration))
+	}
+	if filter.Title != "" {
+		conditions = append(conditions, "w.title ILIKE "+arg(likePattern(filter.Title)))
+	}
+	if filter.Exercise != "" {
+		conditions = append(conditions, `EXISTS (
+    SELECT 1 FROM workout_entries we
+    WHERE we.workout_id = w.id AND lower(we.exercise_name) = lower(`+arg(filter.Exercise)+`)
+  )`)
+	}
+	if filter.ExerciseID != nil {
+		conditions = append(conditions, `EXISTS (
+    SELECT 1 FROM workout_entries we
+    WHERE we.workout_id = w.id AND we.exercise_id = `+arg(*filter.ExerciseID)+`
+  )`)
+	}
+	return conditions
+}
+
+// loadEntries fetches the entries of all the given workouts in a single query.
+func (pg *PostgresWorkoutStore) loadEntries(ctx context.Context, workouts []Workout) error {
+	if len(workouts) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, len(workouts))
+	byID := make(map[int]*Workout, len(workouts))
+	for i := range workouts {
+		ids[i] = int64(workouts[i].ID)
+		byID[workouts[i].ID] = &workouts[i]
+	}
+
+	query := `
+  SELECT workout_id, id, exercise_id, exercise_name, sets, reps, duration_seconds, weight, rpe, notes, order_index
+  FROM workout_entries
+  WHERE workout_id = ANY($1)
+  ORDER BY workout_id, order_index
+  `
+
+	_, span := startSpan(ctx, "SELECT workout_entries", query)
+	rows, err := pg.db.QueryContext(ctx, query, ids)
+	endSpan(span, err)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var workoutID int
+		var entry WorkoutEntry
+		err = rows.Scan(
+			&workoutID,
+			&entry.ID,
+			&entry.ExerciseID,
+			&entry.ExerciseName,
+			&entry.Sets,
+			&entry.Reps,
+			&entry.DurationSeconds,
+			&entry.Weight,
+			&entry.RPE,
+			&entry.Notes,
+			&entry.OrderIndex,
+		)
+		if err != nil {
+			return err
+		}
+		workout := byID[workoutID]
+		workout.Entries = append(workout.Entries, entry)
+	}
+
+	return rows.Err()
+}
+
+// StreamWorkouts calls fn with each of the user's workouts matching filter,
+// oldest first, reading them (with their entries) from a single query as it
+// goes so the whole history is never held in memory. Sort, Cursor and Limit
+// are ignored. An error returned by fn stops the iteration and is returned.
+func (pg *PostgresWorkoutStore) StreamWorkouts(ctx context.Context, filter WorkoutFilter, fn func(*Workout) error) error {
+	ctx, cancel := pg.timeouts.withTimeout(ctx, "WorkoutStore.StreamWorkouts")
+	defer cancel()
+
+	var args []interface{}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+	conditions := workoutConditions(&filter, arg)
+
+	query := `
+  SELECT w.id, w.user_id, w.title, w.description, w.duration_minutes, COALESCE(w.calories_burned, 0),
+    w.program_day_id, w.enrollment_id, w.created_at,
+    we.id, we.exercise_id, we.exercise_name, we.sets, we.reps, we.duration_seconds, we.weight, we.rpe, we.notes, we.order_index
+  FROM workouts w
+  LEFT JOIN workout_entries we ON we.workout_id = w.id
+  WHERE ` + strings.Join(conditions, " AND ") + `
+  ORDER BY w.created_at, w.id, we.order_index
+  `
+	_, span := startSpan(ctx, "SELECT workouts", query)
+	rows, err := pg.db.QueryContext(ctx, query, args...)
+	endSpan(span, err)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var current *Workout
+	for rows.Next() {
+		var workout Workout
+		var (
+			entryID      sql.NullInt64
+			exerciseName sql.NullString
+			sets         sql.NullInt64
+			notes        sql.NullString
+			orderIndex   sql.NullInt64
+			entry        WorkoutEntry
+		)
+		err = rows.Scan(
+			&workout.ID,
+			&workout.UserID,
+			&workout.Title,
+			&workout.Description,
+			&workout.DurationMinutes,
+			&workout.CaloriesBurned,
+			&workout.ProgramDayID,
+			&workout.EnrollmentID,
+			&workout.CreatedAt,
+			&entryID,
+			&entry.ExerciseID,
+			&exerciseName,
+			&sets,
+			&entry.Reps,
+			&entry.DurationSeconds,
+			&entry.Weight,
+			&entry.RPE,
+			&notes,
+			&orderIndex,
+		)
+		if err != nil {
+			return err
+		}
+
+		if current == nil || current.ID != workout.ID {
+			if current != nil {
+				if err = fn(current); err != nil {
+					return err
+				}
+			}
+			workout.Entries = []WorkoutEntry{}
+			current = &workout
+		}
+
+		if entryID.Valid {
+			entry.ID = int(entryID.Int64)
+			entry.ExerciseName = exerciseName.String
+			entry.Sets = int(sets.Int64)
+			entry.Notes = notes.String
+			entry.OrderIndex = int(orderIndex.Int64)
+			current.Entries = append(current.Entries, entry)
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	if current != nil {
+		return fn(current)
+	}
+	return nil
+}
@@ -1,16 +1,29 @@
 package store
 
 import (
+	"context"
 	"database/sql"
+	"errors"
+	"fmt"
+	"os"
 	"testing"
+	"time"
 
 	_ "github.com/jackc/pgx/v4/stdlib"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
+// testDSN points at the docker-compose test database unless FEM_TEST_DB_DSN is set.
+func testDSN() string {
+	if dsn := os.Getenv("FEM_TEST_DB_DSN"); dsn != "" {
+		return dsn
+	}
+	return "host=localhost user=postgres password=postgres dbname=postgres port=5433 sslmode=disable"
+}
+
 func setupTestDB(t *testing.T) *sql.DB {
-	db, err := sql.Open("pgx", "host=localhost user=postgres password=postgres dbname=postgres port=5433 sslmode=disable")
+	db, err := sql.Open("pgx", testDSN())
 
 	if err != nil {
 		t.Fatalf("opening test db error: %v", err)
@@ -30,7 +43,7 @@ func TestCreateWorkout(t *testing.T) {
 	db := setupTestDB(t)
 	defer db.Close()
 
-	store := NewPostgresWorkoutStore(db)
+	store := NewPostgresWorkoutStore(db, QueryTimeouts{})
 
 	tests := []struct {
 		name    string
@@ -112,7 +125,7 @@ func TestCreateWorkout(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			createdWorkout, errt := store.CreateWorkout(tt.workout)
+			createdWorkout, errt := store.CreateWorkout(context.Background(), tt.workout)
 			if tt.wantErr {
 				assert.Error(t, errt)
 				return
@@ -124,7 +137,7 @@ func TestCreateWorkout(t *testing.T) {
 			assert.Equal(t, tt.workout.DurationMinutes, createdWorkout.DurationMinutes)
 			assert.Equal(t, tt.workout.CaloriesBurned, createdWorkout.CaloriesBurned)
 
-			retrieved, err := store.GetWorkoutByID(int64(createdWorkout.ID))
+			retrieved, err := store.GetWorkoutByID(context.Background(), int64(createdWorkout.ID))
 			require.NoError(t, err)
 			assert.Equal(t, tt.workout.ID, retrieved.ID)
 			assert.Equal(t, len(tt.workout.Entries), len(retrieved.Entries))
@@ -138,6 +151,249 @@ func TestCreateWorkout(t *testing.T) {
 	}
 }
 
+func createTestUser(t *testing.T, db *sql.DB, username string) *User {
+	t.Helper()
+	user := &User{
+		Username:  username,
+		Email:     username + "@example.com",
+		FirstName: "Test",
+		LastName:  "User",
+	}
+	require.NoError(t, user.PasswordHash.SetPassword("password123"))
+	_, err := db.Exec(`DELETE FROM users WHERE username = $1`, username)
+	require.NoError(t, err)
+	require.NoError(t, NewPostgresUserStore(db, QueryTimeouts{}).CreateUser(context.Background(), user))
+	return user
+}
+
+func TestListWorkouts(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	store := NewPostgresWorkoutStore(db, QueryTimeouts{})
+	user := createTestUser(t, db, "list_workouts_user")
+
+	for i, title := range []string{"Leg Day", "Push Day", "Pull Day", "Leg Day Two"} {
+		exercise := "Squat"
+		if i%2 == 1 {
+			exercise = "Bench Press"
+		}
+		_, err := store.CreateWorkout(context.Background(), &Workout{
+			UserID:          user.ID,
+			Title:           title,
+			DurationMinutes: 30 + i*10,
+			Entries: []WorkoutEntry{
+				{ExerciseName: exercise, Sets: 3, Reps: IntPtr(5), OrderIndex: 1},
+			},
+		})
+		require.NoError(t, err)
+	}
+
+	t.Run("paginates with a cursor", func(t *testing.T) {
+		first, cursor, err := store.ListWorkouts(context.Background(), WorkoutFilter{UserID: user.ID, Sort: "duration_minutes", Limit: 3})
+		require.NoError(t, err)
+		require.Len(t, first, 3)
+		assert.NotEmpty(t, cursor)
+		assert.Equal(t, 30, first[0].DurationMinutes)
+		assert.Len(t, first[0].Entries, 1)
+
+		second, cursor, err := store.ListWorkouts(context.Background(), WorkoutFilter{UserID: user.ID, Sort: "duration_minutes", Limit: 3, Cursor: cursor})
+		require.NoError(t, err)
+		require.Len(t, second, 1)
+		assert.Empty(t, cursor)
+		assert.Equal(t, 60, second[0].DurationMinutes)
+	})
+
+	t.Run("filters by title, duration and exercise", func(t *testing.T) {
+		workouts, _, err := store.ListWorkouts(context.Background(), WorkoutFilter{UserID: user.ID, Title: "leg"})
+		require.NoError(t, err)
+		assert.Len(t, workouts, 2)
+
+		workouts, _, err = store.ListWorkouts(context.Background(), WorkoutFilter{UserID: user.ID, MinDuration: IntPtr(40), MaxDuration: IntPtr(50)})
+		require.NoError(t, err)
+		assert.Len(t, workouts, 2)
+
+		workouts, _, err = store.ListWorkouts(context.Background(), WorkoutFilter{UserID: user.ID, Exercise: "bench press"})
+		require.NoError(t, err)
+		assert.Len(t, workouts, 2)
+	})
+
+	t.Run("rejects a cursor from another sort", func(t *testing.T) {
+		_, cursor, err := store.ListWorkouts(context.Background(), WorkoutFilter{UserID: user.ID, Sort: "title", Limit: 1})
+		require.NoError(t, err)
+		_, _, err = store.ListWorkouts(context.Background(), WorkoutFilter{UserID: user.ID, Sort: "-title", Cursor: cursor})
+		assert.ErrorIs(t, err, ErrInvalidCursor)
+	})
+}
+
+func TestCreateWorkoutLinksExercises(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	store := NewPostgresWorkoutStore(db, QueryTimeouts{})
+	user := createTestUser(t, db, "exercise_link_user")
+
+	workout, err := store.CreateWorkout(context.Background(), &Workout{
+		UserID:          user.ID,
+		Title:           "Catalog workout",
+		DurationMinutes: 45,
+		Entries: []WorkoutEntry{
+			{ExerciseName: "bench press", Sets: 3, Reps: IntPtr(5), OrderIndex: 1},
+			{ExerciseName: "Sled Push", Sets: 2, Reps: IntPtr(1), OrderIndex: 2},
+		},
+	})
+	require.NoError(t, err)
+	require.NotNil(t, workout.Entries[0].ExerciseID)
+	assert.Equal(t, "Bench Press", workout.Entries[0].ExerciseName)
+	assert.Nil(t, workout.Entries[1].ExerciseID)
+
+	_, err = store.CreateWorkout(context.Background(), &Workout{
+		UserID:          user.ID,
+		Title:           "Plank for reps",
+		DurationMinutes: 5,
+		Entries: []WorkoutEntry{
+			{ExerciseName: "Plank", Sets: 1, Reps: IntPtr(10), OrderIndex: 1},
+		},
+	})
+	assert.ErrorIs(t, err, ErrMeasurementMismatch)
+}
+
+func TestPersonalRecordsFollowEntryChanges(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	store := NewPostgresWorkoutStore(db, QueryTimeouts{})
+	records := NewPostgresPersonalRecordStore(db, QueryTimeouts{})
+	user := createTestUser(t, db, "record_changes_user")
+
+	maxWeight := func() PersonalRecord {
+		t.Helper()
+		list, err := records.ListPersonalRecords(context.Background(), user.ID, "squat")
+		require.NoError(t, err)
+		for _, record := range list {
+			if record.RecordType == RecordMaxWeight {
+				return record
+			}
+		}
+		t.Fatal("no max weight record")
+		return PersonalRecord{}
+	}
+
+	first, err := store.CreateWorkout(context.Background(), &Workout{
+		UserID:          user.ID,
+		Title:           "Squats",
+		DurationMinutes: 30,
+		Entries:         []WorkoutEntry{{ExerciseName: "Squat", Sets: 3, Reps: IntPtr(5), Weight: FloatPtr(100), OrderIndex: 1}},
+	})
+	require.NoError(t, err)
+	typo, err := store.CreateWorkout(context.Background(), &Workout{
+		UserID:          user.ID,
+		Title:           "More squats",
+		DurationMinutes: 30,
+		Entries:         []WorkoutEntry{{ExerciseName: "Squat", Sets: 3, Reps: IntPtr(5), Weight: FloatPtr(500), OrderIndex: 1}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 500.0, maxWeight().Value)
+
+	t.Run("correcting an entry lowers the record", func(t *testing.T) {
+		typo.Entries = []WorkoutEntry{{ExerciseName: "Squat", Sets: 3, Reps: IntPtr(5), Weight: FloatPtr(105), OrderIndex: 1}}
+		require.NoError(t, store.UpdateWorkout(context.Background(), typo))
+		assert.NotEmpty(t, typo.NewRecords)
+
+		record := maxWeight()
+		assert.Equal(t, 105.0, record.Value)
+		require.NotNil(t, record.WorkoutEntryID)
+		assert.Equal(t, typo.Entries[0].ID, *record.WorkoutEntryID)
+	})
+
+	t.Run("an edit that leaves the entries alone sets no new records", func(t *testing.T) {
+		typo.Title = "Heavier squats"
+		require.NoError(t, store.UpdateWorkout(context.Background(), typo))
+		assert.Empty(t, typo.NewRecords)
+		assert.Equal(t, 105.0, maxWeight().Value)
+	})
+
+	t.Run("deleting a workout falls back to the next best", func(t *testing.T) {
+		require.NoError(t, store.DeleteWorkout(context.Background(), int64(typo.ID)))
+
+		record := maxWeight()
+		assert.Equal(t, 100.0, record.Value)
+		require.NotNil(t, record.WorkoutID)
+		assert.Equal(t, first.ID, *record.WorkoutID)
+	})
+}
+
+func TestStreamWorkouts(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	store := NewPostgresWorkoutStore(db, QueryTimeouts{})
+	user := createTestUser(t, db, "stream_workouts_user")
+	other := createTestUser(t, db, "stream_workouts_other")
+
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	var workouts []*Workout
+	for i, entries := range [][]WorkoutEntry{
+		{{ExerciseName: "Squat", Sets: 5, Reps: IntPtr(5), Weight: FloatPtr(100), OrderIndex: 2}, {ExerciseName: "Lunge", Sets: 3, Reps: IntPtr(10), OrderIndex: 1}},
+		nil,
+		{{ExerciseName: "Bench Press", Sets: 5, Reps: IntPtr(5), OrderIndex: 1}},
+	} {
+		workouts = append(workouts, &Workout{
+			UserID:          user.ID,
+			Title:           fmt.Sprintf("Workout %d", i),
+			DurationMinutes: 30,
+			CreatedAt:       start.AddDate(0, 0, i),
+			Entries:         entries,
+		})
+	}
+	// imported so that the dates can be set, and out of order
+	failures, err := store.ImportWorkouts(context.Background(), []*Workout{workouts[2], workouts[0], workouts[1]}, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []error{nil, nil, nil}, failures)
+	_, err = store.CreateWorkout(context.Background(), &Workout{UserID: other.ID, Title: "Not mine", DurationMinutes: 10})
+	require.NoError(t, err)
+
+	stream := func(filter WorkoutFilter) []*Workout {
+		t.Helper()
+		var streamed []*Workout
+		require.NoError(t, store.StreamWorkouts(context.Background(), filter, func(workout *Workout) error {
+			streamed = append(streamed, workout)
+			return nil
+		}))
+		return streamed
+	}
+
+	t.Run("streams the user's workouts oldest first with their entries", func(t *testing.T) {
+		streamed := stream(WorkoutFilter{UserID: user.ID})
+		require.Len(t, streamed, 3)
+		for i, workout := range streamed {
+			assert.Equal(t, workouts[i].ID, workout.ID)
+			assert.Equal(t, workouts[i].Title, workout.Title)
+			assert.Len(t, workout.Entries, len(workouts[i].Entries))
+		}
+		assert.Equal(t, "Lunge", streamed[0].Entries[0].ExerciseName)
+		assert.Equal(t, "Squat", streamed[0].Entries[1].ExerciseName)
+	})
+
+	t.Run("limits to the date range", func(t *testing.T) {
+		from, to := start.AddDate(0, 0, 1), start.AddDate(0, 0, 2)
+		streamed := stream(WorkoutFilter{UserID: user.ID, From: &from, To: &to})
+		require.Len(t, streamed, 1)
+		assert.Equal(t, workouts[1].ID, streamed[0].ID)
+	})
+
+	t.Run("stops at the first error", func(t *testing.T) {
+		calls := 0
+		stop := errors.New("client went away")
+		err := store.StreamWorkouts(context.Background(), WorkoutFilter{UserID: user.ID}, func(workout *Workout) error {
+			calls++
+			return stop
+		})
+		assert.ErrorIs(t, err, stop)
+		assert.Equal(t, 1, calls)
+	})
+}
+
 func IntPtr(i int) *int {
 	return &i
 }
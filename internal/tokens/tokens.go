@@ -4,19 +4,56 @@ import (
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/base32"
+	"strings"
 	"time"
 )
 
 const (
 	ScopeAuth = "authentication"
+	// ScopeRefresh tokens are only good for exchanging at POST /tokens/refresh
+	// for a new authentication token, and only once.
+	ScopeRefresh = "refresh"
+	ScopeAPIKey  = "api_key"
+	// Scope2FAPending tokens stand for a correct password of an account with
+	// 2FA on, and are exchanged at POST /tokens/2fa with a code.
+	Scope2FAPending    = "2fa_pending"
+	ScopePasswordReset = "password-reset"
+	ScopeActivation    = "activation"
 )
 
+// APIKeyPrefix starts every API key, telling them apart from session tokens
+// and making leaked keys easy to search for.
+const APIKeyPrefix = "fem_"
+
+// apiKeyIDLength is how much of an API key is kept in the clear so its owner
+// can recognise it.
+const apiKeyIDLength = len(APIKeyPrefix) + 8
+
+// API key scopes name what a key may be used for.
+const (
+	APIScopeWorkoutsRead  = "workouts:read"
+	APIScopeWorkoutsWrite = "workouts:write"
+	APIScopeStatsRead     = "stats:read"
+)
+
+var APIScopes = []string{APIScopeWorkoutsRead, APIScopeWorkoutsWrite, APIScopeStatsRead}
+
+// Token is issued with its PlainText, which is never stored; later reads
+// only have the Hash. The session fields describe the client it was issued
+// to and are filled in by the store. Tokens issued together at login, and
+// every pair they are refreshed into, share a FamilyID.
 type Token struct {
-	PlainText string `json:"token"`
-	Hash      []byte `json:"_"`
-	UserID    int    `json:"_"`
-	Expiry    string `json:"expiry"`
-	Scope     string `json:"_"`
+	ID         int64      `json:"id,omitempty"`
+	PlainText  string     `json:"token,omitempty"`
+	Hash       []byte     `json:"-"`
+	UserID     int        `json:"-"`
+	Expiry     string     `json:"expiry"`
+	Scope      string     `json:"-"`
+	CreatedAt  *time.Time `json:"created_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	UserAgent  string     `json:"user_agent,omitempty"`
+	IP         string     `json:"ip,omitempty"`
+	FamilyID   int64      `json:"-"`
 }
 
 func GenerateToken(userID int, ttl time.Duration, scope string) (*Token, error) {
@@ -31,7 +68,41 @@ func GenerateToken(userID int, ttl time.Duration, scope string) (*Token, error)
 		return nil, err
 	}
 	token.PlainText = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(emptyBytes)
-	hash := sha256.Sum256([]byte(token.PlainText))
-	token.Hash = hash[:]
+	token.Hash = Hash(token.PlainText)
+	return token, nil
+}
+
+// Hash returns the hash a token is stored and looked up by.
+func Hash(plainText string) []byte {
+	hash := sha256.Sum256([]byte(plainText))
+	return hash[:]
+}
+
+// GenerateAPIKey is GenerateToken for API keys, whose PlainText starts with
+// APIKeyPrefix. A ttl of 0 means the key never expires and leaves Expiry empty.
+func GenerateAPIKey(userID int, ttl time.Duration) (*Token, error) {
+	token, err := GenerateToken(userID, ttl, ScopeAPIKey)
+	if err != nil {
+		return nil, err
+	}
+	if ttl == 0 {
+		token.Expiry = ""
+	}
+	token.PlainText = APIKeyPrefix + token.PlainText
+	token.Hash = Hash(token.PlainText)
 	return token, nil
 }
+
+// IsAPIKey reports whether plainText looks like an API key rather than a
+// session token.
+func IsAPIKey(plainText string) bool {
+	return strings.HasPrefix(plainText, APIKeyPrefix)
+}
+
+// APIKeyID returns the leading part of an API key shown to identify it.
+func APIKeyID(plainText string) string {
+	if len(plainText) < apiKeyIDLength {
+		return plainText
+	}
+	return plainText[:apiKeyIDLength]
+}
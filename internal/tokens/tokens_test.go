@@ -0,0 +1,45 @@
+package tokens
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateToken(t *testing.T) {
+	token, err := GenerateToken(7, time.Hour, ScopeAuth)
+	require.NoError(t, err)
+	assert.Len(t, token.PlainText, 52)
+	assert.Equal(t, Hash(token.PlainText), token.Hash)
+
+	js, err := json.Marshal(token)
+	require.NoError(t, err)
+	var fields map[string]interface{}
+	require.NoError(t, json.Unmarshal(js, &fields))
+	assert.ElementsMatch(t, []string{"token", "expiry"}, keys(fields))
+}
+
+func TestGenerateAPIKey(t *testing.T) {
+	key, err := GenerateAPIKey(7, 0)
+	require.NoError(t, err)
+	assert.True(t, IsAPIKey(key.PlainText))
+	assert.Equal(t, ScopeAPIKey, key.Scope)
+	assert.Equal(t, Hash(key.PlainText), key.Hash)
+	assert.Empty(t, key.Expiry)
+	assert.Equal(t, key.PlainText[:12], APIKeyID(key.PlainText))
+
+	token, err := GenerateToken(7, time.Hour, ScopeAuth)
+	require.NoError(t, err)
+	assert.False(t, IsAPIKey(token.PlainText))
+}
+
+func keys(m map[string]interface{}) []string {
+	var list []string
+	for k := range m {
+		list = append(list, k)
+	}
+	return list
+}
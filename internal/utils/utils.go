@@ -3,8 +3,11 @@ package utils
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
+	"net/url"
 	"strconv"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 )
@@ -24,6 +27,17 @@ func ReadIDParam(r *http.Request) (int64, error) {
 
 }
 
+// ReadPathParam returns the decoded value of a URL parameter. chi matches
+// against the raw path when the request has one (e.g. for an escaped "/"), so
+// the parameter is only unescaped in that case; otherwise it is already decoded.
+func ReadPathParam(r *http.Request, key string) (string, error) {
+	param := chi.URLParam(r, key)
+	if r.URL.RawPath == "" {
+		return param, nil
+	}
+	return url.PathUnescape(param)
+}
+
 type Envelope map[string]interface{}
 
 func WriteJSON(w http.ResponseWriter, status int, data Envelope) error {
@@ -38,3 +52,37 @@ func WriteJSON(w http.ResponseWriter, status int, data Envelope) error {
 	return nil
 }
 
+// ReadIntQuery parses an optional integer query parameter, returning nil when it is absent.
+func ReadIntQuery(r *http.Request, key string) (*int, error) {
+	raw := r.URL.Query().Get(key)
+	if raw == "" {
+		return nil, nil
+	}
+	value, err := strconv.Atoi(raw)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be an integer", key)
+	}
+	return &value, nil
+}
+
+// ReadTimeQuery parses an optional RFC3339 timestamp or YYYY-MM-DD date query
+// parameter, returning nil when it is absent. Dates are interpreted as UTC midnight.
+func ReadTimeQuery(r *http.Request, key string) (*time.Time, error) {
+	return ReadTimeQueryIn(r, key, time.UTC)
+}
+
+// ReadTimeQueryIn is ReadTimeQuery with dates interpreted as midnight in loc.
+func ReadTimeQueryIn(r *http.Request, key string, loc *time.Location) (*time.Time, error) {
+	raw := r.URL.Query().Get(key)
+	if raw == "" {
+		return nil, nil
+	}
+	if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		return &t, nil
+	}
+	t, err := time.ParseInLocation(time.DateOnly, raw, loc)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be an RFC3339 timestamp or a YYYY-MM-DD date", key)
+	}
+	return &t, nil
+}
@@ -1,40 +1,50 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"net/http"
-	"time"
+	"os"
+	_ "time/tzdata" // GET /stats resolves IANA zones even on hosts without tzdata
 
 	"github.com/dapoadedire/fem_project/internal/app"
+	"github.com/dapoadedire/fem_project/internal/config"
 	"github.com/dapoadedire/fem_project/internal/routes"
 )
 
 func main() {
-	var port int
-	flag.IntVar(&port, "port", 8080, "go backend server port")
-	flag.Parse()
-	app, err := app.NewApplication()
+	cfg, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	app, err := app.NewApplication(cfg)
 	if err != nil {
 		panic(err)
 	}
-	defer app.DB.Close()
 
-	
 	r := routes.SetupRoutes(app)
 	server := &http.Server{
-		Addr:         fmt.Sprintf(":%d", port),
+		Addr:         fmt.Sprintf(":%d", cfg.Port),
 		Handler:      r,
-		IdleTimeout:  time.Minute,
-		ReadTimeout:  10 * time.Second,
-		WriteTimeout: 20 * time.Second,
+		IdleTimeout:  cfg.Server.IdleTimeout,
+		ReadTimeout:  cfg.Server.ReadTimeout,
+		WriteTimeout: cfg.Server.WriteTimeout,
 	}
 
-	app.Logger.Printf("we are running on port %d\n", port)
+	app.Logger.Info("we are running", "port", cfg.Port)
 
-	err = server.ListenAndServe()
+	// blocks until SIGINT or SIGTERM, then drains requests and closes the DB
+	err = app.Lifecycle.Run(context.Background(), server)
 	if err != nil {
-		app.Logger.Fatal(err)
+		app.Logger.Error("server stopped", "error", err)
+		os.Exit(1)
 	}
 
 }
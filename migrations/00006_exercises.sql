@@ -0,0 +1,22 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS exercises (
+    id BIGSERIAL PRIMARY KEY,
+    -- NULL for the built-in catalog, otherwise the user who added the exercise
+    user_id BIGINT REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(255) NOT NULL,
+    muscle_groups TEXT[] NOT NULL DEFAULT '{}',
+    equipment VARCHAR(100) NOT NULL DEFAULT '',
+    measurement_type VARCHAR(20) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT valid_measurement_type CHECK (measurement_type IN ('reps', 'duration'))
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS exercises_owner_name_idx ON exercises (COALESCE(user_id, 0), lower(name));
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS exercises;
+-- +goose StatementEnd
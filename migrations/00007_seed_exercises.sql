@@ -0,0 +1,35 @@
+-- +goose Up
+-- +goose StatementBegin
+INSERT INTO exercises (name, muscle_groups, equipment, measurement_type) VALUES
+    ('Squat', '{quadriceps,glutes,hamstrings}', 'barbell', 'reps'),
+    ('Front Squat', '{quadriceps,glutes,core}', 'barbell', 'reps'),
+    ('Deadlift', '{hamstrings,glutes,back}', 'barbell', 'reps'),
+    ('Romanian Deadlift', '{hamstrings,glutes}', 'barbell', 'reps'),
+    ('Bench Press', '{chest,triceps,shoulders}', 'barbell', 'reps'),
+    ('Incline Bench Press', '{chest,shoulders,triceps}', 'barbell', 'reps'),
+    ('Dumbbell Bench Press', '{chest,triceps,shoulders}', 'dumbbell', 'reps'),
+    ('Overhead Press', '{shoulders,triceps}', 'barbell', 'reps'),
+    ('Barbell Row', '{back,biceps}', 'barbell', 'reps'),
+    ('Dumbbell Row', '{back,biceps}', 'dumbbell', 'reps'),
+    ('Pull Up', '{back,biceps}', 'bodyweight', 'reps'),
+    ('Chin Up', '{back,biceps}', 'bodyweight', 'reps'),
+    ('Lat Pulldown', '{back,biceps}', 'cable', 'reps'),
+    ('Push Up', '{chest,triceps,shoulders}', 'bodyweight', 'reps'),
+    ('Dip', '{chest,triceps}', 'bodyweight', 'reps'),
+    ('Lunge', '{quadriceps,glutes}', 'dumbbell', 'reps'),
+    ('Leg Press', '{quadriceps,glutes}', 'machine', 'reps'),
+    ('Hip Thrust', '{glutes,hamstrings}', 'barbell', 'reps'),
+    ('Bicep Curl', '{biceps}', 'dumbbell', 'reps'),
+    ('Tricep Pushdown', '{triceps}', 'cable', 'reps'),
+    ('Lateral Raise', '{shoulders}', 'dumbbell', 'reps'),
+    ('Calf Raise', '{calves}', 'machine', 'reps'),
+    ('Plank', '{core}', 'bodyweight', 'duration'),
+    ('Running', '{cardio}', 'none', 'duration'),
+    ('Rowing', '{cardio,back}', 'machine', 'duration')
+ON CONFLICT DO NOTHING;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM exercises WHERE user_id IS NULL;
+-- +goose StatementEnd
@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE workout_entries
+ADD COLUMN exercise_id BIGINT REFERENCES exercises(id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS workout_entries_exercise_id_idx ON workout_entries (exercise_id);
+
+-- link existing free-text entries to the built-in catalog where the names match
+UPDATE workout_entries we
+SET exercise_id = e.id, exercise_name = e.name
+FROM exercises e
+WHERE e.user_id IS NULL AND lower(e.name) = lower(we.exercise_name);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE workout_entries
+DROP COLUMN exercise_id;
+-- +goose StatementEnd
@@ -0,0 +1,24 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS personal_records (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    exercise_id BIGINT REFERENCES exercises(id) ON DELETE SET NULL,
+    exercise_name VARCHAR(255) NOT NULL,
+    record_type VARCHAR(50) NOT NULL,
+    -- the weight a max_reps record was set at, 0 for every other record type
+    weight DECIMAL(5,2) NOT NULL DEFAULT 0,
+    value DECIMAL(10,2) NOT NULL,
+    workout_id BIGINT REFERENCES workouts(id) ON DELETE CASCADE,
+    workout_entry_id BIGINT REFERENCES workout_entries(id) ON DELETE SET NULL,
+    achieved_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS personal_records_key_idx
+ON personal_records (user_id, lower(exercise_name), record_type, weight);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS personal_records;
+-- +goose StatementEnd
@@ -0,0 +1,48 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS programs (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(255) NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    weeks INTEGER NOT NULL CHECK (weeks > 0),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- days without a row are rest days
+CREATE TABLE IF NOT EXISTS program_days (
+    id BIGSERIAL PRIMARY KEY,
+    program_id BIGINT NOT NULL REFERENCES programs(id) ON DELETE CASCADE,
+    week_number INTEGER NOT NULL CHECK (week_number > 0),
+    day_number INTEGER NOT NULL CHECK (day_number BETWEEN 1 AND 7),
+    template_id BIGINT REFERENCES workout_templates(id) ON DELETE SET NULL,
+    title VARCHAR(255) NOT NULL DEFAULT '',
+    UNIQUE (program_id, week_number, day_number)
+);
+
+CREATE TABLE IF NOT EXISTS program_enrollments (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    program_id BIGINT NOT NULL REFERENCES programs(id) ON DELETE CASCADE,
+    start_date DATE NOT NULL,
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS program_enrollments_active_idx ON program_enrollments (user_id) WHERE active;
+
+ALTER TABLE workouts
+ADD COLUMN program_day_id BIGINT REFERENCES program_days(id) ON DELETE SET NULL,
+ADD COLUMN enrollment_id BIGINT REFERENCES program_enrollments(id) ON DELETE SET NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE workouts
+DROP COLUMN enrollment_id,
+DROP COLUMN program_day_id;
+DROP TABLE IF EXISTS program_enrollments;
+DROP TABLE IF EXISTS program_days;
+DROP TABLE IF EXISTS programs;
+-- +goose StatementEnd
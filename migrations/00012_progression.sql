@@ -0,0 +1,31 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE workout_entries
+ADD COLUMN rpe DECIMAL(3,1) CHECK (rpe BETWEEN 1 AND 10);
+
+ALTER TABLE workout_template_entries
+ADD COLUMN rpe DECIMAL(3,1) CHECK (rpe BETWEEN 1 AND 10);
+
+-- exercise is the lower-cased exercise name, or '' for the user's default
+CREATE TABLE IF NOT EXISTS progression_settings (
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    exercise VARCHAR(255) NOT NULL DEFAULT '',
+    rule VARCHAR(50) NOT NULL,
+    increment DECIMAL(5,2) NOT NULL,
+    target_reps INTEGER NOT NULL,
+    min_reps INTEGER NOT NULL,
+    max_reps INTEGER NOT NULL,
+    target_rpe DECIMAL(3,1) NOT NULL,
+    deload_after INTEGER NOT NULL,
+    deload_percent DECIMAL(4,3) NOT NULL,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, exercise)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS progression_settings;
+ALTER TABLE workout_template_entries DROP COLUMN rpe;
+ALTER TABLE workout_entries DROP COLUMN rpe;
+-- +goose StatementEnd
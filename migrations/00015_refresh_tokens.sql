@@ -0,0 +1,20 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE SEQUENCE IF NOT EXISTS token_families_seq;
+
+ALTER TABLE tokens
+ADD COLUMN family_id BIGINT,
+ADD COLUMN used_at TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX IF NOT EXISTS tokens_family_id_idx ON tokens (family_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS tokens_family_id_idx;
+ALTER TABLE tokens
+DROP COLUMN used_at,
+DROP COLUMN family_id;
+
+DROP SEQUENCE IF EXISTS token_families_seq;
+-- +goose StatementEnd
@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+-- addresses differing only in case belong to the same inbox; accounts that
+-- already share one have to be merged by hand before this can run
+DROP INDEX IF EXISTS users_email_lower_idx;
+CREATE UNIQUE INDEX users_email_lower_key ON users (LOWER(email));
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS users_email_lower_key;
+CREATE INDEX IF NOT EXISTS users_email_lower_idx ON users (LOWER(email));
+-- +goose StatementEnd